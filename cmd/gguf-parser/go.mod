@@ -10,6 +10,7 @@ require (
 	github.com/gpustack/gguf-parser-go v0.6.0
 	github.com/jedib0t/go-pretty/v6 v6.6.1
 	github.com/urfave/cli/v2 v2.27.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/urfave/cli/v2"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func imatrixCommand(name string) *cli.Command {
+	var (
+		statistics bool
+		inJson     bool
+	)
+	return &cli.Command{
+		Name: "imatrix",
+		Usage: "Check the coverage of an imatrix GGUF file against a model GGUF file, " +
+			"exit non-zero if any tensor of the model is missing or mismatched importance data.",
+		UsageText: name + " imatrix [OPTIONS] IMATRIX_IN MODEL_IN",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Destination: &statistics,
+				Value:       statistics,
+				Name:        "statistics",
+				Usage:       "Display the activation statistics of each tensor, only works with local IMATRIX_IN.",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				return errors.New("imatrix requires IMATRIX_IN and MODEL_IN")
+			}
+
+			ropts := []GGUFReadOption{
+				SkipLargeMetadata(),
+				UseMMap(),
+			}
+			parse := func(in string) (*GGUFFile, error) {
+				if strings.HasPrefix(in, "http://") || strings.HasPrefix(in, "https://") {
+					return ParseGGUFFileRemote(c.Context, in, ropts...)
+				}
+				return ParseGGUFFile(in, ropts...)
+			}
+
+			imIn, mdIn := c.Args().Get(0), c.Args().Get(1)
+			imGf, err := parse(imIn)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", imIn, err)
+			}
+			if imGf.Metadata().Type != "imatrix" {
+				return fmt.Errorf("%s is not an imatrix GGUF file", imIn)
+			}
+			mdGf, err := parse(mdIn)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", mdIn, err)
+			}
+
+			gi := imGf.IMatrix()
+			gc := gi.Coverage(mdGf)
+
+			var ss []GGUFIMatrixStatistics
+			if statistics {
+				if strings.HasPrefix(imIn, "http://") || strings.HasPrefix(imIn, "https://") {
+					return errors.New("--statistics only works with local IMATRIX_IN")
+				}
+				f, err := os.Open(imIn)
+				if err != nil {
+					return fmt.Errorf("failed to open %s: %w", imIn, err)
+				}
+				ss, err = imGf.IMatrixStatistics(f)
+				_ = f.Close()
+				if err != nil {
+					return fmt.Errorf("failed to read statistics of %s: %w", imIn, err)
+				}
+			}
+
+			if inJson {
+				o := map[string]any{
+					"imatrix":  gi,
+					"coverage": gc,
+				}
+				if statistics {
+					o["statistics"] = ss
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err = enc.Encode(o); err != nil {
+					return fmt.Errorf("failed to encode JSON: %w", err)
+				}
+			} else {
+				tprint(
+					"IMatrix",
+					[][]any{
+						{
+							"Chunks",
+							"Chunk Size",
+							"Datasets",
+							"Entries",
+							"Coverage",
+							"Missing",
+							"Mismatched",
+							"Unused",
+						},
+					},
+					[][]any{
+						{
+							sprintf(gi.ChunkCount),
+							sprintf(tenary(gi.ChunkSize == 0, "N/A", gi.ChunkSize)),
+							sprintf(tenary(len(gi.Datasets) == 0, "N/A", strings.Join(gi.Datasets, ", "))),
+							sprintf(len(gi.Entries)),
+							sprintf("%d / %d", gc.Covered, gc.Total),
+							sprintf(len(gc.Missing)),
+							sprintf(len(gc.Mismatched)),
+							sprintf(len(gc.Unused)),
+						},
+					})
+
+				if statistics {
+					bds := make([][]any, 0, len(ss))
+					for _, s := range ss {
+						bds = append(bds, []any{
+							s.Name,
+							sprintf(s.Elements),
+							sprintf(s.ZeroCountMatrices),
+							sprintf("%.4f", s.Sum),
+							sprintf("%.4f", s.Minimum),
+							sprintf("%.4f", s.Maximum),
+							sprintf("%.4f", s.Mean),
+							sprintf("%.4f", s.StandardDeviation),
+							sprintf("%.2f%%", s.ActiveRatio*100),
+							sprintf("%.4f", s.Entropy),
+						})
+					}
+					tprint(
+						"Statistics",
+						[][]any{
+							{
+								"Tensor",
+								"Elements",
+								"Zero Count Matrices",
+								"Sum",
+								"Min",
+								"Max",
+								"Mean",
+								"StdDev",
+								"Active",
+								"Entropy",
+							},
+						},
+						bds)
+				}
+
+				for _, n := range gc.Missing {
+					fmt.Printf("MISSING: %s\n", n)
+				}
+				for _, n := range gc.Mismatched {
+					fmt.Printf("MISMATCHED: %s\n", n)
+				}
+			}
+
+			if len(gc.Missing) != 0 || len(gc.Mismatched) != 0 {
+				return fmt.Errorf("found %d missing and %d mismatched tensor(s)", len(gc.Missing), len(gc.Mismatched))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/urfave/cli/v2"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func lintCommand(name string) *cli.Command {
+	var (
+		failOn = "error"
+		inJson bool
+	)
+	return &cli.Command{
+		Name:      "lint",
+		Usage:     "Lint GGUF files, exit non-zero if any finding reaches the \"--fail-on\" severity.",
+		UsageText: name + " lint [OPTIONS] GGUF_IN...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Destination: &failOn,
+				Value:       failOn,
+				Name:        "fail-on",
+				Usage: "Specify the minimum severity of findings to exit non-zero, " +
+					"select from [info, warning, error].",
+			},
+			&cli.BoolFlag{
+				Destination: &inJson,
+				Value:       inJson,
+				Name:        "json",
+				Usage:       "Output as JSON.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				return errors.New("lint requires at least one GGUF_IN")
+			}
+
+			var sev GGUFLintSeverity
+			switch strings.ToLower(failOn) {
+			case "info":
+				sev = GGUFLintSeverityInfo
+			case "warning":
+				sev = GGUFLintSeverityWarning
+			case "error":
+				sev = GGUFLintSeverityError
+			default:
+				return errors.New("--fail-on must be one of [info, warning, error]")
+			}
+
+			ropts := []GGUFReadOption{
+				SkipLargeMetadata(),
+				UseMMap(),
+			}
+
+			var (
+				o     = map[string][]GGUFLintFinding{}
+				fails int
+			)
+			for _, in := range c.Args().Slice() {
+				var (
+					gf  *GGUFFile
+					fn  string
+					err error
+				)
+				if strings.HasPrefix(in, "http://") || strings.HasPrefix(in, "https://") {
+					gf, err = ParseGGUFFileRemote(c.Context, in, ropts...)
+					fn = in[strings.LastIndex(in, "/")+1:]
+				} else {
+					gf, err = ParseGGUFFile(in, ropts...)
+					fn = filepath.Base(in)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %w", in, err)
+				}
+
+				fs := gf.Lint(WithLintFilename(fn))
+				for _, f := range fs {
+					if f.Severity >= sev {
+						fails++
+					}
+				}
+				if inJson {
+					o[in] = fs
+					continue
+				}
+				for _, f := range fs {
+					fmt.Printf("%s: %s [%s] %s\n", in, strings.ToUpper(f.Severity.String()), f.Rule, f.Message)
+				}
+			}
+
+			if inJson {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(o); err != nil {
+					return fmt.Errorf("failed to encode JSON: %w", err)
+				}
+			}
+
+			if fails != 0 {
+				return fmt.Errorf("found %d finding(s) at or above %s severity", fails, sev)
+			}
+			return nil
+		},
+	}
+}
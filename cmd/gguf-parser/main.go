@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"net"
@@ -19,6 +20,7 @@ import (
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
 
 	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
 )
@@ -45,7 +47,7 @@ func main() {
 	app := &cli.App{
 		Name:            name,
 		Usage:           "Review/Check GGUF files and estimate the memory usage and provide optimization suggestions.",
-		UsageText:       name + " [GLOBAL OPTIONS]",
+		UsageText:       name + " [GLOBAL OPTIONS] [COMMAND] [COMMAND OPTIONS]",
 		Version:         Version,
 		Reader:          os.Stdin,
 		Writer:          os.Stdout,
@@ -72,7 +74,8 @@ func main() {
 				},
 				Usage: "Path where the GGUF file to load for the main model, e.g. \"~/.cache" +
 					"/lm-studio/models/QuantFactory/Qwen2-7B-Instruct-GGUF" +
-					"/Qwen2-7B-Instruct.Q5_K_M.gguf\".",
+					"/Qwen2-7B-Instruct.Q5_K_M.gguf\", " +
+					"a safetensors file is accepted as well, the config.json beside it fills the architecture.",
 			},
 			&cli.StringFlag{
 				Destination: &draftPath,
@@ -637,6 +640,33 @@ func main() {
 					"for example, within CUDA, \"cudaMemGetInfo\" or \"cudaSetDevice\" would occupy some RAM and VRAM, " +
 					"see https://stackoverflow.com/questions/64854862/free-memory-occupied-by-cudamemgetinfo.",
 			},
+			&cli.StringFlag{
+				Destination: &quantize,
+				Value:       quantize,
+				Category:    "Estimate",
+				Name:        "quantize",
+				Usage: "Specify the target quantization type to plan for the model, " +
+					"e.g. \"Q4_K_M\", " +
+					"the metadata and the estimate are displayed as if the model is quantized to the given type " +
+					"with the llama.cpp quantize mixing rules.",
+			},
+			&cli.BoolFlag{
+				Destination: &quantizeImatrix,
+				Value:       quantizeImatrix,
+				Category:    "Estimate",
+				Name:        "quantize-imatrix",
+				Usage: "Plan the quantization with an importance matrix, " +
+					"works with \"--quantize\", " +
+					"which is required by the IQ1_S, IQ1_M, IQ2_XXS, IQ2_XS, IQ2_S and Q2_K_S types.",
+			},
+			&cli.BoolFlag{
+				Destination: &quantizePure,
+				Value:       quantizePure,
+				Category:    "Estimate",
+				Name:        "quantize-pure",
+				Usage: "Plan the quantization without mixing, " +
+					"works with \"--quantize\".",
+			},
 			&cli.IntFlag{
 				Destination: &lmcCtxSize,
 				Value:       lmcCtxSize,
@@ -649,6 +679,26 @@ func main() {
 					"which is used to estimate the usage, " +
 					"default is equal to the model's maximum context size.",
 			},
+			&cli.IntFlag{
+				Destination: &lmcCtxSizePerSlot,
+				Value:       lmcCtxSizePerSlot,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "ctx-size-per-slot",
+				Usage: "Specify the size of context of each parallel sequence(slot), " +
+					"which is used to estimate the usage, " +
+					"the size of prompt context is multiplied by \"--parallel-size\", " +
+					"and overrides \"--ctx-size\".",
+			},
+			&cli.StringFlag{
+				Destination: &lmcMaxParallelVRAM,
+				Value:       lmcMaxParallelVRAM,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "max-parallel-vram",
+				Usage: "Specify the VRAM budget of each GPU in MiB, separated by commas, " +
+					"which is used to estimate the maximum parallel sequences(slots) that fit, " +
+					"works with \"--ctx-size-per-slot\", " +
+					"for example, \"--max-parallel-vram 24576,24576\" means two GPUs have 24 GiB VRAM separately.",
+			},
 			&cli.StringFlag{
 				Destination: &lmcRoPEScalingType,
 				Category:    "Estimate/LLaMACpp",
@@ -753,6 +803,16 @@ func main() {
 					"which is used to estimate the usage. " +
 					"Disable Key-Value offloading can reduce the usage of VRAM.",
 			},
+			&cli.BoolFlag{
+				Destination: &lmcNoKVUnified,
+				Value:       lmcNoKVUnified,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "no-kv-unified",
+				Usage: "Specify disabling the unified Key-Value cache, " +
+					"which is used to estimate the usage. " +
+					"Each parallel sequence caches in its own part of the context, " +
+					"which can reduce the usage of computation.",
+			},
 			&cli.StringFlag{
 				Destination: &lmcSplitMode,
 				Value:       lmcSplitMode,
@@ -779,7 +839,7 @@ func main() {
 				Category:    "Estimate/LLaMACpp",
 				Name:        "no-mmap",
 				Usage: "Specify disabling Memory-Mapped using, " +
-					"which is used to estimate the usage. " +
+					"which is used to estimate the usage of LLaMA.cpp and Stable Diffusion.cpp. " +
 					"Memory-Mapped can avoid loading the entire model weights into RAM.",
 			},
 			&cli.BoolFlag{ // LLaMABox compatibility
@@ -800,6 +860,15 @@ func main() {
 				Name:        "visual-max-image-size",
 				Usage:       "Specify maximum image size when completion with vision model.",
 			},
+			&cli.BoolFlag{
+				Destination: &lmcSearchMMProj,
+				Value:       lmcSearchMMProj,
+				Category:    "Estimate/LLaMACpp",
+				Name:        "search-mmproj",
+				Usage: "Search the multimodal projector which pairs with the model, " +
+					"in the directory of \"--path\", or in the \"--hf-repo\" or \"--ms-repo\", " +
+					"works only if no multimodal projector is specified.",
+			},
 			&cli.UintFlag{ // LLaMABox compatibility
 				Destination: &lmcMaxProjectedCache,
 				Value:       lmcMaxProjectedCache,
@@ -831,6 +900,18 @@ func main() {
 				Usage: "Specify the step of layers to offload, " +
 					"works with \"--gpu-layers\".",
 			},
+			&cli.StringFlag{
+				Destination: &sdcMode,
+				Value:       sdcMode,
+				Category:    "Estimate/StableDiffusionCpp",
+				Name:        "image-mode",
+				Aliases: []string{
+					"mode", // StableDiffusionCpp compatibility
+					"M",    // StableDiffusionCpp compatibility
+				},
+				Usage: "Specify the run mode of the image, " +
+					"which is used to estimate the usage, select from [txt2img, img2img, upscale, txt2vid, img2vid].",
+			},
 			&cli.UintFlag{
 				Destination: &sdcBatchCount,
 				Value:       sdcBatchCount,
@@ -864,6 +945,18 @@ func main() {
 				},
 				Usage: "Specify the (maximum) width of the image.",
 			},
+			&cli.UintFlag{
+				Destination: &sdcFrameCount,
+				Value:       sdcFrameCount,
+				Category:    "Estimate/StableDiffusionCpp",
+				Name:        "image-video-frames",
+				Aliases: []string{
+					"video-frames", // StableDiffusionCpp compatibility
+				},
+				Usage: "Specify the frame count of the video, " +
+					"only works for the video diffusion model, " +
+					"default is 33.",
+			},
 			&cli.BoolFlag{
 				Destination: &sdcNoConditionerOffload,
 				Value:       sdcNoConditionerOffload,
@@ -886,6 +979,18 @@ func main() {
 				},
 				Usage: "Specify to offload the vae model to CPU.",
 			},
+			&cli.StringFlag{
+				Destination: &sdcLoRAApplyMode,
+				Value:       sdcLoRAApplyMode,
+				Category:    "Estimate/StableDiffusionCpp",
+				Name:        "image-lora-apply-mode",
+				Aliases: []string{
+					"lora-apply-mode", // StableDiffusionCpp compatibility
+				},
+				Usage: "Specify the mode of applying the LoRA adapters, " +
+					"select from [auto, merge, runtime], " +
+					"\"auto\" merges at load if the target weights are not quantized, otherwise, applies at runtime.",
+			},
 			&cli.BoolFlag{
 				Destination: &sdcNoControlNetOffload,
 				Value:       sdcNoControlNetOffload,
@@ -946,6 +1051,14 @@ func main() {
 				Name:        "skip-metadata",
 				Usage:       "Skip to display metadata.",
 			},
+			&cli.BoolFlag{
+				Destination: &quantReport,
+				Value:       quantReport,
+				Category:    "Output",
+				Name:        "quant-report",
+				Usage: "Display the quantization mix report, " +
+					"which groups the tensors by role and flags the unusual mixes.",
+			},
 			&cli.BoolFlag{
 				Destination: &skipArchitecture,
 				Value:       skipArchitecture,
@@ -1010,8 +1123,24 @@ func main() {
 				Name:        "json-pretty",
 				Usage:       "Works with \"--json\", to output pretty format JSON.",
 			},
+			&cli.StringFlag{
+				Destination: &outputFormat,
+				Value:       outputFormat,
+				Category:    "Output",
+				Name:        "format",
+				Usage: "Specify the output format, " +
+					"select from [table, json, yaml, csv, tsv, markdown], " +
+					"csv/tsv/markdown output each table with stable column names, " +
+					"one row per step when works with \"--gpu-layers-step\".",
+			},
 		},
 		Action: mainAction,
+		Commands: []*cli.Command{
+			splitCommand(name),
+			mergeCommand(name),
+			lintCommand(name),
+			imatrixCommand(name),
+		},
 	}
 
 	if err := app.RunContext(signalx.Handler(), os.Args); err != nil {
@@ -1084,8 +1213,13 @@ var (
 	overrideTensors   cli.StringSlice
 	deviceMetrics     cli.StringSlice
 	platformFootprint = "150,250"
+	quantize          string
+	quantizeImatrix   bool
+	quantizePure      bool
 	// estimate options for llama.cpp
 	lmcCtxSize                = 0
+	lmcCtxSizePerSlot         = 0
+	lmcMaxParallelVRAM        string
 	lmcRoPEFreqBase           float64
 	lmcRoPEFreqScale          float64
 	lmcRoPEScalingType        string
@@ -1096,20 +1230,25 @@ var (
 	lmcCacheKeyType           = "f16"
 	lmcCacheValueType         = "f16"
 	lmcNoKVOffload            bool
+	lmcNoKVUnified            bool
 	lmcSplitMode              = "layer"
 	lmcSWAFull                = false
 	lmcNoMMap                 bool
 	lmcVisualMaxImageSize     uint
 	lmcMaxProjectedCache      uint
+	lmcSearchMMProj           bool
 	lmcOffloadLayersDraft     = -1
 	lmcOffloadLayersStep      uint64
 	// estimate options for stable-diffusion.cpp
+	sdcMode                              = "txt2img"
 	sdcBatchCount                   uint = 1
 	sdcHeight                       uint = 1024
 	sdcWidth                        uint = 1024
+	sdcFrameCount                   uint
 	sdcNoConditionerOffload         bool
 	sdcNoAutoencoderOffload         bool
 	sdcNoControlNetOffload          bool
+	sdcLoRAApplyMode                = "auto"
 	sdcAutoencoderTiling            bool
 	sdcNoAutoencoderTiling          bool
 	sdcFreeComputeMemoryImmediately bool
@@ -1118,21 +1257,31 @@ var (
 	rawOutput        string
 	inShort          bool
 	skipMetadata     bool
+	quantReport      bool
 	skipArchitecture bool
 	skipTokenizer    bool
 	skipEstimate     bool
 	inMib            bool
 	inJson           bool
 	inPrettyJson     = true
+	outputFormat     = "table"
 )
 
 func mainAction(c *cli.Context) error {
 	ctx := c.Context
 
+	switch outputFormat = strings.ToLower(outputFormat); outputFormat {
+	case "", "table", "csv", "tsv", "markdown":
+	case "json":
+		inJson = true
+	case "yaml":
+	default:
+		return errors.New("--format must be one of [table, json, yaml, csv, tsv, markdown]")
+	}
+
 	// Prepare options.
 
 	ropts := []GGUFReadOption{
-		SkipLargeMetadata(),
 		UseMMap(),
 		UseCache(),
 	}
@@ -1283,6 +1432,9 @@ func mainAction(c *cli.Context) error {
 	if lmcCtxSize > 0 {
 		eopts = append(eopts, WithLLaMACppContextSize(int32(lmcCtxSize)))
 	}
+	if lmcCtxSizePerSlot > 0 {
+		eopts = append(eopts, WithLLaMACppSlotContextSize(int32(lmcCtxSizePerSlot)))
+	}
 	if lmcRoPEFreqBase > 0 || lmcRoPEFreqScale > 0 || lmcRoPEScalingType != "" || lmcRoPEScalingOrigCtxSize > 0 {
 		eopts = append(eopts, WithLLaMACppRoPE(lmcRoPEFreqBase, lmcRoPEFreqScale, lmcRoPEScalingType, int32(lmcRoPEScalingOrigCtxSize)))
 	}
@@ -1299,14 +1451,25 @@ func mainAction(c *cli.Context) error {
 		eopts = append(eopts, WithLLaMACppPhysicalBatchSize(int32(lmcPhysicalBatchSize)))
 	}
 	if lmcCacheKeyType != "" {
-		eopts = append(eopts, WithLLaMACppCacheKeyType(toGGMLType(lmcCacheKeyType)))
+		t, ok := toGGMLType(lmcCacheKeyType)
+		if !ok {
+			return fmt.Errorf("--cache-type-k has unsupported type %q", lmcCacheKeyType)
+		}
+		eopts = append(eopts, WithLLaMACppCacheKeyType(t))
 	}
 	if lmcCacheValueType != "" {
-		eopts = append(eopts, WithLLaMACppCacheValueType(toGGMLType(lmcCacheValueType)))
+		t, ok := toGGMLType(lmcCacheValueType)
+		if !ok {
+			return fmt.Errorf("--cache-type-v has unsupported type %q", lmcCacheValueType)
+		}
+		eopts = append(eopts, WithLLaMACppCacheValueType(t))
 	}
 	if lmcNoKVOffload {
 		eopts = append(eopts, WithoutLLaMACppOffloadKVCache())
 	}
+	if lmcNoKVUnified {
+		eopts = append(eopts, WithoutLLaMACppUnifiedKVCache())
+	}
 	switch lmcSplitMode {
 	case "row":
 		eopts = append(eopts, WithLLaMACppSplitMode(LLaMACppSplitModeRow))
@@ -1324,6 +1487,20 @@ func mainAction(c *cli.Context) error {
 	if lmcMaxProjectedCache > 0 {
 		eopts = append(eopts, WithLLaMACppMaxProjectedCache(uint32(lmcMaxProjectedCache)))
 	}
+	switch sdcMode {
+	case "txt2img":
+		eopts = append(eopts, WithStableDiffusionCppMode(StableDiffusionCppModeTextToImage))
+	case "img2img":
+		eopts = append(eopts, WithStableDiffusionCppMode(StableDiffusionCppModeImageToImage))
+	case "upscale":
+		eopts = append(eopts, WithStableDiffusionCppMode(StableDiffusionCppModeUpscale))
+	case "txt2vid":
+		eopts = append(eopts, WithStableDiffusionCppMode(StableDiffusionCppModeTextToVideo))
+	case "img2vid":
+		eopts = append(eopts, WithStableDiffusionCppMode(StableDiffusionCppModeImageToVideo))
+	default:
+		return errors.New("--image-mode must be one of [txt2img, img2img, upscale, txt2vid, img2vid]")
+	}
 	if sdcBatchCount > 1 {
 		eopts = append(eopts, WithStableDiffusionCppBatchCount(int32(sdcBatchCount)))
 	}
@@ -1333,6 +1510,9 @@ func mainAction(c *cli.Context) error {
 	if sdcWidth > 0 {
 		eopts = append(eopts, WithStableDiffusionCppWidth(uint32(sdcWidth)))
 	}
+	if sdcFrameCount > 0 {
+		eopts = append(eopts, WithStableDiffusionCppFrameCount(uint32(sdcFrameCount)))
+	}
 	if sdcNoConditionerOffload {
 		eopts = append(eopts, WithoutStableDiffusionCppOffloadConditioner())
 	}
@@ -1365,29 +1545,46 @@ func mainAction(c *cli.Context) error {
 	{
 		var err error
 
-		ropts := ropts[:len(ropts):len(ropts)]
+		// The drafter pairing compares the token strings of the main model and the drafter,
+		// so both are parsed without SkipLargeMetadata, the others skip the large metadata.
+		fropts := ropts[:len(ropts):len(ropts)]
+		ropts := append(fropts, SkipLargeMetadata())
+		mropts := ropts[:len(ropts):len(ropts)]
+		if draftPath != "" || draftUrl != "" || hfDraftRepo != "" && hfDraftFile != "" || msDraftRepo != "" && msDraftFile != "" {
+			mropts = fropts
+		}
 
 		// Main model.
 		switch {
 		default:
 			return errors.New("no model specified")
+		case path != "" && strings.HasSuffix(path, ".safetensors"):
+			gf, err = ParseSafetensorsFile(path, mropts...)
 		case path != "":
-			gf, err = ParseGGUFFile(path, ropts...)
+			gf, err = ParseGGUFFile(path, mropts...)
+		case url != "" && strings.HasSuffix(url, ".safetensors"):
+			gf, err = ParseSafetensorsFileRemote(ctx, url, mropts...)
 		case url != "":
-			gf, err = ParseGGUFFileRemote(ctx, url, ropts...)
+			gf, err = ParseGGUFFileRemote(ctx, url, mropts...)
 		case hfRepo != "" && hfFile != "":
 			if hfToken != "" {
 				ropts = append(ropts, UseBearerAuth(hfToken))
+				mropts = append(mropts, UseBearerAuth(hfToken))
 			}
-			gf, err = ParseGGUFFileFromHuggingFace(ctx, hfRepo, hfFile, ropts...)
+			if strings.HasSuffix(hfFile, ".safetensors") {
+				gf, err = ParseSafetensorsFileFromHuggingFace(ctx, hfRepo, hfFile, mropts...)
+				break
+			}
+			gf, err = ParseGGUFFileFromHuggingFace(ctx, hfRepo, hfFile, mropts...)
 		case msRepo != "" && msFile != "":
 			if msToken != "" {
 				ropts = append(ropts, UseBearerAuth(msToken))
+				mropts = append(mropts, UseBearerAuth(msToken))
 			}
-			gf, err = ParseGGUFFileFromModelScope(ctx, msRepo, msFile, ropts...)
+			gf, err = ParseGGUFFileFromModelScope(ctx, msRepo, msFile, mropts...)
 		case olModel != "":
 			om := ParseOllamaModel(olModel, SetOllamaModelBaseURL(olBaseURL))
-			gf, err = ParseGGUFFileFromOllamaModel(ctx, om, ropts...)
+			gf, err = ParseGGUFFileFromOllamaModel(ctx, om, mropts...)
 			if err == nil && om != nil && olUsage {
 				// Parameters override.
 				{
@@ -1508,13 +1705,13 @@ func mainAction(c *cli.Context) error {
 		// Drafter for LLaMACpp.
 		switch {
 		case draftPath != "":
-			lmcDrafterGf, err = ParseGGUFFile(draftPath, ropts...)
+			lmcDrafterGf, err = ParseGGUFFile(draftPath, mropts...)
 		case draftUrl != "":
-			lmcDrafterGf, err = ParseGGUFFileRemote(ctx, draftUrl, ropts...)
+			lmcDrafterGf, err = ParseGGUFFileRemote(ctx, draftUrl, mropts...)
 		case hfDraftRepo != "" && hfDraftFile != "":
-			lmcDrafterGf, err = ParseGGUFFileFromHuggingFace(ctx, hfDraftRepo, hfDraftFile, ropts...)
+			lmcDrafterGf, err = ParseGGUFFileFromHuggingFace(ctx, hfDraftRepo, hfDraftFile, mropts...)
 		case msDraftRepo != "" && msDraftFile != "":
-			lmcDrafterGf, err = ParseGGUFFileFromModelScope(ctx, msDraftRepo, msDraftFile, ropts...)
+			lmcDrafterGf, err = ParseGGUFFileFromModelScope(ctx, msDraftRepo, msDraftFile, mropts...)
 		}
 		if err != nil {
 			return fmt.Errorf("failed to parse draft GGUF file: %w", err)
@@ -1534,6 +1731,25 @@ func mainAction(c *cli.Context) error {
 		if err != nil {
 			return fmt.Errorf("failed to parse multimodal projector GGUF file: %w", err)
 		}
+		if lmcProjectGf == nil && lmcSearchMMProj {
+			var mmproj string
+			switch {
+			case path != "":
+				mmproj, lmcProjectGf, err = SearchProjectorGGUFFile(gf, filepath.Dir(path), ropts...)
+			case hfRepo != "":
+				mmproj, lmcProjectGf, err = SearchProjectorGGUFFileFromHuggingFace(ctx, gf, hfRepo, ropts...)
+			case msRepo != "":
+				mmproj, lmcProjectGf, err = SearchProjectorGGUFFileFromModelScope(ctx, gf, msRepo, ropts...)
+			}
+			switch {
+			case errors.Is(err, ErrGGUFProjectorNotFound):
+				_, _ = fmt.Fprintln(os.Stderr, "WARNING: no multimodal projector pairs with the model")
+			case err != nil:
+				return fmt.Errorf("failed to search multimodal projector GGUF file: %w", err)
+			case mmproj != "":
+				_, _ = fmt.Fprintf(os.Stderr, "INFO: found multimodal projector %s\n", mmproj)
+			}
+		}
 
 		// ControlNet for StableDiffusionCpp.
 		switch {
@@ -1566,6 +1782,53 @@ func mainAction(c *cli.Context) error {
 		}
 	}
 
+	// Check drafter, projector and adapters for LLaMACpp.
+
+	if lmcDrafterGf != nil {
+		dp := CheckDrafterCompatibility(gf, lmcDrafterGf)
+		for _, dm := range dp.Mismatches {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: draft model: %s\n", dm)
+		}
+		if dp.TokensCompared == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: draft model: token strings not compared\n")
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "INFO: draft model: %d/%d token(s) matched\n", dp.TokensMatched, dp.TokensCompared)
+		}
+	}
+	if lmcProjectGf != nil {
+		for _, pm := range CheckProjectorCompatibility(gf, lmcProjectGf) {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: multimodal projector: %s\n", pm)
+		}
+	}
+	if len(adapterGfs) > 0 && gf.Metadata().Architecture != "diffusion" {
+		for i, adpgf := range adapterGfs {
+			for _, am := range CheckAdapterCompatibility(gf, adpgf) {
+				_, _ = fmt.Fprintf(os.Stderr, "WARNING: adapter %d: %s\n", i, am)
+			}
+		}
+	}
+
+	// Plan quantization.
+
+	if quantize != "" {
+		ft, ok := toGGUFFileType(quantize)
+		if !ok {
+			return fmt.Errorf("unknown quantization type %q", quantize)
+		}
+		var qopts []GGUFQuantizeOption
+		if quantizeImatrix {
+			qopts = append(qopts, WithQuantizeImportanceMatrix())
+		}
+		if quantizePure {
+			qopts = append(qopts, WithQuantizePure())
+		}
+		pgf, err := gf.PlanQuantization(ft, qopts...)
+		if err != nil {
+			return fmt.Errorf("failed to plan quantization: %w", err)
+		}
+		gf = pgf
+	}
+
 	// Output raw.
 
 	if raw {
@@ -1591,6 +1854,7 @@ func mainAction(c *cli.Context) error {
 		a   = gf.Architecture()
 		t   = gf.Tokenizer()
 		lme LLaMACppRunEstimate
+		lpe *LLaMACppParallelEstimate
 		sde StableDiffusionCppRunEstimate
 	)
 
@@ -1626,6 +1890,29 @@ func mainAction(c *cli.Context) error {
 		}
 
 		lme = gf.EstimateLLaMACppRun(eopts...)
+		for _, w := range lme.Warnings {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: estimate: %s\n", w)
+		}
+
+		if lmcMaxParallelVRAM != "" {
+			if lmcCtxSizePerSlot <= 0 {
+				return errors.New("--max-parallel-vram must work with --ctx-size-per-slot")
+			}
+			vbss := strings.Split(lmcMaxParallelVRAM, ",")
+			vbs := make([]GGUFBytesScalar, len(vbss))
+			for i := range vbss {
+				v, err := strconv.ParseUint(strings.TrimSpace(vbss[i]), 10, 64)
+				if err != nil {
+					return fmt.Errorf("--max-parallel-vram has invalid budget %q: %w", vbss[i], err)
+				}
+				vbs[i] = GGUFBytesScalar(v * 1024 * 1024)
+			}
+			pe, err := gf.EstimateLLaMACppRunMaximumParallelSize(vbs, int32(lmcCtxSizePerSlot), eopts...)
+			if err != nil {
+				return fmt.Errorf("failed to estimate maximum parallel size: %w", err)
+			}
+			lpe = &pe
+		}
 	}
 
 	if !skipEstimate && m.Architecture == "diffusion" {
@@ -1644,6 +1931,20 @@ func mainAction(c *cli.Context) error {
 			eopts = append(eopts, WithStableDiffusionCppControlNet(&ce))
 		}
 
+		if len(adapterGfs) > 0 {
+			eopts = append(eopts, WithStableDiffusionCppLoRAs(adapterGfs))
+			switch sdcLoRAApplyMode {
+			case "auto":
+				eopts = append(eopts, WithStableDiffusionCppLoRAApplyMode(StableDiffusionCppLoRAApplyModeAuto))
+			case "merge", "immediately":
+				eopts = append(eopts, WithStableDiffusionCppLoRAApplyMode(StableDiffusionCppLoRAApplyModeMerge))
+			case "runtime", "at_runtime":
+				eopts = append(eopts, WithStableDiffusionCppLoRAApplyMode(StableDiffusionCppLoRAApplyModeRuntime))
+			default:
+				return errors.New("--image-lora-apply-mode must be one of [auto, merge, runtime]")
+			}
+		}
+
 		sde = gf.EstimateStableDiffusionCppRun(eopts...)
 	}
 
@@ -1667,13 +1968,17 @@ func mainAction(c *cli.Context) error {
 		}
 	}
 
-	if inJson {
+	if inJson || outputFormat == "yaml" {
 		o := map[string]any{}
 
 		if !skipMetadata {
 			o["metadata"] = m
 		}
 
+		if quantReport {
+			o["quantizationReport"] = gf.QuantizationReport()
+		}
+
 		if !skipArchitecture {
 			o["architecture"] = a
 		}
@@ -1711,6 +2016,9 @@ func mainAction(c *cli.Context) error {
 				lmes.Items = esis
 			}
 			o["estimate"] = lmes
+			if lpe != nil {
+				o["maximumParallel"] = lpe
+			}
 		}
 
 		if !skipEstimate && m.Architecture == "diffusion" {
@@ -1718,6 +2026,13 @@ func mainAction(c *cli.Context) error {
 			o["estimate"] = sdes
 		}
 
+		if outputFormat == "yaml" {
+			if err := yprint(o); err != nil {
+				return fmt.Errorf("failed to encode YAML: %w", err)
+			}
+			return nil
+		}
+
 		enc := json.NewEncoder(os.Stdout)
 		if inPrettyJson {
 			enc.SetIndent("", "  ")
@@ -1760,6 +2075,41 @@ func mainAction(c *cli.Context) error {
 			})
 	}
 
+	if quantReport {
+		qr := gf.QuantizationReport()
+		bds := make([][]any, 0, len(qr.Groups))
+		for _, g := range qr.Groups {
+			tps := make([]string, 0, len(g.Types))
+			for _, tp := range g.Types {
+				tps = append(tps, fmt.Sprintf("%s x%d", tp.Type, tp.Count))
+			}
+			bds = append(bds, []any{
+				g.Role,
+				sprintf(g.Count),
+				strings.Join(tps, ", "),
+				sprintf(g.Bytes),
+				sprintf(g.Parameters),
+				sprintf(g.BitsPerWeight),
+			})
+		}
+		tprint(
+			"Quantization Report",
+			[][]any{
+				{
+					"Role",
+					"Tensors",
+					"Types",
+					"Size",
+					"Parameters",
+					"BPW",
+				},
+			},
+			bds)
+		for _, w := range qr.Warnings {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: quantization: %s\n", w)
+		}
+	}
+
 	if !skipArchitecture {
 		var (
 			hds [][]any
@@ -2071,6 +2421,33 @@ func mainAction(c *cli.Context) error {
 			"ESTIMATE",
 			hds,
 			bds)
+
+		if lpe != nil {
+			hds := [][]any{
+				{
+					"Slot Context",
+					"Max Parallel",
+				},
+			}
+			bds := [][]any{
+				{
+					sprintf(lpe.SlotContextSize),
+					sprintf(lpe.ParallelSize),
+				},
+			}
+			for _, v := range lpe.Item.VRAMs {
+				if v.Remote {
+					hds[0] = append(hds[0], fmt.Sprintf("RPC %d (V)RAM", v.Position))
+				} else {
+					hds[0] = append(hds[0], fmt.Sprintf("VRAM %d", v.Position))
+				}
+				bds[0] = append(bds[0], sprintf(v.NonUMA))
+			}
+			tprint(
+				"MAXIMUM PARALLEL",
+				hds,
+				bds)
+		}
 	}
 
 	if !skipEstimate && m.Architecture == "diffusion" {
@@ -2146,6 +2523,18 @@ func sprintf(f any, a ...any) string {
 }
 
 func tprint(title string, headers, bodies [][]any) {
+	switch outputFormat {
+	case "csv":
+		cprint(title, headers, bodies, ',')
+		return
+	case "tsv":
+		cprint(title, headers, bodies, '\t')
+		return
+	case "markdown":
+		mprint(title, headers, bodies)
+		return
+	}
+
 	tw := table.NewWriter()
 	tw.SetOutputMirror(os.Stdout)
 	tw.SetTitle(strings.ToUpper(title))
@@ -2173,6 +2562,117 @@ func tprint(title string, headers, bodies [][]any) {
 	fmt.Println()
 }
 
+// cprint prints the given table as delimiter-separated values,
+// the first column is the section name,
+// and the rest columns are named by the flattened headers.
+func cprint(title string, headers, bodies [][]any, comma rune) {
+	cw := csv.NewWriter(os.Stdout)
+	cw.Comma = comma
+
+	hds := []string{"section"}
+	for _, hd := range cheaders(headers) {
+		hds = append(hds, ckey(hd))
+	}
+	_ = cw.Write(hds)
+
+	sec := ckey(title)
+	for i := range bodies {
+		r := make([]string, 0, len(bodies[i])+1)
+		r = append(r, sec)
+		for j := range bodies[i] {
+			r = append(r, sprintf(bodies[i][j]))
+		}
+		_ = cw.Write(r)
+	}
+	cw.Flush()
+	fmt.Println()
+}
+
+// mprint prints the given table as GitHub Flavored Markdown,
+// the columns are named by the flattened headers.
+func mprint(title string, headers, bodies [][]any) {
+	esc := strings.NewReplacer("|", "\\|", "\n", " ")
+
+	var sb strings.Builder
+	sb.WriteString("### " + strings.ToUpper(title) + "\n\n")
+	hds := cheaders(headers)
+	for i := range hds {
+		sb.WriteString("| " + esc.Replace(hds[i]) + " ")
+	}
+	sb.WriteString("|\n")
+	for range hds {
+		sb.WriteString("| --- ")
+	}
+	sb.WriteString("|\n")
+	for i := range bodies {
+		for j := range bodies[i] {
+			sb.WriteString("| " + esc.Replace(sprintf(bodies[i][j])) + " ")
+		}
+		sb.WriteString("|\n")
+	}
+	fmt.Println(sb.String())
+}
+
+// cheaders flattens the multi-row headers into one row,
+// joins the distinct header names of each column with space.
+func cheaders(headers [][]any) []string {
+	if len(headers) == 0 {
+		return nil
+	}
+	r := make([]string, len(headers[0]))
+	for i := range r {
+		ps := make([]string, 0, len(headers))
+		for j := range headers {
+			if i >= len(headers[j]) {
+				continue
+			}
+			p := sprintf(headers[j][i])
+			if p == "" || (len(ps) != 0 && ps[len(ps)-1] == p) {
+				continue
+			}
+			ps = append(ps, p)
+		}
+		r[i] = strings.Join(ps, " ")
+	}
+	return r
+}
+
+var ckeyRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ckey returns the stable column key of the given header name,
+// e.g. "VRAM 0 Layers (T + O)" to "vram_0_layers_t_o".
+func ckey(s string) string {
+	return strings.Trim(ckeyRegex.ReplaceAllString(strings.ToLower(s), "_"), "_")
+}
+
+// yprint prints the given object as YAML,
+// keeps the same keys and order as the JSON output.
+func yprint(o any) error {
+	bs, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	var n yaml.Node
+	if err = yaml.Unmarshal(bs, &n); err != nil {
+		return err
+	}
+	var unstyle func(n *yaml.Node)
+	unstyle = func(n *yaml.Node) {
+		n.Style = 0
+		for i := range n.Content {
+			unstyle(n.Content[i])
+		}
+	}
+	unstyle(&n)
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err = enc.Encode(&n); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
 func tenary(c bool, t, f any) any {
 	if c {
 		return t
@@ -2187,25 +2687,36 @@ func tenaryFunc(c bool, t, f func() any) any {
 	return f()
 }
 
-func toGGMLType(s string) GGMLType {
-	t := GGMLTypeF16
+func toGGUFFileType(s string) (GGUFFileType, bool) {
+	s = strings.TrimPrefix(strings.ToUpper(s), "MOSTLY_")
+	for ft := GGUFFileTypeMostlyF32; ft <= GGUFFileTypeMostlyMXFP4; ft++ {
+		if strings.TrimPrefix(ft.String(), "MOSTLY_") == s {
+			return ft, true
+		}
+	}
+	return 0, false
+}
+
+func toGGMLType(s string) (GGMLType, bool) {
 	switch s {
 	case "f32":
-		t = GGMLTypeF32
+		return GGMLTypeF32, true
 	case "f16":
-		t = GGMLTypeF16
+		return GGMLTypeF16, true
+	case "bf16":
+		return GGMLTypeBF16, true
 	case "q8_0":
-		t = GGMLTypeQ8_0
+		return GGMLTypeQ8_0, true
 	case "q4_0":
-		t = GGMLTypeQ4_0
+		return GGMLTypeQ4_0, true
 	case "q4_1":
-		t = GGMLTypeQ4_1
+		return GGMLTypeQ4_1, true
 	case "iq4_nl":
-		t = GGMLTypeIQ4_NL
+		return GGMLTypeIQ4_NL, true
 	case "q5_0":
-		t = GGMLTypeQ5_0
+		return GGMLTypeQ5_0, true
 	case "q5_1":
-		t = GGMLTypeQ5_1
+		return GGMLTypeQ5_1, true
 	}
-	return t
+	return GGMLTypeF16, false
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	. "github.com/gpustack/gguf-parser-go" // nolint: stylecheck
+)
+
+func splitCommand(name string) *cli.Command {
+	var (
+		maxSize    string
+		maxTensors uint64 = 128
+	)
+	return &cli.Command{
+		Name:      "split",
+		Usage:     "Split a GGUF file into shards, compatible with llama.cpp's gguf-split.",
+		UsageText: name + " split [OPTIONS] GGUF_IN GGUF_OUT_PREFIX",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Destination: &maxSize,
+				Value:       maxSize,
+				Name:        "max-size",
+				Aliases: []string{ // GGUFSplit compatibility
+					"split-max-size",
+				},
+				Usage: "Specify the maximum size of each shard, e.g. \"4G\", \"500M\", " +
+					"it takes precedence over \"--max-tensors\".",
+			},
+			&cli.Uint64Flag{
+				Destination: &maxTensors,
+				Value:       maxTensors,
+				Name:        "max-tensors",
+				Aliases: []string{ // GGUFSplit compatibility
+					"split-max-tensors",
+				},
+				Usage: "Specify the maximum number of tensors of each shard.",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				return errors.New("split requires GGUF_IN and GGUF_OUT_PREFIX")
+			}
+
+			sopts := []GGUFSplitOption{
+				WithSplitMaxTensors(maxTensors),
+			}
+			if maxSize != "" {
+				sz, err := ParseGGUFBytesScalar(maxSize)
+				if err != nil {
+					return fmt.Errorf("--max-size has invalid size: %w", err)
+				}
+				sopts = append(sopts, WithSplitMaxSize(uint64(sz)))
+			}
+
+			paths, err := SplitGGUFFile(c.Args().Get(0), c.Args().Get(1), sopts...)
+			if err != nil {
+				return fmt.Errorf("failed to split GGUF file: %w", err)
+			}
+			for i := range paths {
+				fmt.Println(paths[i])
+			}
+			return nil
+		},
+	}
+}
+
+func mergeCommand(name string) *cli.Command {
+	return &cli.Command{
+		Name:      "merge",
+		Usage:     "Merge the shards of a split GGUF file, compatible with llama.cpp's gguf-split.",
+		UsageText: name + " merge GGUF_SHARD_IN GGUF_OUT",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				return errors.New("merge requires GGUF_SHARD_IN and GGUF_OUT")
+			}
+
+			if err := MergeGGUFFile(c.Args().Get(0), c.Args().Get(1)); err != nil {
+				return fmt.Errorf("failed to merge GGUF file: %w", err)
+			}
+			fmt.Println(c.Args().Get(1))
+			return nil
+		},
+	}
+}
@@ -2,6 +2,7 @@ package gguf_parser
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"math"
 	"math/bits"
 	"regexp"
+	"slices"
 	"strings"
 
 	"golang.org/x/exp/constraints"
@@ -208,7 +210,32 @@ type (
 	GGUFTensorInfos []GGUFTensorInfo
 )
 
-var ErrGGUFFileInvalidFormat = errors.New("invalid GGUF format")
+var (
+	ErrGGUFFileInvalidFormat   = errors.New("invalid GGUF format")
+	ErrGGUFFileShardMismatched = errors.New("GGUF file shard mismatched")
+)
+
+// GGUFFileShardError is the error of a shard of a split GGUF file,
+// which names the bad shard.
+type GGUFFileShardError struct {
+	// Index is the index of the shard, starts from 0.
+	Index int
+	// Total is the total number of the shards.
+	Total int
+	// Name is the path or URL of the shard.
+	Name string
+	// Err is the underlying error,
+	// wraps ErrGGUFFileShardMismatched if the shard is inconsistent with the others.
+	Err error
+}
+
+func (e *GGUFFileShardError) Error() string {
+	return fmt.Sprintf("shard %d/%d %q: %v", e.Index+1, e.Total, e.Name, e.Err)
+}
+
+func (e *GGUFFileShardError) Unwrap() error {
+	return e.Err
+}
 
 // GGMLMaxDims is the maximum number of tensor dimensions supported by GGML,
 // mirroring GGML_MAX_DIMS in ggml.h. A NDimensions value above this bound
@@ -286,6 +313,7 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 			}
 
 			fs = append(fs, _GGUFFileReadSeeker{
+				Name:       paths[i],
 				Closer:     mf,
 				ReadSeeker: io.NewSectionReader(mf, 0, mf.Len()),
 				Size:       mf.Len(),
@@ -300,6 +328,7 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 		}
 
 		fs = append(fs, _GGUFFileReadSeeker{
+			Name:       paths[i],
 			Closer:     ff,
 			ReadSeeker: ff,
 			Size:       funcx.MustNoError(ff.Stat()).Size(),
@@ -310,6 +339,7 @@ func ParseGGUFFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
 }
 
 type _GGUFFileReadSeeker struct {
+	Name string
 	io.Closer
 	io.ReadSeeker
 	Size int64
@@ -355,88 +385,156 @@ func _validateCountWithRemaining(f _GGUFFileReadSeeker, count uint64, version GG
 	return nil
 }
 
-func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, err error) {
-	var gf GGUFFile
+func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (*GGUFFile, error) {
+	ss := make([]*_GGUFFileShard, len(fs))
+	for i := range fs {
+		s, err := parseGGUFFileShard(fs[i], o)
+		if err != nil {
+			if len(fs) > 1 {
+				err = &GGUFFileShardError{Index: i, Total: len(fs), Name: fs[i].Name, Err: err}
+			}
+			return nil, err
+		}
+		ss[i] = s
+	}
 
-	for _, f := range fs {
-		var bo binary.ByteOrder = binary.LittleEndian
+	return mergeGGUFFileShards(ss)
+}
 
-		// magic
-		var magic GGUFMagic
-		if err = binary.Read(f, bo, &magic); err != nil {
-			return nil, fmt.Errorf("read magic: %w", err)
-		}
-		switch magic {
-		default:
-			return nil, ErrGGUFFileInvalidFormat
-		case GGUFMagicGGML, GGUFMagicGGMF, GGUFMagicGGJT:
-			return nil, fmt.Errorf("unsupported format: %s", magic)
-		case GGUFMagicGGUFLe:
-		case GGUFMagicGGUFBe:
-			bo = binary.BigEndian
-		}
-		gf.Header.Magic = magic
+// _GGUFFileShard holds the header and tensor infos of a single GGUF file,
+// which may be a shard of a split GGUF file.
+type _GGUFFileShard struct {
+	Name                 string
+	Magic                GGUFMagic
+	Version              GGUFVersion
+	TensorCount          uint64
+	MetadataKV           GGUFMetadataKVs
+	TensorInfos          GGUFTensorInfos
+	TensorInfosEndOffset int64
+	Size                 int64
+}
 
-		// version
-		var version GGUFVersion
-		if err = binary.Read(f, bo, &version); err != nil {
-			return nil, fmt.Errorf("read version: %w", err)
-		}
-		if version > GGUFVersionV3 {
-			return nil, fmt.Errorf("unsupported GGUF version: %d (supported: %d-%d)",
-				version, GGUFVersionV1, GGUFVersionV3)
-		}
-		gf.Header.Version = version
+// parseGGUFFileShard reads the header and tensor infos of a single GGUF file,
+// it is safe to call concurrently with different readers.
+func parseGGUFFileShard(f _GGUFFileReadSeeker, o _GGUFReadOptions) (_ *_GGUFFileShard, err error) {
+	s := _GGUFFileShard{Name: f.Name}
 
-		rd := _GGUFReader{v: version, o: o, f: f, bo: bo}
+	var bo binary.ByteOrder = binary.LittleEndian
 
-		// tensor count
-		var tensorCount uint64
-		if version <= GGUFVersionV1 {
-			tensorCount, err = rd.ReadUint64FromUint32()
-		} else {
-			tensorCount, err = rd.ReadUint64()
-		}
-		if err != nil {
-			return nil, fmt.Errorf("read tensor count: %w", err)
-		}
-		if err := _validateCountWithRemaining(f, tensorCount, version, "tensor"); err != nil {
-			return nil, err
-		}
-		gf.Header.TensorCount += tensorCount
+	// magic
+	var magic GGUFMagic
+	if err = binary.Read(f, bo, &magic); err != nil {
+		return nil, fmt.Errorf("read magic: %w", err)
+	}
+	switch magic {
+	default:
+		return nil, ErrGGUFFileInvalidFormat
+	case GGUFMagicGGML, GGUFMagicGGMF, GGUFMagicGGJT:
+		return nil, fmt.Errorf("unsupported format: %s", magic)
+	case GGUFMagicGGUFLe:
+	case GGUFMagicGGUFBe:
+		bo = binary.BigEndian
+	}
+	s.Magic = magic
 
-		// metadata kv count
-		var metadataKVCount uint64
-		if version <= GGUFVersionV1 {
-			metadataKVCount, err = rd.ReadUint64FromUint32()
-		} else {
-			metadataKVCount, err = rd.ReadUint64()
-		}
-		if err != nil {
-			return nil, fmt.Errorf("read metadata kv count: %w", err)
+	// version
+	var version GGUFVersion
+	if err = binary.Read(f, bo, &version); err != nil {
+		return nil, fmt.Errorf("read version: %w", err)
+	}
+	if version > GGUFVersionV3 {
+		return nil, fmt.Errorf("unsupported GGUF version: %d (supported: %d-%d)",
+			version, GGUFVersionV1, GGUFVersionV3)
+	}
+	s.Version = version
+
+	rd := _GGUFReader{v: version, o: o, f: f, bo: bo}
+
+	// tensor count
+	var tensorCount uint64
+	if version <= GGUFVersionV1 {
+		tensorCount, err = rd.ReadUint64FromUint32()
+	} else {
+		tensorCount, err = rd.ReadUint64()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tensor count: %w", err)
+	}
+	if err := _validateCountWithRemaining(f, tensorCount, version, "tensor"); err != nil {
+		return nil, err
+	}
+	s.TensorCount = tensorCount
+
+	// metadata kv count
+	var metadataKVCount uint64
+	if version <= GGUFVersionV1 {
+		metadataKVCount, err = rd.ReadUint64FromUint32()
+	} else {
+		metadataKVCount, err = rd.ReadUint64()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metadata kv count: %w", err)
+	}
+	if err := _validateCountWithRemaining(f, metadataKVCount, version, "metadatakvcount"); err != nil {
+		return nil, err
+	}
+
+	// metadata kv
+	{
+		rd := _GGUFMetadataReader{_GGUFReader: rd}
+		s.MetadataKV = make(GGUFMetadataKVs, metadataKVCount)
+		for i := uint64(0); i < metadataKVCount; i++ {
+			s.MetadataKV[i], err = rd.Read()
+			if err != nil {
+				return nil, fmt.Errorf("read metadata kv %d: %w", i, err)
+			}
 		}
-		if err := _validateCountWithRemaining(f, metadataKVCount, version, "metadatakvcount"); err != nil {
-			return nil, err
+	}
+
+	// tensor infos
+	{
+		rd := _GGUFTensorInfoReader{_GGUFReader: rd}
+		// avoid preallocating with tensorCount (could be huge); start empty and append
+		s.TensorInfos = make(GGUFTensorInfos, 0)
+		for i := uint64(0); i < tensorCount; i++ {
+			ti, err := rd.Read()
+			if err != nil {
+				return nil, fmt.Errorf("read tensor info %d: %w", i, err)
+			}
+			s.TensorInfos = append(s.TensorInfos, ti)
 		}
-		gf.Header.MetadataKVCount += metadataKVCount
+	}
+
+	s.TensorInfosEndOffset, err = f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("seek padding start: %w", err)
+	}
+
+	s.Size = f.Size
+
+	return &s, nil
+}
+
+// mergeGGUFFileShards merges the given shards into a GGUFFile in order.
+func mergeGGUFFileShards(ss []*_GGUFFileShard) (*GGUFFile, error) {
+	if err := validateGGUFFileShards(ss); err != nil {
+		return nil, err
+	}
+
+	var gf GGUFFile
+
+	for _, s := range ss {
+		gf.Header.Magic = s.Magic
+		gf.Header.Version = s.Version
+		gf.Header.TensorCount += s.TensorCount
 
 		// metadata kv
-		{
-			rd := _GGUFMetadataReader{_GGUFReader: rd}
-			kvs := make(GGUFMetadataKVs, metadataKVCount)
-			for i := uint64(0); i < metadataKVCount; i++ {
-				kvs[i], err = rd.Read()
-				if err != nil {
-					return nil, fmt.Errorf("read metadata kv %d: %w", i, err)
-				}
-			}
-			for i := range kvs {
-				if kvs[i].Key == "split.no" {
-					gf.Header.MetadataKVCount--
-					continue
-				}
-				gf.Header.MetadataKV = append(gf.Header.MetadataKV, kvs[i])
+		for i := range s.MetadataKV {
+			if s.MetadataKV[i].Key == "split.no" {
+				continue
 			}
+			gf.Header.MetadataKV = append(gf.Header.MetadataKV, s.MetadataKV[i])
+			gf.Header.MetadataKVCount++
 		}
 
 		// tensor infos
@@ -445,27 +543,12 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 			if ok {
 				gf.TensorInfos = make(GGUFTensorInfos, 0, anyx.Number[int](tc.Value))
 			} else {
-				// avoid preallocating with tensorCount (could be huge); start empty and append
-				gf.TensorInfos = make(GGUFTensorInfos, 0)
+				gf.TensorInfos = make(GGUFTensorInfos, 0, len(s.TensorInfos))
 			}
 		}
-		{
-			rd := _GGUFTensorInfoReader{_GGUFReader: rd}
-			tis := make(GGUFTensorInfos, 0)
-			for i := uint64(0); i < tensorCount; i++ {
-				ti, err := rd.Read()
-				if err != nil {
-					return nil, fmt.Errorf("read tensor info %d: %w", i, err)
-				}
-				tis = append(tis, ti)
-			}
-			gf.TensorInfos = append(gf.TensorInfos, tis...)
-		}
+		gf.TensorInfos = append(gf.TensorInfos, s.TensorInfos...)
 
-		pds, err := f.Seek(0, io.SeekCurrent)
-		if err != nil {
-			return nil, fmt.Errorf("seek padding start: %w", err)
-		}
+		pds := s.TensorInfosEndOffset
 
 		// padding
 		var padding int64
@@ -480,25 +563,25 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 			}
 			padding = int64(ag) - (pds % int64(ag))
 		}
-		if len(fs) == 1 {
+		if len(ss) == 1 {
 			gf.Padding = padding
 		}
 		gf.SplitPaddings = append(gf.SplitPaddings, padding)
 
 		// tensor data offset
 		tensorDataStartOffset := pds + padding
-		if len(fs) == 1 {
+		if len(ss) == 1 {
 			gf.TensorDataStartOffset = tensorDataStartOffset
 		}
 		gf.SplitTensorDataStartOffsets = append(gf.SplitTensorDataStartOffsets, tensorDataStartOffset)
 
 		// size
-		size := GGUFBytesScalar(f.Size)
+		size := GGUFBytesScalar(s.Size)
 		gf.Size += size
 		gf.SplitSizes = append(gf.SplitSizes, size)
 
 		// model size
-		modelSize := GGUFBytesScalar(f.Size - tensorDataStartOffset)
+		modelSize := GGUFBytesScalar(s.Size - tensorDataStartOffset)
 		gf.ModelSize += modelSize
 		gf.SplitModelSizes = append(gf.SplitModelSizes, modelSize)
 	}
@@ -514,6 +597,144 @@ func parseGGUFFile(fs []_GGUFFileReadSeeker, o _GGUFReadOptions) (_ *GGUFFile, e
 	return &gf, nil
 }
 
+// validateGGUFFileShards checks the given shards belong to the same split GGUF file,
+// and returns a GGUFFileShardError naming the first bad shard if any.
+func validateGGUFFileShards(ss []*_GGUFFileShard) error {
+	if len(ss) <= 1 {
+		return nil
+	}
+
+	shardErr := func(i int, format string, args ...any) error {
+		return &GGUFFileShardError{
+			Index: i,
+			Total: len(ss),
+			Name:  ss[i].Name,
+			Err:   fmt.Errorf("%w: "+format, append([]any{ErrGGUFFileShardMismatched}, args...)...),
+		}
+	}
+
+	// NB(thxCode): gguf-split writes the full metadata into the first shard only,
+	// so a shard carrying the split keys only is checked by the tensor data layout below,
+	// otherwise, the shard must declare the same model identifying keys as the first shard,
+	// and a key missing on one side is a mismatch as well.
+	// The general.uuid is the hash of the tensor data, e.g. generated by llama-gguf-hash.
+	identityKeys := []string{
+		"general.architecture",
+		"general.uuid",
+		"general.file_type",
+	}
+	identities, _ := ss[0].MetadataKV.Index(identityKeys)
+
+	var alignment uint64 = 32
+	if v, ok := ss[0].MetadataKV.Get("general.alignment"); ok {
+		alignment = uint64(v.ValueUint32())
+	}
+
+	var (
+		tensorsCount = -1
+		tensorsTotal int
+		tensorNames  = make(map[string]int)
+	)
+	for i, s := range ss {
+		kvs, _ := s.MetadataKV.Index([]string{
+			"split.no",
+			"split.count",
+			"split.tensors.count",
+		})
+
+		if v, ok := kvs["split.no"]; !ok {
+			return shardErr(i, "missing split.no")
+		} else if n := anyx.Number[int](v.Value); n != i {
+			return shardErr(i, "split.no is %d, but expected %d", n, i)
+		}
+		if v, ok := kvs["split.count"]; !ok {
+			return shardErr(i, "missing split.count")
+		} else if n := anyx.Number[int](v.Value); n != len(ss) {
+			return shardErr(i, "split.count is %d, but got %d shards", n, len(ss))
+		}
+		if v, ok := kvs["split.tensors.count"]; ok {
+			n := anyx.Number[int](v.Value)
+			if tensorsCount >= 0 && n != tensorsCount {
+				return shardErr(i, "split.tensors.count is %d, but previous shards declare %d", n, tensorsCount)
+			}
+			tensorsCount = n
+		}
+
+		if i > 0 && slices.ContainsFunc(s.MetadataKV, func(kv GGUFMetadataKV) bool {
+			return !strings.HasPrefix(kv.Key, "split.")
+		}) {
+			ids, _ := s.MetadataKV.Index(identityKeys)
+			for _, k := range identityKeys {
+				v, ok := ids[k]
+				fv, fok := identities[k]
+				switch {
+				case !ok && !fok:
+					continue
+				case !ok:
+					return shardErr(i, "missing %s, but the first shard is %v", k, fv.Value)
+				case !fok:
+					return shardErr(i, "%s is %v, but missing in the first shard", k, v.Value)
+				}
+				if v.ValueType != fv.ValueType || fmt.Sprint(v.Value) != fmt.Sprint(fv.Value) {
+					return shardErr(i, "%s is %v, but the first shard is %v", k, v.Value, fv.Value)
+				}
+			}
+		}
+
+		for _, ti := range s.TensorInfos {
+			if j, ok := tensorNames[ti.Name]; ok {
+				return shardErr(i, "duplicate tensor %q, which is also in shard %d", ti.Name, j+1)
+			}
+			tensorNames[ti.Name] = i
+		}
+		tensorsTotal += len(s.TensorInfos)
+
+		if err := validateGGUFFileShardTensorData(s, alignment); err != nil {
+			return shardErr(i, "%v", err)
+		}
+	}
+
+	if tensorsCount >= 0 && tensorsTotal != tensorsCount {
+		return shardErr(len(ss)-1, "split.tensors.count is %d, but got %d tensors", tensorsCount, tensorsTotal)
+	}
+
+	return nil
+}
+
+// validateGGUFFileShardTensorData checks the tensor data of the given shard is continuous,
+// the tensors must be laid out one by one from the start of the tensor data with the given alignment,
+// and fill the rest of the shard.
+func validateGGUFFileShardTensorData(s *_GGUFFileShard, alignment uint64) error {
+	if s.Size <= 0 || alignment == 0 {
+		return nil
+	}
+
+	dataStart := GGMLPadding(uint64(s.TensorInfosEndOffset), alignment)
+	if uint64(s.Size) < dataStart {
+		return fmt.Errorf("size is %d, but tensor data starts at %d", s.Size, dataStart)
+	}
+	dataSize := uint64(s.Size) - dataStart
+
+	tis := slices.Clone(s.TensorInfos)
+	slices.SortStableFunc(tis, func(a, b GGUFTensorInfo) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	var end uint64
+	for _, ti := range tis {
+		if ti.Offset != GGMLPadding(end, alignment) {
+			return fmt.Errorf("tensor %q starts at %d, but expected %d", ti.Name, ti.Offset, GGMLPadding(end, alignment))
+		}
+		end = ti.Offset + ti.Bytes()
+	}
+	if end > dataSize {
+		return fmt.Errorf("tensor data ends at %d, but only %d bytes", end, dataSize)
+	}
+	if dataSize-end >= alignment {
+		return fmt.Errorf("tensor data ends at %d, but %d bytes", end, dataSize)
+	}
+	return nil
+}
+
 // Types for GGUF hierarchical tensors.
 type (
 	// GGUFTensorInfoFilter is a filter to filter out if the given tensor name matches.
@@ -1638,7 +1859,7 @@ func (rd _GGUFReader) ReadArray(key string) (v GGUFMetadataKVArrayValue, err err
 		return v, fmt.Errorf("seek array item start: %w", err)
 	}
 
-	if !rd.o.SkipLargeMetadata || stringx.HasSuffixes(key, ".feed_forward_length", ".attention.head_count") {
+	if !rd.o.SkipLargeMetadata || stringx.HasSuffixes(key, ".feed_forward_length", ".attention.head_count", ".attention.head_count_kv", ".attention.sliding_window_pattern", "imatrix.datasets", ".image_grid_pinpoints") {
 		v.Array = make([]any, v.Len)
 		for i := uint64(0); i < v.Len; i++ {
 			v.Array[i], err = rd.ReadValue(key, v.Type)
@@ -0,0 +1,159 @@
+package gguf_parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GGUFAdapterMismatch represents a mismatch between an adapter and its base model.
+type GGUFAdapterMismatch struct {
+	// Rule is the name of the violated rule, e.g. "lora-shape".
+	Rule string `json:"rule"`
+	// Tensor is the name of the adapter tensor,
+	// empty if the mismatch is not about a tensor.
+	Tensor string `json:"tensor,omitempty"`
+	// Message describes the mismatch.
+	Message string `json:"message"`
+}
+
+func (m GGUFAdapterMismatch) String() string {
+	if m.Tensor == "" {
+		return fmt.Sprintf("[%s] %s", m.Rule, m.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", m.Rule, m.Tensor, m.Message)
+}
+
+// _GGUFControlVectorDirectionRegex matches the direction tensor of a control vector,
+// e.g. "direction.1".
+var _GGUFControlVectorDirectionRegex = regexp.MustCompile(`^direction\.(\d+)$`)
+
+// CheckAdapterCompatibility checks whether the given adapter can be applied to the given base model,
+// and returns the mismatches, or nil if compatible.
+//
+// For LoRA adapters, every "<name>.lora_a" and "<name>.lora_b" pair must map to a base tensor "<name>",
+// with A in [n_in, rank] and B in [rank, n_out],
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-adapter.cpp, llama_adapter_lora_init_impl.
+//
+// For control vectors, every "direction.<layer>" tensor must be in [n_embd] of the base model,
+// and the layer must be within the base model,
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-adapter.cpp, llama_adapter_cvec::apply.
+func CheckAdapterCompatibility(base, adapter *GGUFFile) (ms []GGUFAdapterMismatch) {
+	add := func(rule, tensor, format string, args ...any) {
+		ms = append(ms, GGUFAdapterMismatch{Rule: rule, Tensor: tensor, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if bm := base.Metadata(); bm.Type != "model" {
+		add("base-type", "", "base type %q is not a model", bm.Type)
+		return ms
+	}
+
+	ba, aa := base.Architecture(), adapter.Architecture()
+
+	m, _ := adapter.Header.MetadataKV.Index([]string{
+		"general.architecture",
+		"controlvector.model_hint",
+	})
+	isControlVector := aa.AdapterType == "control_vector"
+	if v, ok := m["general.architecture"]; ok && v.ValueString() == "controlvector" {
+		isControlVector = true
+		// The architecture of the control vector is only a hint.
+		if _, ok = m["controlvector.model_hint"]; !ok {
+			aa.Architecture = ba.Architecture
+		}
+	}
+	if am := adapter.Metadata(); !isControlVector && am.Type != "adapter" {
+		add("adapter-type", "", "adapter type %q is not an adapter", am.Type)
+		return ms
+	}
+	if aa.Architecture != ba.Architecture {
+		add("architecture", "", "adapter architecture %q mismatches base architecture %q", aa.Architecture, ba.Architecture)
+	}
+
+	// Control vector.
+	if isControlVector {
+		if lc := uint64(aa.AdapterControlVectorLayerCount); lc > ba.BlockCount {
+			add("control-vector-layer-count", "", "layer count %d exceeds base block count %d", lc, ba.BlockCount)
+		}
+		for _, ti := range adapter.TensorInfos {
+			sm := _GGUFControlVectorDirectionRegex.FindStringSubmatch(ti.Name)
+			if sm == nil {
+				continue
+			}
+			if ti.Dimensions[0] != ba.EmbeddingLength {
+				add("control-vector-embedding-length", ti.Name,
+					"embedding length %d mismatches base embedding length %d", ti.Dimensions[0], ba.EmbeddingLength)
+			}
+			// The direction of layer 0 is never applied.
+			if il, _ := strconv.ParseUint(sm[1], 10, 64); il == 0 || il >= ba.BlockCount {
+				add("control-vector-layer-index", ti.Name, "layer %d is out of base layers [1, %d)", il, ba.BlockCount)
+			}
+		}
+		return ms
+	}
+
+	// LoRA.
+	if aa.AdapterType != "lora" {
+		add("adapter-type", "", "unsupported adapter type %q", aa.AdapterType)
+		return ms
+	}
+	type pair struct {
+		a, b *GGUFTensorInfo
+	}
+	var (
+		ns []string
+		ps = make(map[string]*pair)
+	)
+	for i := range adapter.TensorInfos {
+		ti := &adapter.TensorInfos[i]
+		var n string
+		switch {
+		case strings.HasSuffix(ti.Name, ".lora_a"):
+			n = strings.TrimSuffix(ti.Name, ".lora_a")
+		case strings.HasSuffix(ti.Name, ".lora_b"):
+			n = strings.TrimSuffix(ti.Name, ".lora_b")
+		default:
+			continue
+		}
+		p, ok := ps[n]
+		if !ok {
+			p = &pair{}
+			ps[n] = p
+			ns = append(ns, n)
+		}
+		if strings.HasSuffix(ti.Name, ".lora_a") {
+			p.a = ti
+		} else {
+			p.b = ti
+		}
+	}
+	for _, n := range ns {
+		p := ps[n]
+		if p.a == nil || p.b == nil {
+			add("lora-incomplete", n, "LoRA tensor pair is missing one component")
+			continue
+		}
+		bt, ok := base.TensorInfos.Get(n)
+		if !ok {
+			add("lora-missing-base-tensor", n, "LoRA tensor does not exist in base model")
+			continue
+		}
+		if p.a.NDimensions < 2 || p.b.NDimensions < 2 || bt.NDimensions < 2 {
+			add("lora-shape", n, "LoRA tensor pair or base tensor is not a matrix")
+			continue
+		}
+		if p.a.Dimensions[0] != bt.Dimensions[0] || p.b.Dimensions[1] != bt.Dimensions[1] {
+			add("lora-shape", n, "LoRA A %v and B %v mismatch base %v",
+				p.a.Dimensions, p.b.Dimensions, bt.Dimensions)
+			continue
+		}
+		if r := p.a.Dimensions[1]; r != p.b.Dimensions[0] {
+			add("lora-rank", n, "LoRA A rank %d mismatches B rank %d", r, p.b.Dimensions[0])
+		} else if r > min(bt.Dimensions[0], bt.Dimensions[1]) {
+			add("lora-rank", n, "LoRA rank %d exceeds base dimensions %v", r, bt.Dimensions)
+		}
+	}
+
+	return ms
+}
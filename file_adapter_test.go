@@ -0,0 +1,113 @@
+package gguf_parser
+
+import (
+	"testing"
+)
+
+func TestCheckAdapterCompatibility(t *testing.T) {
+	base := testQuantizeGGUFFile(4)
+
+	adapter := func(kvs GGUFMetadataKVs, tis ...GGUFTensorInfo) *GGUFFile {
+		gf := &GGUFFile{}
+		gf.Header.MetadataKV = kvs
+		gf.TensorInfos = tis
+		gf.Header.TensorCount = uint64(len(tis))
+		return gf
+	}
+	tensor := func(n string, dims ...uint64) GGUFTensorInfo {
+		return GGUFTensorInfo{Name: n, NDimensions: uint32(len(dims)), Dimensions: dims, Type: GGMLTypeF32}
+	}
+	rules := func(ms []GGUFAdapterMismatch) map[string]int {
+		rs := map[string]int{}
+		for _, m := range ms {
+			rs[m.Rule]++
+		}
+		return rs
+	}
+
+	t.Run("LoRA", func(t *testing.T) {
+		kvs := GGUFMetadataKVs{
+			{Key: "general.type", ValueType: GGUFMetadataValueTypeString, Value: "adapter"},
+			{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			{Key: "adapter.type", ValueType: GGUFMetadataValueTypeString, Value: "lora"},
+		}
+
+		gf := adapter(kvs,
+			tensor("blk.0.attn_q.weight.lora_a", 512, 8),
+			tensor("blk.0.attn_q.weight.lora_b", 8, 512),
+			tensor("blk.0.ffn_down.weight.lora_a", 1536, 8),
+			tensor("blk.0.ffn_down.weight.lora_b", 8, 512),
+		)
+		if ms := CheckAdapterCompatibility(base, gf); len(ms) != 0 {
+			t.Fatalf("expected no mismatches, got %v", ms)
+		}
+
+		gf = adapter(kvs,
+			tensor("blk.0.attn_q.weight.lora_a", 512, 8),
+			tensor("blk.0.attn_q.weight.lora_b", 8, 1024),
+			tensor("blk.0.attn_k.weight.lora_a", 512, 8),
+			tensor("blk.0.attn_k.weight.lora_b", 16, 128),
+			tensor("blk.0.attn_v.weight.lora_a", 512, 8),
+			tensor("blk.9.attn_q.weight.lora_a", 512, 8),
+			tensor("blk.9.attn_q.weight.lora_b", 8, 512),
+		)
+		expected := map[string]int{
+			"lora-shape":               1,
+			"lora-rank":                1,
+			"lora-incomplete":          1,
+			"lora-missing-base-tensor": 1,
+		}
+		rs := rules(CheckAdapterCompatibility(base, gf))
+		if len(rs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, rs)
+		}
+		for r := range expected {
+			if rs[r] != expected[r] {
+				t.Errorf("expected %d %s mismatch(es), got %v", expected[r], r, rs)
+			}
+		}
+
+		kvs[1].Value = "qwen2"
+		if rs = rules(CheckAdapterCompatibility(base, adapter(kvs))); rs["architecture"] != 1 {
+			t.Errorf("expected architecture mismatch, got %v", rs)
+		}
+	})
+
+	t.Run("ControlVector", func(t *testing.T) {
+		kvs := GGUFMetadataKVs{
+			{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "controlvector"},
+			{Key: "controlvector.model_hint", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			{Key: "controlvector.layer_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(3)},
+		}
+
+		gf := adapter(kvs,
+			tensor("direction.1", 512),
+			tensor("direction.2", 512),
+			tensor("direction.3", 512),
+		)
+		if ms := CheckAdapterCompatibility(base, gf); len(ms) != 0 {
+			t.Fatalf("expected no mismatches, got %v", ms)
+		}
+
+		kvs[2].Value = uint32(8)
+		gf = adapter(kvs,
+			tensor("direction.0", 512),
+			tensor("direction.1", 1024),
+			tensor("direction.4", 512),
+		)
+		expected := map[string]int{
+			"control-vector-layer-count":      1,
+			"control-vector-embedding-length": 1,
+			"control-vector-layer-index":      2,
+		}
+		rs := rules(CheckAdapterCompatibility(base, gf))
+		if len(rs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, rs)
+		}
+		for r := range expected {
+			if rs[r] != expected[r] {
+				t.Errorf("expected %d %s mismatch(es), got %v", expected[r], r, rs)
+			}
+		}
+	})
+}
@@ -51,12 +51,22 @@ type (
 		// If not provided or equal to AttentionHeadCount,
 		// the model does not use Grouped-Query-Attention.
 		AttentionHeadCountKV uint64 `json:"attentionHeadCountKV,omitempty"`
+		// AttentionHeadCountPerLayer(n_head_arr) stores the number of attention heads of each layer.
+		//
+		// Zero means the layer has no attention, e.g. DeciLM.
+		AttentionHeadCountPerLayer []uint64 `json:"attentionHeadCountPerLayer,omitempty"`
+		// AttentionHeadCountKVPerLayer(n_head_kv_arr) stores the number of attention heads per group of each layer.
+		//
+		// Zero means the layer has no KV cache, e.g. the recurrent layers of hybrid models.
+		AttentionHeadCountKVPerLayer []uint64 `json:"attentionHeadCountKVPerLayer,omitempty"`
 		// AttentionSlidingWindowPattern is the pattern used in the sliding window attention.
 		//
 		// 0 means all layers are Sliding Window Attention.
 		// 1 means all layers are none Sliding Window Attention.
 		// N means every Nth layer is none Sliding Window Attention.
 		AttentionSlidingWindowPattern uint32 `json:"attentionSlidingWindowPattern,omitempty"`
+		// AttentionSlidingWindowPerLayer(swa_layers) stores whether each layer is Sliding Window Attention.
+		AttentionSlidingWindowPerLayer []bool `json:"attentionSlidingWindowPerLayer,omitempty"`
 		// AttentionSlidingWindow is the size of the sliding window used in the attention layer.
 		AttentionSlidingWindow uint64 `json:"attentionSlidingWindow,omitempty"`
 		// AttentionMaxALiBIBias is the maximum bias to use for ALiBI.
@@ -222,6 +232,11 @@ type (
 		//
 		// Only used when Architecture is "clip" and ClipHasVisionEncoder is true.
 		ClipVisionPatchSize uint32 `json:"clipVisionPatchSize,omitempty"`
+		// ClipVisionImageGridPinpoints holds the candidate resolutions in [width, height] pairs,
+		// which are used to slice the image with "spatial_unpad" merge type, e.g. LLaVA-Next.
+		//
+		// Only used when Architecture is "clip" and ClipHasVisionEncoder is true.
+		ClipVisionImageGridPinpoints []uint32 `json:"clipVisionImageGridPinpoints,omitempty"`
 		// ClipVisionMMPatchMergeType indicates the merge type of the vision encoder.
 		//
 		// Only used when Architecture is "clip" and ClipHasVisionEncoder is true.
@@ -234,6 +249,11 @@ type (
 		//
 		// Only used when Architecture is "clip" and ClipHasVisionEncoder is true.
 		ClipVisionWindowAttentionPattern uint32 `json:"clipVisionWindowAttentionPattern,omitempty"`
+		// ClipVisionHasImageBreak indicates whether the vision encoder inserts an [IMG_BREAK] token after each row of the image,
+		// e.g. Pixtral, which is detected by the v.token_embd.img_break tensor.
+		//
+		// Only used when Architecture is "clip" and ClipHasVisionEncoder is true.
+		ClipVisionHasImageBreak bool `json:"clipVisionHasImageBreak,omitempty"`
 		// ClipHasAudioEncoder indicates whether the clip model has audio encoder or not.
 		//
 		// Only used when Architecture is "clip".
@@ -284,6 +304,19 @@ type (
 		// Only used when Architecture is "control_vector".
 		AdapterControlVectorLayerCount uint32 `json:"adapterControlVectorLayerCount,omitempty"`
 
+		// IMatrixChunkCount is the number of chunks processed to collect the importance matrix.
+		//
+		// Only used when Architecture is "imatrix".
+		IMatrixChunkCount uint32 `json:"imatrixChunkCount,omitempty"`
+		// IMatrixDatasets holds the names of the datasets used to collect the importance matrix.
+		//
+		// Only used when Architecture is "imatrix".
+		IMatrixDatasets []string `json:"imatrixDatasets,omitempty"`
+		// IMatrixEntryCount is the number of the weight tensors which have importance data.
+		//
+		// Only used when Architecture is "imatrix".
+		IMatrixEntryCount uint64 `json:"imatrixEntryCount,omitempty"`
+
 		// DiffusionArchitecture is the actual architecture of the diffusion model.
 		//
 		// Only used when Architecture is "diffusion".
@@ -291,6 +324,10 @@ type (
 		// DiffusionTransformer indicates whether the diffusion model is a diffusion transformer or not.
 		//
 		DiffusionTransformer bool `json:"diffusionTransformer,omitempty"`
+		// DiffusionVideo indicates whether the diffusion model generates video or not.
+		//
+		// Only used when Architecture is "diffusion".
+		DiffusionVideo bool `json:"diffusionVideo,omitempty"`
 		// DiffusionConditioners is the list of diffusion conditioners.
 		//
 		// Only used when Architecture is "diffusion".
@@ -317,7 +354,7 @@ type (
 	GGUFArchitectureDiffusionAutoencoder struct {
 		// Architecture is the architecture of the diffusion autoencoder.
 		//
-		// Currently, only "VAE" is supported.
+		// Currently, only "VAE" and "3D VAE" are supported.
 		Architecture string `json:"architecture"`
 
 		// FileType describes the type of the majority of the tensors in the GGUF file.
@@ -335,6 +372,35 @@ func (ga GGUFArchitecture) DiffusionHasAutoencoder() bool {
 	return ga.DiffusionAutoencoder != nil && ga.DiffusionAutoencoder.Architecture != ""
 }
 
+// LayerAttentionHeadCount returns the number of attention heads of the given layer,
+// falls back to AttentionHeadCount if the layer is out of AttentionHeadCountPerLayer.
+func (ga GGUFArchitecture) LayerAttentionHeadCount(il uint64) uint64 {
+	if il < uint64(len(ga.AttentionHeadCountPerLayer)) {
+		return ga.AttentionHeadCountPerLayer[il]
+	}
+	return ga.AttentionHeadCount
+}
+
+// LayerAttentionHeadCountKV returns the number of attention heads per group of the given layer,
+// falls back to AttentionHeadCountKV if the layer is out of AttentionHeadCountKVPerLayer.
+func (ga GGUFArchitecture) LayerAttentionHeadCountKV(il uint64) uint64 {
+	if il < uint64(len(ga.AttentionHeadCountKVPerLayer)) {
+		return ga.AttentionHeadCountKVPerLayer[il]
+	}
+	return ga.AttentionHeadCountKV
+}
+
+// LayerAttentionSlidingWindow returns true if the given layer is Sliding Window Attention,
+// falls back to AttentionSlidingWindowPattern if the layer is out of AttentionSlidingWindowPerLayer.
+func (ga GGUFArchitecture) LayerAttentionSlidingWindow(il uint64) bool {
+	if il < uint64(len(ga.AttentionSlidingWindowPerLayer)) {
+		return ga.AttentionSlidingWindowPerLayer[il]
+	}
+	// See https://github.com/ggml-org/llama.cpp/blob/master/src/llama-hparams.cpp, set_swa_pattern.
+	p := uint64(ga.AttentionSlidingWindowPattern)
+	return p == 0 || il%p < p-1
+}
+
 func (gacs GGUFArchitectureDiffusionConditioners) String() string {
 	var sb strings.Builder
 	for i, gac := range gacs {
@@ -420,6 +486,19 @@ func (gf *GGUFFile) diffuserArchitecture() (ga GGUFArchitecture) {
 		fluxFillFeatureKey  = "model.diffusion_model.img_in.weight" // FLUX.1 Fill feature
 		fluxFillFeatureKey2 = "img_in.weight"
 
+		qwenImageKey      = "model.diffusion_model.transformer_blocks.0.img_mod.1.weight" // Qwen-Image
+		qwenImageKey2     = "transformer_blocks.0.img_mod.1.weight"
+		wanKey            = "model.diffusion_model.blocks.0.cross_attn.k.weight" // Wan
+		wanKey2           = "blocks.0.cross_attn.k.weight"
+		wanI2VFeatureKey  = "model.diffusion_model.img_emb.proj.0.weight" // Wan I2V feature
+		wanI2VFeatureKey2 = "img_emb.proj.0.weight"
+		wanHeadKey        = "model.diffusion_model.head.head.weight" // Wan TI2V feature
+		wanHeadKey2       = "head.head.weight"
+		ltxvKey           = "model.diffusion_model.patchify_proj.weight" // LTX-Video
+		ltxvKey2          = "patchify_proj.weight"
+		hunyuanVideoKey   = "model.diffusion_model.txt_in.individual_token_refiner.blocks.0.norm1.weight" // HunyuanVideo
+		hunyuanVideoKey2  = "txt_in.individual_token_refiner.blocks.0.norm1.weight"
+
 		// Conditioner
 
 		openAiClipVitL14Key  = "cond_stage_model.transformer.text_model.encoder.layers.11.self_attn.k_proj.weight" // OpenAI CLIP ViT-L/14
@@ -433,6 +512,16 @@ func (gf *GGUFFile) diffuserArchitecture() (ga GGUFArchitecture) {
 		t5xxlKey3            = "encoder.block.23.layer.0.SelfAttention.k.weight"
 	)
 
+	var (
+		// UMT5 holds the relative attention bias in every block,
+		// while T5 only holds it in the first block.
+		umt5xxlRegex = regexp.MustCompile(`^(cond_stage_model\.(\d+\.)?transformer\.)?encoder\.block\.1\.layer\.0\.SelfAttention\.relative_attention_bias\.weight$`) // Google UMT5-xxl
+		// Language model conditioner, e.g. Qwen2.5-VL, LLaVA LLaMA 3.
+		lmRegex = regexp.MustCompile(`^(cond_stage_model\.(\d+\.)?transformer\.)?model\.layers\.0\.self_attn\.q_proj\.weight$`)
+		// 3D autoencoder, built with causal 3D convolution.
+		vae3dRegex = regexp.MustCompile(`^(first_stage_model\.)?decoder\.(conv1|conv_in\.conv)\.weight$`)
+	)
+
 	tis, _ := gf.TensorInfos.Index([]string{
 		sdKey,
 		sdKey2,
@@ -450,6 +539,19 @@ func (gf *GGUFFile) diffuserArchitecture() (ga GGUFArchitecture) {
 		fluxFillFeatureKey,
 		fluxFillFeatureKey2,
 
+		qwenImageKey,
+		qwenImageKey2,
+		wanKey,
+		wanKey2,
+		wanI2VFeatureKey,
+		wanI2VFeatureKey2,
+		wanHeadKey,
+		wanHeadKey2,
+		ltxvKey,
+		ltxvKey2,
+		hunyuanVideoKey,
+		hunyuanVideoKey2,
+
 		openAiClipVitL14Key,
 		openAiClipVitL14Key2,
 		openClipVitH14Key,
@@ -516,6 +618,50 @@ func (gf *GGUFFile) diffuserArchitecture() (ga GGUFArchitecture) {
 			ga.DiffusionArchitecture += " Fill"
 		}
 	}
+	if _, ok := tis[qwenImageKey]; ok {
+		ga.DiffusionArchitecture = "Qwen-Image"
+		ga.DiffusionTransformer = true
+	} else if _, ok := tis[qwenImageKey2]; ok {
+		ga.DiffusionArchitecture = "Qwen-Image"
+		ga.DiffusionTransformer = true
+	}
+	if _, ok := tis[wanKey]; ok {
+		ga.DiffusionArchitecture = "Wan 2.x"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+		if ti, ok := tis[wanHeadKey]; ok && ti.NDimensions > 1 && ti.Dimensions[1] == 48*4 {
+			ga.DiffusionArchitecture = "Wan 2.2 TI2V"
+		} else if _, ok = tis[wanI2VFeatureKey]; ok {
+			ga.DiffusionArchitecture += " I2V"
+		}
+	} else if _, ok := tis[wanKey2]; ok {
+		ga.DiffusionArchitecture = "Wan 2.x"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+		if ti, ok := tis[wanHeadKey2]; ok && ti.NDimensions > 1 && ti.Dimensions[1] == 48*4 {
+			ga.DiffusionArchitecture = "Wan 2.2 TI2V"
+		} else if _, ok = tis[wanI2VFeatureKey2]; ok {
+			ga.DiffusionArchitecture += " I2V"
+		}
+	}
+	if _, ok := tis[ltxvKey]; ok {
+		ga.DiffusionArchitecture = "LTX-Video"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+	} else if _, ok := tis[ltxvKey2]; ok {
+		ga.DiffusionArchitecture = "LTX-Video"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+	}
+	if _, ok := tis[hunyuanVideoKey]; ok {
+		ga.DiffusionArchitecture = "HunyuanVideo"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+	} else if _, ok := tis[hunyuanVideoKey2]; ok {
+		ga.DiffusionArchitecture = "HunyuanVideo"
+		ga.DiffusionTransformer = true
+		ga.DiffusionVideo = true
+	}
 
 	if ti, ok := tis[openAiClipVitL14Key]; ok {
 		cond := GGUFArchitectureDiffusionConditioner{
@@ -570,15 +716,42 @@ func (gf *GGUFFile) diffuserArchitecture() (ga GGUFArchitecture) {
 		})
 	}
 
+	if tis := gf.TensorInfos.Search(umt5xxlRegex); len(tis) != 0 {
+		cond := GGUFArchitectureDiffusionConditioner{
+			Architecture: "Google UMT5-xxl",
+			FileType:     tis[0].GetFileType(),
+		}
+		// Replace the T5 conditioner if detected.
+		if i := len(ga.DiffusionConditioners) - 1; i >= 0 && ga.DiffusionConditioners[i].Architecture == "Google T5-xxl" {
+			ga.DiffusionConditioners[i] = cond
+		} else {
+			ga.DiffusionConditioners = append(ga.DiffusionConditioners, cond)
+		}
+	}
+	if tis := gf.TensorInfos.Search(lmRegex); len(tis) != 0 {
+		cond := GGUFArchitectureDiffusionConditioner{
+			Architecture: "Qwen2.5-VL",
+			FileType:     tis[0].GetFileType(),
+		}
+		if ga.DiffusionArchitecture == "HunyuanVideo" {
+			cond.Architecture = "LLaVA LLaMA 3"
+		}
+		ga.DiffusionConditioners = append(ga.DiffusionConditioners, cond)
+	}
+
 	for _, re := range []*regexp.Regexp{
 		regexp.MustCompile(`^first_stage_model\..*`),
 		regexp.MustCompile(`^decoder\.conv_in\..*`),
+		regexp.MustCompile(`^decoder\.conv1\..*`),
 	} {
 		if tis := gf.TensorInfos.Search(re); len(tis) != 0 {
 			ga.DiffusionAutoencoder = &GGUFArchitectureDiffusionAutoencoder{
 				Architecture: ga.DiffusionArchitecture + " VAE",
 				FileType:     GGUFTensorInfos(tis).GetFileType(),
 			}
+			if ga.DiffusionVideo || gf.TensorInfos.Match(vae3dRegex) {
+				ga.DiffusionAutoencoder.Architecture = ga.DiffusionArchitecture + " 3D VAE"
+			}
 			break
 		}
 	}
@@ -610,6 +783,7 @@ func (gf *GGUFFile) clipArchitecture() (ga GGUFArchitecture) {
 		visionProjectorScaleFactorKey         = "clip.vision.projector.scale_factor"
 		visionImageSizeKey                    = "clip.vision.image_size"
 		visionPatchSizeKey                    = "clip.vision.patch_size"
+		visionImageGridPinpointsKey           = "clip.vision.image_grid_pinpoints"
 		visionMMPatchMergeTypeKey             = "clip.vision.mm_patch_merge_type"
 		visioSpatialMergeSizeKey              = "clip.vision.spatial_merge_size"
 		visionWindowAttentionPatternKey       = "clip.vision.n_wa_pattern"
@@ -649,6 +823,7 @@ func (gf *GGUFFile) clipArchitecture() (ga GGUFArchitecture) {
 		visionProjectorScaleFactorKey,
 		visionImageSizeKey,
 		visionPatchSizeKey,
+		visionImageGridPinpointsKey,
 		visionMMPatchMergeTypeKey,
 		visioSpatialMergeSizeKey,
 		visionWindowAttentionPatternKey,
@@ -735,6 +910,9 @@ func (gf *GGUFFile) clipArchitecture() (ga GGUFArchitecture) {
 	if v, ok := m[visionPatchSizeKey]; ok {
 		ga.ClipVisionPatchSize = ValueNumeric[uint32](v)
 	}
+	if v, ok := m[visionImageGridPinpointsKey]; ok {
+		ga.ClipVisionImageGridPinpoints = ValuesNumeric[uint32](v.ValueArray())
+	}
 	ga.ClipVisionMMPatchMergeType = "flat"
 	if v, ok := m[visionMMPatchMergeTypeKey]; ok {
 		ga.ClipVisionMMPatchMergeType = v.ValueString()
@@ -745,6 +923,9 @@ func (gf *GGUFFile) clipArchitecture() (ga GGUFArchitecture) {
 	if v, ok := m[visionWindowAttentionPatternKey]; ok {
 		ga.ClipVisionWindowAttentionPattern = ValueNumeric[uint32](v)
 	}
+	if _, ok := gf.TensorInfos.Get("v.token_embd.img_break"); ok {
+		ga.ClipVisionHasImageBreak = true
+	}
 	// Audio
 	if v, ok := m[hasAudioEncoderKey]; ok {
 		ga.ClipHasAudioEncoder = v.ValueBool()
@@ -796,6 +977,7 @@ func (gf *GGUFFile) adapterArchitecture(arch string) (ga GGUFArchitecture) {
 
 		controlVectorLayerCountKey  = "adapter.control_vector.layer_count"
 		controlVectorLayerCountKey2 = "control_vector.layer_count"
+		controlVectorLayerCountKey3 = "controlvector.layer_count"
 	)
 
 	ga.Type = "adapter"
@@ -806,6 +988,7 @@ func (gf *GGUFFile) adapterArchitecture(arch string) (ga GGUFArchitecture) {
 		loraAlphaKey,
 		controlVectorLayerCountKey,
 		controlVectorLayerCountKey2,
+		controlVectorLayerCountKey3,
 	})
 
 	if v, ok := m[typeKey]; ok {
@@ -818,6 +1001,8 @@ func (gf *GGUFFile) adapterArchitecture(arch string) (ga GGUFArchitecture) {
 		ga.AdapterControlVectorLayerCount = ValueNumeric[uint32](v)
 	} else if v, ok := m[controlVectorLayerCountKey2]; ok {
 		ga.AdapterControlVectorLayerCount = ValueNumeric[uint32](v)
+	} else if v, ok := m[controlVectorLayerCountKey3]; ok {
+		ga.AdapterControlVectorLayerCount = ValueNumeric[uint32](v)
 	}
 
 	return ga
@@ -827,6 +1012,11 @@ func (gf *GGUFFile) imatrixArchitecture(_ string) (ga GGUFArchitecture) {
 	ga.Type = "imatrix"
 	ga.Architecture = "imatrix"
 
+	gi := gf.IMatrix()
+	ga.IMatrixChunkCount = gi.ChunkCount
+	ga.IMatrixDatasets = gi.Datasets
+	ga.IMatrixEntryCount = uint64(len(gi.Entries))
+
 	return ga
 }
 
@@ -843,22 +1033,23 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 		expertUsedCountKey               = arch + ".expert_used_count"
 		expertSharedCountKey             = arch + ".expert_shared_count"
 
-		attentionHeadCountKey           = arch + ".attention.head_count"
-		attentionHeadCountKVKey         = arch + ".attention.head_count_kv"
-		attentionSlidingWindowKey       = arch + ".attention.sliding_window"
-		attentionMaxALiBIBiasKey        = arch + ".attention.max_alibi_bias"
-		attentionMaxALiBIBiasKey2       = arch + ".attention.alibi_bias_max"
-		attentionClampKQVKey            = arch + ".attention.clamp_kqv"
-		attentionClampKQVKey2           = arch + ".attention.clip_kqv"
-		attentionLayerNormEpsilonKey    = arch + ".attention.layer_norm_epsilon"
-		attentionLayerNormRMSEpsilonKey = arch + ".attention.layer_norm_rms_epsilon"
-		attentionQueryLORARankKey       = arch + ".attention.q_lora_rank"
-		attentionKeyValueLORARankKey    = arch + ".attention.kv_lora_rank"
-		attentionKeyLengthKey           = arch + ".attention.key_length"
-		attentionKeyLengthMLAKey        = arch + ".attention.key_length_mla"
-		attentionValueLengthKey         = arch + ".attention.value_length"
-		attentionValueLengthMLAKey      = arch + ".attention.value_length_mla"
-		attentionCausalKey              = arch + ".attention.causal"
+		attentionHeadCountKey            = arch + ".attention.head_count"
+		attentionHeadCountKVKey          = arch + ".attention.head_count_kv"
+		attentionSlidingWindowKey        = arch + ".attention.sliding_window"
+		attentionSlidingWindowPatternKey = arch + ".attention.sliding_window_pattern"
+		attentionMaxALiBIBiasKey         = arch + ".attention.max_alibi_bias"
+		attentionMaxALiBIBiasKey2        = arch + ".attention.alibi_bias_max"
+		attentionClampKQVKey             = arch + ".attention.clamp_kqv"
+		attentionClampKQVKey2            = arch + ".attention.clip_kqv"
+		attentionLayerNormEpsilonKey     = arch + ".attention.layer_norm_epsilon"
+		attentionLayerNormRMSEpsilonKey  = arch + ".attention.layer_norm_rms_epsilon"
+		attentionQueryLORARankKey        = arch + ".attention.q_lora_rank"
+		attentionKeyValueLORARankKey     = arch + ".attention.kv_lora_rank"
+		attentionKeyLengthKey            = arch + ".attention.key_length"
+		attentionKeyLengthMLAKey         = arch + ".attention.key_length_mla"
+		attentionValueLengthKey          = arch + ".attention.value_length"
+		attentionValueLengthMLAKey       = arch + ".attention.value_length_mla"
+		attentionCausalKey               = arch + ".attention.causal"
 
 		ropeDimensionCountKey         = arch + ".rope.dimension_count"
 		ropeFrequencyBaseKey          = arch + ".rope.freq_base"
@@ -903,6 +1094,7 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 		attentionHeadCountKey,
 		attentionHeadCountKVKey,
 		attentionSlidingWindowKey,
+		attentionSlidingWindowPatternKey,
 		attentionMaxALiBIBiasKey,
 		attentionMaxALiBIBiasKey2,
 		attentionClampKQVKey,
@@ -978,19 +1170,22 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 
 	if v, ok := m[attentionHeadCountKey]; ok {
 		if v.ValueType == GGUFMetadataValueTypeArray {
-			ga.AttentionHeadCount = ValuesNumeric[uint64](v.ValueArray())[0]
+			ga.AttentionHeadCountPerLayer = ValuesNumeric[uint64](v.ValueArray())
+			ga.AttentionHeadCount = firstNonZero(ga.AttentionHeadCountPerLayer)
 		} else {
 			ga.AttentionHeadCount = ValueNumeric[uint64](v)
 		}
 	}
 	if v, ok := m[attentionHeadCountKVKey]; ok {
 		if v.ValueType == GGUFMetadataValueTypeArray {
-			ga.AttentionHeadCountKV = ValuesNumeric[uint64](v.ValueArray())[0]
+			ga.AttentionHeadCountKVPerLayer = ValuesNumeric[uint64](v.ValueArray())
+			ga.AttentionHeadCountKV = firstNonZero(ga.AttentionHeadCountKVPerLayer)
 		} else {
 			ga.AttentionHeadCountKV = ValueNumeric[uint64](v)
 		}
 	} else {
 		ga.AttentionHeadCountKV = ga.AttentionHeadCount
+		ga.AttentionHeadCountKVPerLayer = slices.Clone(ga.AttentionHeadCountPerLayer)
 	}
 	ga.AttentionSlidingWindowPattern = 1
 	if v, ok := m[attentionSlidingWindowKey]; ok {
@@ -1018,6 +1213,45 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 		ga.AttentionSlidingWindowPattern = 6
 	case "cohere2":
 		ga.AttentionSlidingWindowPattern = 4
+	case "gpt-oss":
+		ga.AttentionSlidingWindowPattern = 2
+	}
+	if v, ok := m[attentionSlidingWindowPatternKey]; ok {
+		if v.ValueType == GGUFMetadataValueTypeArray {
+			// E.g. Gemma3n, which stores the pattern per layer.
+			if av := v.ValueArray(); av.Type == GGUFMetadataValueTypeBool {
+				ga.AttentionSlidingWindowPerLayer = av.ValuesBool()
+			} else {
+				vs := ValuesNumeric[uint32](av)
+				ga.AttentionSlidingWindowPerLayer = make([]bool, len(vs))
+				for i := range vs {
+					ga.AttentionSlidingWindowPerLayer[i] = vs[i] != 0
+				}
+			}
+			// Derive the period from the distance between the none SWA layers,
+			// or 0 if there is no fixed period.
+			var nsl []int
+			for i, swa := range ga.AttentionSlidingWindowPerLayer {
+				if !swa {
+					nsl = append(nsl, i)
+				}
+			}
+			ga.AttentionSlidingWindowPattern = 0
+			switch {
+			case len(nsl) == 1 && len(ga.AttentionSlidingWindowPerLayer) < 2*nsl[0]+2:
+				ga.AttentionSlidingWindowPattern = uint32(nsl[0] + 1)
+			case len(nsl) > 1:
+				p := nsl[1] - nsl[0]
+				for i := 2; i < len(nsl) && p != 0; i++ {
+					if nsl[i]-nsl[i-1] != p {
+						p = 0
+					}
+				}
+				ga.AttentionSlidingWindowPattern = uint32(p)
+			}
+		} else {
+			ga.AttentionSlidingWindowPattern = ValueNumeric[uint32](v)
+		}
 	}
 	if v, ok := m[attentionMaxALiBIBiasKey]; ok {
 		ga.AttentionMaxALiBIBias = ValueNumeric[float32](v)
@@ -1162,3 +1396,14 @@ func (gf *GGUFFile) transformerArchitecture(arch string) (ga GGUFArchitecture) {
 
 	return ga
 }
+
+// firstNonZero returns the first non-zero value of the given slice,
+// or zero if not found.
+func firstNonZero(vs []uint64) uint64 {
+	for _, v := range vs {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,452 @@
+package gguf_parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/gpustack/gguf-parser-go/util/httpx"
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// GGUFDownloadProgressFunc reports the downloaded bytes and the total bytes of the given destination path,
+// it may be called concurrently.
+type GGUFDownloadProgressFunc func(path string, downloaded, total int64)
+
+var ErrGGUFFileDigestMismatched = errors.New("GGUF file digest mismatched")
+
+// DownloadGGUFFile downloads a GGUF file from a remote url to the given destination path,
+// and returns the paths of the downloaded files, or an error if any.
+//
+// If the url points to a shard of a split GGUF file,
+// all shards are downloaded and named with the shard suffix of the destination path.
+//
+// The download is split into range requests in parallel,
+// resumes from the partial file("<dest>.part") left by the previous run,
+// and verifies the SHA256 digest provided by the server,
+// e.g. the LFS hash of HuggingFace, or the ETag prefixed with "sha256:".
+//
+// Without a digest, an existing destination is skipped only if
+// the completed state("<dest>.part.json") records the same url and ETag.
+func DownloadGGUFFile(ctx context.Context, url, dest string, opts ...GGUFReadOption) ([]string, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cli := httpx.Client(
+		remoteClientOptions(url, o).
+			WithRetryBackoff(1*time.Second, 5*time.Second, 10))
+
+	var urls []string
+	{
+		rs := CompleteShardGGUFFilename(url)
+		if rs != nil {
+			urls = rs
+		} else {
+			urls = []string{url}
+		}
+	}
+	dests := downloadDestinations(dest, len(urls))
+
+	for i := range urls {
+		if err := downloadGGUFFileFromRemote(ctx, cli, urls[i], dests[i], "", o); err != nil {
+			return nil, err
+		}
+	}
+	return dests, nil
+}
+
+// DownloadGGUFFileFromHuggingFace downloads a GGUF file from Hugging Face(https://huggingface.co/)
+// to the given destination path,
+// and returns the paths of the downloaded files, or an error if any.
+func DownloadGGUFFileFromHuggingFace(ctx context.Context, repo, file, dest string, opts ...GGUFReadOption) ([]string, error) {
+	ep := osx.Getenv("HF_ENDPOINT", "https://huggingface.co")
+	return DownloadGGUFFile(ctx, fmt.Sprintf("%s/%s/resolve/main/%s", ep, repo, file), dest, opts...)
+}
+
+// DownloadGGUFFileFromModelScope downloads a GGUF file from Model Scope(https://modelscope.cn/)
+// to the given destination path,
+// and returns the paths of the downloaded files, or an error if any.
+func DownloadGGUFFileFromModelScope(ctx context.Context, repo, file, dest string, opts ...GGUFReadOption) ([]string, error) {
+	ep := osx.Getenv("MS_ENDPOINT", "https://modelscope.cn")
+	return DownloadGGUFFile(ctx, fmt.Sprintf("%s/models/%s/resolve/master/%s", ep, repo, file), dest, opts...)
+}
+
+// DownloadGGUFFileFromOllama downloads the GGUF file of Ollama model's base layer
+// to the given destination path,
+// and returns the paths of the downloaded files, or an error if any.
+func DownloadGGUFFileFromOllama(ctx context.Context, model, dest string, opts ...GGUFReadOption) ([]string, error) {
+	return DownloadGGUFFileFromOllamaModel(ctx, ParseOllamaModel(model), dest, opts...)
+}
+
+// DownloadGGUFFileFromOllamaModel is similar to DownloadGGUFFileFromOllama,
+// but inputs an OllamaModel instead of a string.
+//
+// The downloaded file is verified with the digest of the base layer.
+func DownloadGGUFFileFromOllamaModel(ctx context.Context, model *OllamaModel, dest string, opts ...GGUFReadOption) ([]string, error) {
+	if model == nil {
+		return nil, ErrOllamaInvalidModel
+	}
+
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cli := ollamaClient(o)
+
+	if err := model.Complete(ctx, cli); err != nil {
+		return nil, fmt.Errorf("complete ollama model: %w", err)
+	}
+	ml, ok := model.GetLayer("application/vnd.ollama.image.model")
+	if !ok {
+		return nil, ErrOllamaBaseLayerNotFound
+	}
+
+	if err := downloadGGUFFileFromRemote(ctx, cli, ml.BlobURL().String(), dest, ml.Digest, o); err != nil {
+		return nil, err
+	}
+	return []string{dest}, nil
+}
+
+// downloadDestinations returns the destination paths of the given count of shards.
+func downloadDestinations(dest string, count int) []string {
+	if count <= 1 {
+		return []string{dest}
+	}
+
+	prefix := strings.TrimSuffix(dest, ".gguf")
+	if r := ShardGGUFFilenameRegex.FindStringSubmatch(dest); r != nil {
+		prefix = r[ShardGGUFFilenameRegex.SubexpIndex("Prefix")]
+	}
+	dests := make([]string, count)
+	for i := range dests {
+		dests[i] = fmt.Sprintf("%s-%05d-of-%05d.gguf", prefix, i+1, count)
+	}
+	return dests
+}
+
+type (
+	// _GGUFDownloadState is the state of a partial download,
+	// which is saved aside the partial file to resume.
+	_GGUFDownloadState struct {
+		URL       string               `json:"url"`
+		ETag      string               `json:"etag,omitempty"`
+		Size      int64                `json:"size"`
+		Digest    string               `json:"digest,omitempty"`
+		Chunks    []_GGUFDownloadChunk `json:"chunks"`
+		Completed bool                 `json:"completed,omitempty"`
+	}
+
+	// _GGUFDownloadChunk is a range of the file,
+	// [Start, End) is the range, and Done is the downloaded bytes from Start.
+	_GGUFDownloadChunk struct {
+		Start int64 `json:"start"`
+		End   int64 `json:"end"`
+		Done  int64 `json:"done"`
+	}
+)
+
+// _GGUFDownloadDigestRegex matches the SHA256 digest,
+// which may be quoted, weak, or prefixed with "sha256:".
+var _GGUFDownloadDigestRegex = regexp.MustCompile(`^(?:W/)?"?(?:sha256:)?([0-9a-fA-F]{64})"?$`)
+
+// downloadGGUFFileFromRemote downloads the given url to the given destination path,
+// the given digest takes precedence over the one provided by the server.
+func downloadGGUFFileFromRemote(ctx context.Context, cli *http.Client, url, dest, digest string, o _GGUFReadOptions) error {
+	chunkSize := o.DownloadChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 32 * 1024 * 1024
+	}
+	concurrency := o.DownloadConcurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	// Probe.
+	size, ranged, serverDigest, etag, err := probeDownload(ctx, cli, url)
+	if err != nil {
+		return err
+	}
+	if digest == "" {
+		digest = serverDigest
+	}
+	if r := _GGUFDownloadDigestRegex.FindStringSubmatch(digest); r != nil {
+		digest = strings.ToLower(r[1])
+	} else {
+		digest = ""
+	}
+
+	part, statePath := dest+".part", dest+".part.json"
+
+	var st _GGUFDownloadState
+	if bs, err := os.ReadFile(statePath); err == nil {
+		if err = json.Unmarshal(bs, &st); err != nil {
+			st = _GGUFDownloadState{}
+		}
+	}
+
+	// Skip if completed,
+	// without digest, the completed state must record the same url and ETag.
+	if fi, err := os.Stat(dest); err == nil && fi.Size() == size {
+		if digest != "" {
+			if err = verifyDownload(dest, digest); err == nil {
+				reportDownloadProgress(o, dest, size, size)
+				return nil
+			}
+		} else if st.Completed && st.URL == url && etag != "" && st.ETag == etag && st.Size == size {
+			reportDownloadProgress(o, dest, size, size)
+			return nil
+		}
+	}
+
+	// Resume or restart.
+	{
+		if st.Completed || st.URL != url || st.ETag != etag || st.Size != size || st.Digest != digest || !ranged || !osx.ExistsFile(part) {
+			st = _GGUFDownloadState{URL: url, ETag: etag, Size: size, Digest: digest}
+			if !ranged || size < 0 {
+				st.Chunks = []_GGUFDownloadChunk{{Start: 0, End: size}}
+			} else {
+				for s := int64(0); s < size; s += chunkSize {
+					st.Chunks = append(st.Chunks, _GGUFDownloadChunk{Start: s, End: min(s+chunkSize, size)})
+				}
+			}
+			_ = os.Remove(part)
+		}
+	}
+
+	f, err := osx.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open partial file: %w", err)
+	}
+	defer osx.Close(f)
+
+	var (
+		mu   sync.Mutex
+		done int64
+	)
+	for i := range st.Chunks {
+		done += st.Chunks[i].Done
+	}
+	save := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		bs, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		return osx.WriteFile(statePath, bs, 0o644)
+	}
+	advance := func(i int, n int64) {
+		mu.Lock()
+		st.Chunks[i].Done += n
+		done += n
+		d := done
+		mu.Unlock()
+		reportDownloadProgress(o, dest, d, size)
+	}
+	reportDownloadProgress(o, dest, done, size)
+
+	// Download.
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(concurrency)
+	for i := range st.Chunks {
+		if c := st.Chunks[i]; c.End >= 0 && c.Start+c.Done >= c.End {
+			continue
+		}
+		x := i
+		eg.Go(func() error {
+			// NB(thxCode): The retry of httpx client only covers the round trip,
+			// so we retry the chunk from where it stopped if the body reading is broken.
+			var err error
+			for attempt := 0; attempt < 3; attempt++ {
+				if err = downloadChunk(ctx, cli, url, f, ranged, st.Chunks[x], func(n int64) { advance(x, n) }); err == nil {
+					return save()
+				}
+				if ctx.Err() != nil || !ranged {
+					break
+				}
+				_ = save()
+			}
+			return err
+		})
+	}
+	if err = eg.Wait(); err != nil {
+		_ = save()
+		return fmt.Errorf("download %s: %w", url, err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("sync partial file: %w", err)
+	}
+	osx.Close(f)
+
+	// Verify.
+	if err = verifyDownload(part, digest); err != nil {
+		_ = os.Remove(part)
+		_ = os.Remove(statePath)
+		return fmt.Errorf("verify %s: %w", url, err)
+	}
+
+	if err = os.Rename(part, dest); err != nil {
+		return fmt.Errorf("rename partial file: %w", err)
+	}
+	// Keep the completed state to skip the next run if no digest to verify.
+	if digest == "" && etag != "" {
+		st.Completed = true
+		if err = save(); err == nil {
+			return nil
+		}
+	}
+	_ = os.Remove(statePath)
+	return nil
+}
+
+// probeDownload requests the first byte of the given url,
+// and returns the size, whether supporting range download, the digest provided by the server and the ETag.
+//
+// The digest is taken from the X-Linked-Etag header,
+// or the ETag header only if it is prefixed with "sha256:".
+func probeDownload(ctx context.Context, cli *http.Client, url string) (size int64, ranged bool, digest, etag string, err error) {
+	req, err := httpx.NewGetRequestWithContext(ctx, url)
+	if err != nil {
+		return 0, false, "", "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	// HuggingFace responds the LFS hash with the redirect response.
+	pcli := *cli
+	pcli.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.Response != nil && digest == "" {
+			digest = req.Response.Header.Get("X-Linked-Etag")
+		}
+		return nil
+	}
+
+	err = httpx.Do(&pcli, req, func(resp *http.Response) error {
+		if digest == "" {
+			digest = resp.Header.Get("X-Linked-Etag")
+		}
+		etag = resp.Header.Get("ETag")
+		if digest == "" && strings.HasPrefix(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), "sha256:") {
+			digest = etag
+		}
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			cr := resp.Header.Get("Content-Range")
+			i := strings.LastIndex(cr, "/")
+			if i < 0 {
+				return fmt.Errorf("invalid content range %q", cr)
+			}
+			size, err = strconv.ParseInt(cr[i+1:], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid content range %q: %w", cr, err)
+			}
+			ranged = true
+		case http.StatusOK:
+			size = resp.ContentLength
+		default:
+			return fmt.Errorf("status code %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, "", "", fmt.Errorf("probe %s: %w", url, err)
+	}
+	return size, ranged, digest, etag, nil
+}
+
+// downloadChunk downloads the rest of the given chunk into the given file.
+func downloadChunk(
+	ctx context.Context,
+	cli *http.Client,
+	url string,
+	f io.WriterAt,
+	ranged bool,
+	c _GGUFDownloadChunk,
+	advance func(n int64),
+) error {
+	req, err := httpx.NewGetRequestWithContext(ctx, url)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	if ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", c.Start+c.Done, c.End-1))
+	}
+
+	return httpx.Do(cli, req, func(resp *http.Response) error {
+		switch {
+		case ranged && resp.StatusCode != http.StatusPartialContent:
+			return fmt.Errorf("range %d-%d: status code %d", c.Start+c.Done, c.End-1, resp.StatusCode)
+		case !ranged && resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("status code %d", resp.StatusCode)
+		}
+
+		off := c.Start + c.Done
+		buf := make([]byte, 256*1024)
+		for {
+			n, err := resp.Body.Read(buf)
+			if n > 0 {
+				if _, werr := f.WriteAt(buf[:n], off); werr != nil {
+					return fmt.Errorf("write partial file: %w", werr)
+				}
+				off += int64(n)
+				advance(int64(n))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read body: %w", err)
+			}
+		}
+		if c.End >= 0 && off != c.End {
+			return fmt.Errorf("range %d-%d: unexpected end at %d", c.Start, c.End-1, off)
+		}
+		return nil
+	})
+}
+
+// verifyDownload verifies the SHA256 digest of the given file if the digest is not blank.
+func verifyDownload(path, digest string) error {
+	if digest == "" {
+		return nil
+	}
+
+	f, err := osx.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer osx.Close(f)
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("hash file: %w", err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != digest {
+		return fmt.Errorf("%w: expected sha256:%s, got sha256:%s", ErrGGUFFileDigestMismatched, digest, actual)
+	}
+	return nil
+}
+
+func reportDownloadProgress(o _GGUFReadOptions, path string, downloaded, total int64) {
+	if o.DownloadProgress != nil {
+		o.DownloadProgress(path, downloaded, total)
+	}
+}
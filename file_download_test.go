@@ -0,0 +1,210 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+)
+
+func TestDownloadGGUFFile(t *testing.T) {
+	const size = 3*1024*1024 + 512
+	data := make([]byte, size)
+	_, _ = rand.New(rand.NewSource(0)).Read(data)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	var (
+		servedBytes atomic.Int64
+		badDigest   atomic.Bool
+		noDigest    atomic.Bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/model.gguf"):
+		case strings.HasSuffix(r.URL.Path, "-of-00002.gguf"):
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		switch {
+		case noDigest.Load():
+			// A 64-hex ETag is not a digest without the "sha256:" prefix.
+			w.Header().Set("ETag", `"`+strings.Repeat("1", 64)+`"`)
+		case badDigest.Load():
+			w.Header().Set("X-Linked-Etag", `"`+strings.Repeat("0", 64)+`"`)
+		default:
+			w.Header().Set("X-Linked-Etag", `"`+digest+`"`)
+		}
+		if r.Header.Get("Range") != "bytes=0-0" {
+			w = &_countingResponseWriter{ResponseWriter: w, n: &servedBytes}
+		}
+		http.ServeContent(w, r, "model.gguf", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	t.Run("parallel", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "model.gguf")
+		var last atomic.Int64
+		paths, err := DownloadGGUFFile(ctx, srv.URL+"/model.gguf", dest,
+			UseDownloadChunkSize(1024*1024),
+			UseDownloadConcurrency(3),
+			UseDownloadProgress(func(_ string, downloaded, total int64) {
+				if total != size {
+					t.Errorf("expected total %d, got %d", size, total)
+				}
+				for {
+					l := last.Load()
+					if downloaded <= l || last.CompareAndSwap(l, downloaded) {
+						break
+					}
+				}
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 1 || paths[0] != dest {
+			t.Fatalf("unexpected paths %v", paths)
+		}
+		bs, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bs, data) {
+			t.Fatal("downloaded content mismatched")
+		}
+		if last.Load() != size {
+			t.Fatalf("expected progress to reach %d, got %d", size, last.Load())
+		}
+		if _, err = os.Stat(dest + ".part.json"); !os.IsNotExist(err) {
+			t.Fatal("expected state file to be removed")
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "model.gguf")
+		const chunkSize = 1024 * 1024
+
+		// Pretend the first two chunks and half of the third chunk are downloaded.
+		st := _GGUFDownloadState{URL: srv.URL + "/model.gguf", Size: size, Digest: digest}
+		for s := int64(0); s < size; s += chunkSize {
+			st.Chunks = append(st.Chunks, _GGUFDownloadChunk{Start: s, End: min(s+chunkSize, size)})
+		}
+		st.Chunks[0].Done = chunkSize
+		st.Chunks[1].Done = chunkSize
+		st.Chunks[2].Done = chunkSize / 2
+		part := make([]byte, size)
+		copy(part, data[:2*chunkSize+chunkSize/2])
+		if err := os.WriteFile(dest+".part", part, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dest+".part.json", json.MustMarshal(st), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		servedBytes.Store(0)
+		if _, err := DownloadGGUFFile(ctx, srv.URL+"/model.gguf", dest, UseDownloadChunkSize(chunkSize)); err != nil {
+			t.Fatal(err)
+		}
+		bs, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bs, data) {
+			t.Fatal("resumed content mismatched")
+		}
+		if s, rest := servedBytes.Load(), int64(size-(2*chunkSize+chunkSize/2)); s >= size || s != rest {
+			t.Fatalf("expected %d rest bytes to be served, got %d", rest, s)
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		dir := t.TempDir()
+		paths, err := DownloadGGUFFile(ctx, srv.URL+"/model-00001-of-00002.gguf", filepath.Join(dir, "local.gguf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			filepath.Join(dir, "local-00001-of-00002.gguf"),
+			filepath.Join(dir, "local-00002-of-00002.gguf"),
+		}
+		if len(paths) != 2 || paths[0] != expected[0] || paths[1] != expected[1] {
+			t.Fatalf("expected paths %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("no digest", func(t *testing.T) {
+		noDigest.Store(true)
+		defer noDigest.Store(false)
+
+		dest := filepath.Join(t.TempDir(), "model.gguf")
+
+		// A same size file without the completed state is downloaded again.
+		if err := os.WriteFile(dest, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		servedBytes.Store(0)
+		if _, err := DownloadGGUFFile(ctx, srv.URL+"/model.gguf", dest); err != nil {
+			t.Fatal(err)
+		}
+		bs, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bs, data) {
+			t.Fatal("downloaded content mismatched")
+		}
+		if s := servedBytes.Load(); s != size {
+			t.Fatalf("expected %d bytes to be served, got %d", size, s)
+		}
+
+		// The completed state of the same url and ETag skips the download.
+		servedBytes.Store(0)
+		if _, err = DownloadGGUFFile(ctx, srv.URL+"/model.gguf", dest); err != nil {
+			t.Fatal(err)
+		}
+		if s := servedBytes.Load(); s != 0 {
+			t.Fatalf("expected completed download to be skipped, got %d bytes served", s)
+		}
+	})
+
+	t.Run("digest mismatched", func(t *testing.T) {
+		badDigest.Store(true)
+		defer badDigest.Store(false)
+
+		dest := filepath.Join(t.TempDir(), "model.gguf")
+		_, err := DownloadGGUFFile(ctx, srv.URL+"/model.gguf", dest)
+		if !errors.Is(err, ErrGGUFFileDigestMismatched) {
+			t.Fatalf("expected digest mismatched, got %v", err)
+		}
+		if _, err = os.Stat(dest); !os.IsNotExist(err) {
+			t.Fatal("expected no file on digest mismatched")
+		}
+	})
+}
+
+// _countingResponseWriter counts the body bytes written to the response.
+type _countingResponseWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *_countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,169 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Types for the pairing of a drafter.
+type (
+	// GGUFDrafterMismatch represents a mismatch between a drafter and its target model.
+	GGUFDrafterMismatch struct {
+		// Rule is the name of the violated rule, e.g. "tokenizer-model".
+		Rule string `json:"rule"`
+		// Message describes the mismatch.
+		Message string `json:"message"`
+	}
+
+	// GGUFDrafterPairing represents the pairing result of a drafter and its target model.
+	GGUFDrafterPairing struct {
+		// Compatible indicates whether the drafter can be used for the target model,
+		// which is true if no mismatches,
+		// the token strings are not covered if TokensCompared is 0.
+		Compatible bool `json:"compatible"`
+		// Mismatches holds the mismatches between the drafter and the target model.
+		Mismatches []GGUFDrafterMismatch `json:"mismatches,omitempty"`
+		// TokensCompared is the number of the token strings compared,
+		// which is 0 if the token strings are skipped during parsing, e.g. SkipLargeMetadata.
+		TokensCompared uint64 `json:"tokensCompared"`
+		// TokensMatched is the number of the token strings which are the same at the same ID.
+		TokensMatched uint64 `json:"tokensMatched"`
+		// Overlap is the ratio of TokensMatched to TokensCompared.
+		Overlap float64 `json:"overlap"`
+	}
+)
+
+func (m GGUFDrafterMismatch) String() string {
+	return fmt.Sprintf("[%s] %s", m.Rule, m.Message)
+}
+
+const (
+	// _GGUFDrafterVocabularyMaxSizeDifference is the maximum size difference of the vocabularies,
+	// see https://github.com/ggml-org/llama.cpp/blob/master/common/speculative.cpp, SPEC_VOCAB_MAX_SIZE_DIFFERENCE.
+	_GGUFDrafterVocabularyMaxSizeDifference = 128
+	// _GGUFDrafterVocabularyCheckStartTokenID is the token ID to start comparing the token strings,
+	// see https://github.com/ggml-org/llama.cpp/blob/master/common/speculative.cpp, SPEC_VOCAB_CHECK_START_TOKEN_ID.
+	_GGUFDrafterVocabularyCheckStartTokenID = 5
+)
+
+// CheckDrafterCompatibility checks whether the given drafter can be used for speculative decoding of the given target model,
+// and returns the pairing result.
+//
+// Like llama.cpp, the tokenizer model, the BOS/EOS tokens must be the same,
+// the size difference of the vocabularies must not exceed 128,
+// and the token strings must be the same at the same ID,
+// see https://github.com/ggml-org/llama.cpp/blob/master/common/speculative.cpp, common_speculative_are_compatible.
+func CheckDrafterCompatibility(target, drafter *GGUFFile) (gp GGUFDrafterPairing) {
+	add := func(rule, format string, args ...any) {
+		gp.Mismatches = append(gp.Mismatches, GGUFDrafterMismatch{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	tt, dt := target.Tokenizer(), drafter.Tokenizer()
+	if tt.Model != dt.Model {
+		add("tokenizer-model", "drafter tokenizer model %q mismatches target tokenizer model %q", dt.Model, tt.Model)
+	}
+	if tt.BOSTokenID != dt.BOSTokenID {
+		add("bos-token", "drafter BOS token %d mismatches target BOS token %d", dt.BOSTokenID, tt.BOSTokenID)
+	}
+	if tt.EOSTokenID != dt.EOSTokenID {
+		add("eos-token", "drafter EOS token %d mismatches target EOS token %d", dt.EOSTokenID, tt.EOSTokenID)
+	}
+	if d := max(tt.TokensLength, dt.TokensLength) - min(tt.TokensLength, dt.TokensLength); d > _GGUFDrafterVocabularyMaxSizeDifference {
+		add("vocabulary-size", "drafter vocabulary size %d differs from target vocabulary size %d by %d, more than %d",
+			dt.TokensLength, tt.TokensLength, d, _GGUFDrafterVocabularyMaxSizeDifference)
+	}
+
+	const tokensKey = "tokenizer.ggml.tokens"
+	tv, tok := target.Header.MetadataKV.Get(tokensKey)
+	dv, dok := drafter.Header.MetadataKV.Get(tokensKey)
+	if tok && dok {
+		ta, da := tv.ValueArray(), dv.ValueArray()
+		if ta.Type == GGUFMetadataValueTypeString && da.Type == GGUFMetadataValueTypeString && len(ta.Array) != 0 && len(da.Array) != 0 {
+			ts, ds := ta.ValuesString(), da.ValuesString()
+			first := -1
+			for i := _GGUFDrafterVocabularyCheckStartTokenID; i < min(len(ts), len(ds)); i++ {
+				gp.TokensCompared++
+				if ts[i] == ds[i] {
+					gp.TokensMatched++
+				} else if first < 0 {
+					first = i
+				}
+			}
+			if gp.TokensCompared != 0 {
+				gp.Overlap = float64(gp.TokensMatched) / float64(gp.TokensCompared)
+			}
+			if first >= 0 {
+				add("token-text", "%d of %d token(s) mismatch, first at ID %d, drafter %q mismatches target %q",
+					gp.TokensCompared-gp.TokensMatched, gp.TokensCompared, first, ds[first], ts[first])
+			}
+		}
+	}
+
+	gp.Compatible = len(gp.Mismatches) == 0
+	return gp
+}
+
+// LLaMACppSpeculativeDecodingEstimate represents the estimated decode speed of speculative decoding.
+type LLaMACppSpeculativeDecodingEstimate struct {
+	// AcceptanceRate is the probability of a drafted token to be accepted by the target model.
+	AcceptanceRate float64 `json:"acceptanceRate"`
+	// DraftLength is the number of the tokens drafted in each step.
+	DraftLength uint64 `json:"draftLength"`
+	// AcceptedTokens is the expected number of the tokens generated in each step,
+	// including the one sampled by the target model.
+	AcceptedTokens float64 `json:"acceptedTokens"`
+	// TargetTokensPerSecond is the decode speed of the target model without speculative decoding.
+	TargetTokensPerSecond GGUFTokensPerSecondScalar `json:"targetTokensPerSecond"`
+	// DrafterTokensPerSecond is the decode speed of the drafter.
+	DrafterTokensPerSecond GGUFTokensPerSecondScalar `json:"drafterTokensPerSecond"`
+	// TokensPerSecond is the decode speed with speculative decoding.
+	TokensPerSecond GGUFTokensPerSecondScalar `json:"tokensPerSecond"`
+	// Speedup is the ratio of TokensPerSecond to TargetTokensPerSecond,
+	// less than 1 means speculative decoding slows down the decoding.
+	Speedup float64 `json:"speedup"`
+}
+
+// EstimateSpeculativeDecoding estimates the decode speed of speculative decoding with the given acceptance rate and draft length,
+// which requires the LLaMACppRunEstimate and its Drafter to be estimated with WithDeviceMetrics.
+//
+// Each step drafts DraftLength tokens by the drafter one by one,
+// then verifies them by the target model in one batch,
+// which costs about the same as decoding one token since the decoding is memory bound,
+// the expected generated tokens of each step is (1 - α^(γ+1)) / (1 - α),
+// see https://arxiv.org/abs/2211.17192.
+func (e LLaMACppRunEstimate) EstimateSpeculativeDecoding(acceptanceRate float64, draftLength uint64) (LLaMACppSpeculativeDecodingEstimate, error) {
+	var sd LLaMACppSpeculativeDecodingEstimate
+
+	if acceptanceRate < 0 || acceptanceRate > 1 {
+		return sd, fmt.Errorf("invalid acceptance rate %v, must be in [0, 1]", acceptanceRate)
+	}
+	if draftLength == 0 {
+		return sd, errors.New("invalid draft length 0")
+	}
+	if e.MaximumTokensPerSecond == nil || *e.MaximumTokensPerSecond <= 0 {
+		return sd, errors.New("target decode speed is not estimated, estimate with device metrics")
+	}
+	if e.Drafter == nil {
+		return sd, errors.New("drafter is not estimated")
+	}
+	if e.Drafter.MaximumTokensPerSecond == nil || *e.Drafter.MaximumTokensPerSecond <= 0 {
+		return sd, errors.New("drafter decode speed is not estimated, estimate with device metrics")
+	}
+
+	sd.AcceptanceRate = acceptanceRate
+	sd.DraftLength = draftLength
+	sd.TargetTokensPerSecond = *e.MaximumTokensPerSecond
+	sd.DrafterTokensPerSecond = *e.Drafter.MaximumTokensPerSecond
+
+	if acceptanceRate == 1 {
+		sd.AcceptedTokens = float64(draftLength + 1)
+	} else {
+		sd.AcceptedTokens = (1 - math.Pow(acceptanceRate, float64(draftLength+1))) / (1 - acceptanceRate)
+	}
+	lat := float64(draftLength)/float64(sd.DrafterTokensPerSecond) + 1/float64(sd.TargetTokensPerSecond)
+	sd.TokensPerSecond = GGUFTokensPerSecondScalar(sd.AcceptedTokens / lat)
+	sd.Speedup = float64(sd.TokensPerSecond) / float64(sd.TargetTokensPerSecond)
+
+	return sd, nil
+}
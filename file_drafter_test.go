@@ -0,0 +1,76 @@
+package gguf_parser
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gpustack/gguf-parser-go/util/ptr"
+)
+
+func TestCheckDrafterCompatibility(t *testing.T) {
+	model := func(tokenizer string, bos uint32, tokens ...string) *GGUFFile {
+		arr := make([]any, len(tokens))
+		for i := range tokens {
+			arr[i] = tokens[i]
+		}
+		gf := &GGUFFile{}
+		gf.Header.MetadataKV = GGUFMetadataKVs{
+			{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: tokenizer},
+			{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+				Type: GGUFMetadataValueTypeString, Len: uint64(len(arr)), Array: arr,
+			}},
+			{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: bos},
+			{Key: "tokenizer.ggml.eos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		}
+		return gf
+	}
+	tokens := []string{"<unk>", "<s>", "</s>", "<pad>", "<mask>", "a", "b", "c", "d"}
+
+	gp := CheckDrafterCompatibility(model("gpt2", 1, tokens...), model("gpt2", 1, tokens...))
+	if !gp.Compatible || gp.TokensCompared != 4 || gp.TokensMatched != 4 || gp.Overlap != 1 {
+		t.Errorf("expected compatible with full overlap, got %+v", gp)
+	}
+
+	gp = CheckDrafterCompatibility(model("gpt2", 1, tokens...), model("llama", 0, "<unk>", "<s>", "</s>", "<pad>", "<mask>", "a", "x", "c"))
+	if gp.Compatible || gp.TokensCompared != 3 || gp.TokensMatched != 2 {
+		t.Errorf("expected incompatible with partial overlap, got %+v", gp)
+	}
+	rules := map[string]bool{}
+	for _, m := range gp.Mismatches {
+		rules[m.Rule] = true
+	}
+	for _, r := range []string{"tokenizer-model", "bos-token", "token-text"} {
+		if !rules[r] {
+			t.Errorf("expected %s mismatch, got %v", r, gp.Mismatches)
+		}
+	}
+}
+
+func TestLLaMACppRunEstimate_EstimateSpeculativeDecoding(t *testing.T) {
+	e := LLaMACppRunEstimate{
+		MaximumTokensPerSecond: ptr.To(GGUFTokensPerSecondScalar(20)),
+		Drafter: &LLaMACppRunEstimate{
+			MaximumTokensPerSecond: ptr.To(GGUFTokensPerSecondScalar(200)),
+		},
+	}
+
+	sd, err := e.EstimateSpeculativeDecoding(0.8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (1 - 0.8^5) / (1 - 0.8) tokens per 4/200 + 1/20 seconds.
+	if math.Abs(sd.AcceptedTokens-3.3616) > 1e-9 {
+		t.Errorf("expected 3.3616 accepted tokens, got %v", sd.AcceptedTokens)
+	}
+	if math.Abs(float64(sd.TokensPerSecond)-48.0229) > 1e-3 || math.Abs(sd.Speedup-2.4011) > 1e-3 {
+		t.Errorf("expected 48.0229 tokens per second with 2.4011 speedup, got %v with %v", sd.TokensPerSecond, sd.Speedup)
+	}
+
+	if sd, _ = e.EstimateSpeculativeDecoding(0, 4); sd.Speedup >= 1 {
+		t.Errorf("expected slowdown without acceptance, got %v", sd.Speedup)
+	}
+
+	if _, err = (LLaMACppRunEstimate{}).EstimateSpeculativeDecoding(0.8, 4); err == nil {
+		t.Error("expected error without device metrics")
+	}
+}
@@ -1,6 +1,7 @@
 package gguf_parser
 
 import (
+	"fmt"
 	"math"
 	"regexp"
 	"slices"
@@ -57,6 +58,9 @@ type (
 		LogicalBatchSize int32 `json:"logicalBatchSize"`
 		// PhysicalBatchSize is the physical batch size.
 		PhysicalBatchSize int32 `json:"physicalBatchSize"`
+		// Warnings holds the options that llama.cpp refuses to apply,
+		// the estimate falls back to the ones that llama.cpp accepts.
+		Warnings []LLaMACppRunEstimateWarning `json:"warnings,omitempty"`
 		// Devices represents the usage for running the GGUF file,
 		// the first device is the CPU, and the rest are GPUs.
 		Devices []LLaMACppRunDeviceUsage `json:"devices"`
@@ -151,8 +155,20 @@ type (
 		// Output is the memory usage for output.
 		Output GGUFBytesScalar `json:"output"`
 	}
+
+	// LLaMACppRunEstimateWarning represents an option that llama.cpp refuses to apply.
+	LLaMACppRunEstimateWarning struct {
+		// Rule is the name of the violated rule, e.g. "value-cache-flash-attention".
+		Rule string `json:"rule"`
+		// Message describes the warning.
+		Message string `json:"message"`
+	}
 )
 
+func (w LLaMACppRunEstimateWarning) String() string {
+	return fmt.Sprintf("[%s] %s", w.Rule, w.Message)
+}
+
 // EstimateLLaMACppRun estimates the usages of the GGUF file in llama.cpp.
 func (gf *GGUFFile) EstimateLLaMACppRun(opts ...GGUFRunEstimateOption) (e LLaMACppRunEstimate) {
 	// Options
@@ -182,6 +198,9 @@ func (gf *GGUFFile) EstimateLLaMACppRun(opts ...GGUFRunEstimateOption) (e LLaMAC
 	if o.LMCOffloadKVCache == nil {
 		o.LMCOffloadKVCache = ptr.To(true)
 	}
+	if o.LMCUnifiedKVCache == nil {
+		o.LMCUnifiedKVCache = ptr.To(true)
+	}
 	if o.LMCLogicalBatchSize == nil {
 		o.LMCLogicalBatchSize = ptr.To(int32(2048))
 	} else {
@@ -203,13 +222,14 @@ func (gf *GGUFFile) EstimateLLaMACppRun(opts ...GGUFRunEstimateOption) (e LLaMAC
 	for i := range e.Devices {
 		e.Devices[i].HandleLastLayer = -1
 	}
+	rpcs := rpcServerOfDevices(o.RPCServers, o.RPCServerDevices)
 	for j := range e.Devices[1:] {
-		e.Devices[j+1].Remote = j < len(o.RPCServers)
+		e.Devices[j+1].Remote = j < len(rpcs)
 		if e.Devices[j+1].Remote {
 			e.Devices[j+1].Position = j
-			e.Devices[j+1].Endpoint = o.RPCServers[j]
+			e.Devices[j+1].Endpoint = rpcs[j]
 		} else {
-			e.Devices[j+1].Position = j - len(o.RPCServers)
+			e.Devices[j+1].Position = j - len(rpcs)
 		}
 	}
 
@@ -266,7 +286,26 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 	}
 
 	// Using sliding window attention.
-	usingSWA := a.AttentionSlidingWindowPattern != 1 && !o.LMCFullSizeSWACache
+	usingSWA := !o.LMCFullSizeSWACache &&
+		(a.AttentionSlidingWindowPattern != 1 || slices.Contains(a.AttentionSlidingWindowPerLayer, true))
+
+	// Using row split,
+	// the offloaded layers are handled by the main device,
+	// but the matrix weights of them are split by row across all devices.
+	// Since the split weights cannot be placed on the RPC servers,
+	// fallback to layer split if there are RPC servers.
+	rowSplit := o.LMCSplitMode == LLaMACppSplitModeRow && len(o.RPCServers) == 0 && len(o.TensorSplitFraction) > 1
+	rowSplitRange := func(j int, rows uint64) (low, high uint64) {
+		if j > 0 {
+			low = uint64(float64(rows) * o.TensorSplitFraction[j-1])
+		}
+		high = uint64(float64(rows) * o.TensorSplitFraction[j])
+		if j == len(o.TensorSplitFraction)-1 {
+			high = rows
+		}
+		return low, high
+	}
+	rowSplitRegex := regexp.MustCompile(`.*\.\d+\.(attn_(q|k|v|qkv|output|q_a|q_b|kv_a_mqa|kv_b)|ffn_(gate|up|down)(_shexp)?)\.weight`)
 
 	// Full offload: nLoadLayers == 0 && isOffloadOutputLayer
 	// Zero offload: nOffloadLayers == 0
@@ -276,9 +315,10 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		nActualOffloadLayers uint64
 		nLoadLayers          = a.BlockCount
 		idxOutputDevice      int
+		idxLayerDevices      = make([]int, a.BlockCount)
+		idxMainDevice        = o.MainGPUIndex + 1
 
-		fullOffload, zeroOffload          bool
-		nSWALoadLayers, nSWAOffloadLayers uint64
+		fullOffload, zeroOffload bool
 	)
 	{
 		var isOffloadOutputLayer bool
@@ -312,18 +352,20 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 			case i < nLoadLayers:
 				e.Devices[0].HandleLayers += 1
 				e.Devices[0].HandleLastLayer = int(i)
-				if usingSWA && (a.AttentionSlidingWindowPattern == 0 || i%uint64(a.AttentionSlidingWindowPattern) != 0) {
+				if usingSWA && a.LayerAttentionSlidingWindow(i) {
 					e.Devices[0].HandleSWALayers += 1
-					nSWALoadLayers += 1
 				}
 			case i >= offloadStart:
 				x := float64(i-offloadStart) / float64(nActualOffloadLayers)
 				j = slicex.UpperBound(o.TensorSplitFraction, x)
+				if rowSplit {
+					j = o.MainGPUIndex
+				}
+				idxLayerDevices[i] = j + 1
 				e.Devices[j+1].HandleLayers += 1
 				e.Devices[j+1].HandleLastLayer = int(i)
-				if usingSWA && (a.AttentionSlidingWindowPattern == 0 || i%uint64(a.AttentionSlidingWindowPattern) != 0) {
+				if usingSWA && a.LayerAttentionSlidingWindow(i) {
 					e.Devices[j+1].HandleSWALayers += 1
-					nSWAOffloadLayers += 1
 				}
 				if fullOffload && i == a.BlockCount-1 {
 					idxOutputDevice = j + 1
@@ -332,6 +374,20 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		}
 
 		e.Devices[idxOutputDevice].HandleOutputLayer = true
+
+		// The other devices hold the split rows of the offloaded layers.
+		if rowSplit && !zeroOffload {
+			md := e.Devices[idxMainDevice]
+			for j := range o.TensorSplitFraction {
+				if j == o.MainGPUIndex || o.TensorSplitFraction[j] == 0 ||
+					j > 0 && o.TensorSplitFraction[j] == o.TensorSplitFraction[j-1] {
+					continue
+				}
+				e.Devices[j+1].HandleLayers = md.HandleLayers
+				e.Devices[j+1].HandleSWALayers = md.HandleSWALayers
+				e.Devices[j+1].HandleLastLayer = md.HandleLastLayer
+			}
+		}
 	}
 
 	// Flash attention.
@@ -341,13 +397,45 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		if a.Architecture == "grok" {
 			o.FlashAttention = false
 		}
+
+		e.FlashAttention = o.FlashAttention
+	}
+
+	// Cache type.
+	{
+		warn := func(rule, format string, args ...any) {
+			e.Warnings = append(e.Warnings, LLaMACppRunEstimateWarning{Rule: rule, Message: fmt.Sprintf(format, args...)})
+		}
+		cts := []struct {
+			name string
+			typ  **GGMLType
+			hl   uint32
+		}{
+			{"key", &o.LMCCacheKeyType, a.AttentionKeyLength},
+			{"value", &o.LMCCacheValueType, a.AttentionValueLength},
+		}
+		for _, ct := range cts {
+			t := **ct.typ
+			// Fallback to FP16 if the type is not supported.
+			if !slices.Contains(_GGUFEstimateCacheTypeAllowList, t) {
+				warn("cache-type", "%s cache type %s is not supported, fallback to F16", ct.name, t)
+				*ct.typ = ptr.To(GGMLTypeF16)
+				continue
+			}
+			// Fallback to FP16 if the block size of the quantized type does not divide the head size,
+			// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-context.cpp, llama_init_from_model.
+			if tt, ok := t.Trait(); ok && tt.Quantized && ct.hl != 0 && uint64(ct.hl)%tt.BlockSize != 0 {
+				warn("cache-block-size", "%s cache type %s with block size %d does not divide the %s head size %d, fallback to F16",
+					ct.name, t, tt.BlockSize, ct.name, ct.hl)
+				*ct.typ = ptr.To(GGMLTypeF16)
+			}
+		}
 		// Fallback to FP16 if the value type is quantized when disabling flash attention,
 		// see https://github.com/ggerganov/llama.cpp/blob/19d3c8293b1f61acbe2dab1d49a17950fd788a4a/src/llama.cpp#L9576-L9579.
 		if o.LMCCacheValueType.IsQuantized() && !o.FlashAttention {
+			warn("value-cache-flash-attention", "quantized value cache type %s requires flash attention, fallback to F16", *o.LMCCacheValueType)
 			o.LMCCacheValueType = ptr.To(GGMLTypeF16)
 		}
-
-		e.FlashAttention = o.FlashAttention
 	}
 
 	// Embedding.
@@ -400,16 +488,25 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		nBatch   uint64
 		nOutputs uint64
 		nSeq     uint64
+		nStream  uint64
 		nKV      uint64
 	)
 	{
+		nSeq = uint64(ptr.Deref(o.ParallelSize, 1))
+
 		nContext = a.MaximumContextLength
 		if o.LMCContextSize != nil {
 			nContext = uint64(*o.LMCContextSize)
 		}
+		if o.LMCSlotContextSize != nil {
+			nContext = uint64(*o.LMCSlotContextSize)
+		}
 		if o.LMCInMaxContextSize {
 			nContext = min(nContext, a.MaximumContextLength)
 		}
+		if o.LMCSlotContextSize != nil {
+			nContext *= nSeq
+		}
 		// Padding context size,
 		// see https://github.com/ggerganov/llama.cpp/blob/278d0e18469aacf505be18ce790a63c7cc31be26/src/llama.cpp#L19001-L19002.
 		nContext = GGMLPadding(nContext, paddingAlign)
@@ -419,8 +516,17 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		nTokens = min(nContext, uint64(*o.LMCPhysicalBatchSize))
 		nBatch = nTokens
 		nOutputs = nTokens
-		nSeq = uint64(ptr.Deref(o.ParallelSize, 1))
-		nKV = nContext
+
+		// Without unified KV cache,
+		// each sequence caches in its own stream,
+		// and attends to the cells of its stream only.
+		nStream = 1
+		if !*o.LMCUnifiedKVCache {
+			nStream = nSeq
+		}
+		// Padding the context size of each stream,
+		// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-kv-cache.cpp, llama_kv_cache::get_padding.
+		nKV = GGMLPadding(nContext/nStream, paddingAlign)
 
 		e.ContextSize = nContext
 	}
@@ -521,10 +627,29 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				x := float64(i-offloadStart) / float64(nActualOffloadLayers)
 				j = slicex.UpperBound(o.TensorSplitFraction, x)
 				idx = j + 1
+				if rowSplit {
+					idx = idxMainDevice
+				}
 			}
 			f := filter(idx)
-			e.Devices[idx].Weight.Compute += GGUFBytesScalar(tfLs[i].Bytes(f))
-			e.Devices[idx].Parameter.Compute += GGUFParametersScalar(tfLs[i].Elements(f))
+			wg, ps := tfLs[i].Bytes(f), tfLs[i].Elements(f)
+			if rowSplit && idx != 0 {
+				for _, l := range tfLs[i].Search(rowSplitRegex) {
+					if l.NDimensions != 2 || l.Bytes(f) == 0 {
+						continue
+					}
+					wg -= l.Bytes()
+					ps -= l.Elements()
+					rs := l.Type.RowSizeOf([]uint64{l.Dimensions[0]})
+					for j := range o.TensorSplitFraction {
+						low, high := rowSplitRange(j, l.Dimensions[1])
+						e.Devices[j+1].Weight.Compute += GGUFBytesScalar(rs * (high - low))
+						e.Devices[j+1].Parameter.Compute += GGUFParametersScalar(l.Dimensions[0] * (high - low))
+					}
+				}
+			}
+			e.Devices[idx].Weight.Compute += GGUFBytesScalar(wg)
+			e.Devices[idx].Parameter.Compute += GGUFParametersScalar(ps)
 		}
 
 		// IO,
@@ -577,10 +702,11 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				e.Devices[0].KVCache.Value += GGUFBytesScalar(srs * nOffloadLayers)
 				e.Devices[0].Parameter.KVCache += GGUFParametersScalar((rrs + srs) * nOffloadLayers)
 			} else if !zeroOffload {
-				for i, d := range e.Devices[1:] {
-					e.Devices[i+1].KVCache.Key += GGUFBytesScalar(rrs * d.HandleLayers)
-					e.Devices[i+1].KVCache.Value += GGUFBytesScalar(srs * d.HandleLayers)
-					e.Devices[i+1].Parameter.KVCache += GGUFParametersScalar((rrs + srs) * d.HandleLayers)
+				for i := nLoadLayers; i < a.BlockCount; i++ {
+					idx := idxLayerDevices[i]
+					e.Devices[idx].KVCache.Key += GGUFBytesScalar(rrs)
+					e.Devices[idx].KVCache.Value += GGUFBytesScalar(srs)
+					e.Devices[idx].Parameter.KVCache += GGUFParametersScalar(rrs + srs)
 				}
 			}
 
@@ -593,52 +719,39 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		// see https://github.com/ggml-org/llama.cpp/blob/d6ef0e77dd25f54fb5856af47e3926cf6f36c281/llama.cpp#L2479-L2501.
 		default:
 			akl, avl := uint64(a.AttentionKeyLength), uint64(a.AttentionValueLength)
+			// MLA caches the compressed key and value as one key head,
+			// and views the value from the key,
+			// so there is no value cache.
 			if a.AttentionKeyLengthMLA > 0 && a.AttentionValueLengthMLA > 0 {
-				akl, avl = uint64(a.AttentionKeyLengthMLA), uint64(a.AttentionValueLengthMLA)
+				avl = 0
 			}
-			kGQA := akl * a.AttentionHeadCountKV
-			vGQA := avl * a.AttentionHeadCountKV
-			kps, vps := kGQA*nKV, vGQA*nKV
-			krs, vrs := o.LMCCacheKeyType.RowSizeOf([]uint64{kps}), o.LMCCacheValueType.RowSizeOf([]uint64{vps})
-
-			if !usingSWA {
-				e.Devices[0].KVCache.Key += GGUFBytesScalar(krs * nLoadLayers)
-				e.Devices[0].KVCache.Value += GGUFBytesScalar(vrs * nLoadLayers)
-				e.Devices[0].Parameter.KVCache += GGUFParametersScalar((kps + vps) * nLoadLayers)
-				if !*o.LMCOffloadKVCache {
-					e.Devices[0].KVCache.Key += GGUFBytesScalar(krs * nOffloadLayers)
-					e.Devices[0].KVCache.Value += GGUFBytesScalar(vrs * nOffloadLayers)
-					e.Devices[0].Parameter.KVCache += GGUFParametersScalar((kps + vps) * nOffloadLayers)
-				} else if !zeroOffload {
-					for i, d := range e.Devices[1:] {
-						e.Devices[i+1].KVCache.Key += GGUFBytesScalar(krs * d.HandleLayers)
-						e.Devices[i+1].KVCache.Value += GGUFBytesScalar(vrs * d.HandleLayers)
-						e.Devices[i+1].Parameter.KVCache += GGUFParametersScalar((kps + vps) * d.HandleLayers)
-					}
+			// Sliding window attention size,
+			// see https://github.com/ggml-org/llama.cpp/blob/3079e9ac8e04ef6eddeb0c164d72edb6b6fd2df5/src/llama-kv-cache.cpp#L1640-L1642.
+			swas := min(nKV, GGMLPadding(a.AttentionSlidingWindow*(nSeq/nStream)+uint64(*o.LMCLogicalBatchSize), paddingAlign))
+
+			// Since the attention heads may vary between layers,
+			// e.g. OpenELM, DeciLM, we calculate the KV cache layer by layer.
+			for i := uint64(0); i < a.BlockCount; i++ {
+				nHeadKV := a.LayerAttentionHeadCountKV(i)
+				if nHeadKV == 0 {
+					// No attention or recurrent layer.
+					continue
 				}
-			} else {
-				// Sliding window attention size,
-				// see https://github.com/ggml-org/llama.cpp/blob/3079e9ac8e04ef6eddeb0c164d72edb6b6fd2df5/src/llama-kv-cache.cpp#L1640-L1642.
-				swas := min(nKV, GGMLPadding(a.AttentionSlidingWindow*nSeq+uint64(*o.LMCLogicalBatchSize), paddingAlign))
-				swaKps, swaVps := kGQA*swas, vGQA*swas
-				swaKrs, swaVrs := o.LMCCacheKeyType.RowSizeOf([]uint64{swaKps}), o.LMCCacheValueType.RowSizeOf([]uint64{swaVps})
-
-				nNonSWALoadLayers, nNonSWAOffloadLayers := nLoadLayers-nSWALoadLayers, nOffloadLayers-nSWAOffloadLayers
-
-				e.Devices[0].KVCache.Key += GGUFBytesScalar(swaKrs*nSWALoadLayers + krs*nNonSWALoadLayers)
-				e.Devices[0].KVCache.Value += GGUFBytesScalar(swaVrs*nSWALoadLayers + vrs*nNonSWALoadLayers)
-				e.Devices[0].Parameter.KVCache += GGUFParametersScalar((swaKps+swaVps)*nSWALoadLayers + (kps+vps)*nNonSWALoadLayers)
-				if !*o.LMCOffloadKVCache {
-					e.Devices[0].KVCache.Key += GGUFBytesScalar(swaKrs*nSWAOffloadLayers + krs*nNonSWAOffloadLayers)
-					e.Devices[0].KVCache.Value += GGUFBytesScalar(swaVrs*nSWAOffloadLayers + vrs*nNonSWAOffloadLayers)
-					e.Devices[0].Parameter.KVCache += GGUFParametersScalar((swaKps+swaVps)*nSWAOffloadLayers + (kps+vps)*nNonSWAOffloadLayers)
-				} else if !zeroOffload {
-					for i, d := range e.Devices[1:] {
-						e.Devices[i+1].KVCache.Key += GGUFBytesScalar(swaKrs*d.HandleSWALayers + krs*(d.HandleLayers-d.HandleSWALayers))
-						e.Devices[i+1].KVCache.Value += GGUFBytesScalar(swaVrs*d.HandleSWALayers + vrs*(d.HandleLayers-d.HandleSWALayers))
-						e.Devices[i+1].Parameter.KVCache += GGUFParametersScalar((swaKps+swaVps)*d.HandleSWALayers + (kps+vps)*(d.HandleLayers-d.HandleSWALayers))
-					}
+				kvs := nKV
+				if usingSWA && a.LayerAttentionSlidingWindow(i) {
+					kvs = swas
 				}
+				kps, vps := akl*nHeadKV*kvs, avl*nHeadKV*kvs
+				krs, vrs := o.LMCCacheKeyType.RowSizeOf([]uint64{kps}), o.LMCCacheValueType.RowSizeOf([]uint64{vps})
+				kps, vps, krs, vrs = kps*nStream, vps*nStream, krs*nStream, vrs*nStream
+
+				idx := 0
+				if *o.LMCOffloadKVCache {
+					idx = idxLayerDevices[i]
+				}
+				e.Devices[idx].KVCache.Key += GGUFBytesScalar(krs)
+				e.Devices[idx].KVCache.Value += GGUFBytesScalar(vrs)
+				e.Devices[idx].Parameter.KVCache += GGUFParametersScalar(kps + vps)
 			}
 		}
 	}
@@ -687,15 +800,22 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 			} else {
 				v = GGUFBytesScalar(inpEmbd + inpPos + inpKQMask)
 			}
-			if len(o.RPCServers) == 0 && len(o.TensorSplitFraction) > 1 {
-				if a.ExpertCount > 0 {
-					v *= 2
-				} else {
-					v *= 4
+			switch {
+			case rowSplit:
+				// Only the main device computes the graph,
+				// and pipeline parallelism is disabled.
+				e.Devices[idxMainDevice].Computation.Input += v
+			default:
+				if len(o.RPCServers) == 0 && len(o.TensorSplitFraction) > 1 {
+					if a.ExpertCount > 0 {
+						v *= 2
+					} else {
+						v *= 4
+					}
+				}
+				for i := range e.Devices[1:] {
+					e.Devices[i+1].Computation.Input += v
 				}
-			}
-			for i := range e.Devices[1:] {
-				e.Devices[i+1].Computation.Input += v
 			}
 		}
 		// Since the steps between transformer layers are serial,
@@ -757,69 +877,89 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				}
 			}
 		} else {
+			// Since the attention heads and feed-forward length may vary between layers,
+			// e.g. OpenELM, DeciLM, we consider the usage of the largest one.
+			var nHead, nHeadKV uint64
+			for i := uint64(0); i < a.BlockCount; i++ {
+				nHead = max(nHead, a.LayerAttentionHeadCount(i))
+				nHeadKV = max(nHeadKV, a.LayerAttentionHeadCountKV(i))
+			}
 			loadAttnInc, offloadAttnInc := uint64(0), uint64(0)
 			{
-				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, a.AttentionHeadCountKV})
+				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, nHeadKV})
 				loadAttnInc = rs // k-?
-				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, a.AttentionHeadCountKV})
+				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, nHeadKV})
 				loadAttnInc += rs // v-?
 			}
+			attnRegex := regexp.MustCompile(`.*\.\d+\.attn_(norm|q|qkv|q_b)\.weight`)
 			if o.FlashAttention {
-				// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L7387.
-				offloadAttnInc = GGMLTypeF16.RowSizeOf([]uint64{nKV, nTokens})
-				for _, l := range tfLs[len(tfLs)-1].Search(regexp.MustCompile(`.*\.\d+\.attn_(norm|q|qkv|q_b)\.weight`)) {
-					if strings.HasSuffix(l.Name, ".attn_norm.weight") {
-						rs := GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
-						offloadAttnInc += rs
-						continue
+				for i := range tfLs {
+					// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L7387.
+					inc := GGMLTypeF16.RowSizeOf([]uint64{nKV, nTokens})
+					for _, l := range tfLs[i].Search(attnRegex) {
+						if strings.HasSuffix(l.Name, ".attn_norm.weight") {
+							rs := GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
+							inc += rs
+							continue
+						}
+						rs := l.Bytes()
+						inc += rs
 					}
-					rs := l.Bytes()
-					offloadAttnInc += rs
+					offloadAttnInc = max(offloadAttnInc, inc)
 				}
 				// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L6986-L6992.
-				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, a.AttentionHeadCountKV})
+				rs := o.LMCCacheKeyType.RowSizeOf([]uint64{uint64(a.AttentionKeyLength), nKV, nHeadKV})
 				offloadAttnInc += rs
 				// https://github.com/ggerganov/llama.cpp/blob/172c8256840ffd882ab9992ecedbb587d9b21f15/llama.cpp#L7000-L7007.
-				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, a.AttentionHeadCountKV})
+				rs = o.LMCCacheValueType.RowSizeOf([]uint64{uint64(a.AttentionValueLength), nKV, nHeadKV})
 				offloadAttnInc += rs
 			} else {
 				offloadAttnInc = uint64(0)
-				for _, l := range tfLs[len(tfLs)-1].Search(regexp.MustCompile(`.*\.\d+\.attn_(norm|q|qkv|q_b)\.weight`)) {
-					var rs uint64
-					switch {
-					default: // norm.
-						rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
-						offloadAttnInc += rs
-					case strings.HasSuffix(l.Name, ".attn_q.weight"):
-						rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[0], nTokens})
-						offloadAttnInc += rs * 2 // Qcur.
-						rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, a.AttentionHeadCount})
-						offloadAttnInc += rs // kq.
-						if !zeroOffload && !fullOffload {
-							offloadAttnInc += loadAttnInc
+				for i := range tfLs {
+					inc := uint64(0)
+					for _, l := range tfLs[i].Search(attnRegex) {
+						var rs uint64
+						switch {
+						default: // norm.
+							rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
+							inc += rs
+						case strings.HasSuffix(l.Name, ".attn_q.weight"):
+							rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[0], nTokens})
+							inc += rs * 2 // Qcur.
+							rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, nHead})
+							inc += rs // kq.
+							if !zeroOffload && !fullOffload {
+								inc += loadAttnInc
+							}
+						case strings.HasSuffix(l.Name, ".attn_qkv.weight"):
+							rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[0], nTokens})
+							inc += rs * 2 // Qcur.
+							rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, nHead})
+							inc += rs // kq.
+							rs = GGMLTypeF32.RowSizeOf([]uint64{a.EmbeddingLength, a.EmbeddingLength * 3})
+							inc += rs // wqkv.
+							if !zeroOffload && !fullOffload {
+								inc += loadAttnInc
+							}
+						case strings.HasSuffix(l.Name, ".attn_q_b.weight"):
+							rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
+							inc += rs * 2 // q-?
+							rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, nHead})
+							inc += rs // kq.
 						}
-					case strings.HasSuffix(l.Name, ".attn_qkv.weight"):
-						rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[0], nTokens})
-						offloadAttnInc += rs * 2 // Qcur.
-						rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, a.AttentionHeadCount})
-						offloadAttnInc += rs // kq.
-						rs = GGMLTypeF32.RowSizeOf([]uint64{a.EmbeddingLength, a.EmbeddingLength * 3})
-						offloadAttnInc += rs // wqkv.
-						if !zeroOffload && !fullOffload {
-							offloadAttnInc += loadAttnInc
-						}
-					case strings.HasSuffix(l.Name, ".attn_q_b.weight"):
-						rs = GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
-						offloadAttnInc += rs * 2 // q-?
-						rs = GGMLTypeF32.RowSizeOf([]uint64{nKV, nTokens, a.AttentionHeadCount})
-						offloadAttnInc += rs // kq.
 					}
+					offloadAttnInc = max(offloadAttnInc, inc)
 				}
 			}
 			ffnInc := uint64(0)
-			for _, l := range tfLs[len(tfLs)-1].Search(regexp.MustCompile(`.*\.\d+\.(attn_norm|ffn_norm|ffn_gate|ffn_up)\.weight`)) {
-				rs := GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
-				ffnInc += rs
+			ffnRegex := regexp.MustCompile(`.*\.\d+\.(attn_norm|ffn_norm|ffn_gate|ffn_up)\.weight`)
+			for i := range tfLs {
+				inc := uint64(0)
+				for _, l := range tfLs[i].Search(ffnRegex) {
+					rs := GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[l.NDimensions-1], nTokens})
+					inc += rs
+				}
+				ffnInc = max(ffnInc, inc)
 			}
 			if a.ExpertCount > 0 || a.ExpertUsedCount > 0 {
 				rs := GGMLTypeF32.RowSizeOf([]uint64{uint64(a.ExpertCount), a.EmbeddingLength})
@@ -841,7 +981,7 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				}
 				if nLoadLayers > 1 {
 					for i := range e.Devices[1:] {
-						if e.Devices[i+1].Remote {
+						if e.Devices[i+1].Remote || rowSplit && i+1 != idxMainDevice {
 							continue
 						}
 						e.Devices[i+1].Computation.Compute += GGUFBytesScalar(loadAttnInc)
@@ -850,6 +990,35 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 				}
 			}
 		}
+		// The other devices of row split only compute the split rows of the matrix multiplications,
+		// which copy the input activations and hold the partial results.
+		if rowSplit {
+			for j := range o.TensorSplitFraction {
+				if j == o.MainGPUIndex {
+					continue
+				}
+				e.Devices[j+1].Computation.Compute = 0
+				if zeroOffload {
+					continue
+				}
+				var inc uint64
+				for i := range tfLs {
+					for _, l := range tfLs[i].Search(rowSplitRegex) {
+						if l.NDimensions != 2 {
+							continue
+						}
+						low, high := rowSplitRange(j, l.Dimensions[1])
+						if low == high {
+							continue
+						}
+						rs := GGMLTypeF32.RowSizeOf([]uint64{l.Dimensions[0], nTokens})
+						rs += GGMLTypeF32.RowSizeOf([]uint64{high - low, nTokens})
+						inc = max(inc, rs)
+					}
+				}
+				e.Devices[j+1].Computation.Compute = GGUFBytesScalar(inc)
+			}
+		}
 		// Finally, get the usage of output layer.
 		if a.AttentionCausal {
 			var outInc uint64
@@ -903,8 +1072,15 @@ func (gf *GGUFFile) estimateLLaMACppRunInModel(o *_GGUFRunEstimateOptions, a *GG
 		lt := float64(0)
 		ltmax := slices.Max(ltss)
 		for i := range ltss {
+			if rowSplit && i > 0 {
+				continue
+			}
 			lt += ltss[i] / ltmax * ltss[i]
 		}
+		if rowSplit {
+			// The devices compute the split rows in parallel.
+			lt += slices.Max(ltss[1:])
+		}
 		e.MaximumTokensPerSecond = ptr.To(GGUFTokensPerSecondScalar(1 / lt))
 	}
 }
@@ -1122,15 +1298,7 @@ func (gf *GGUFFile) estimateLLaMACppRunInProjector(o *_GGUFRunEstimateOptions, a
 				projectionDim = ti.Dimensions[1]
 			}
 		case "pixtral":
-			heightPatchSize := heightMaxSize / uint64(a.ClipVisionPatchSize)
-			if a.ClipVisionSpatialMergeSize > 0 {
-				heightPatchSize /= uint64(a.ClipVisionSpatialMergeSize)
-			}
-			widthPatchSize := widthMaxSize / uint64(a.ClipVisionPatchSize)
-			if a.ClipVisionSpatialMergeSize > 0 {
-				widthPatchSize /= uint64(a.ClipVisionSpatialMergeSize)
-			}
-			nPatches = heightPatchSize*widthPatchSize + heightPatchSize - 1 /* [IMG_BREAK] per row */
+			nPatches, _ = a.clipImageGridTokens(widthMaxSize, heightMaxSize, true)
 			if ti, ok := gf.TensorInfos.Get("mm.2.bias"); ok {
 				projectionDim = ti.Dimensions[0]
 			}
@@ -1165,29 +1333,13 @@ func (gf *GGUFFile) estimateLLaMACppRunInProjector(o *_GGUFRunEstimateOptions, a
 				}
 				heightMaxSize = ms
 				widthMaxSize = ms
-				heightPatchSize := (heightMaxSize + nPatchSize - 1) / nPatchSize
-				widthPatchSize := (widthMaxSize + nPatchSize - 1) / nPatchSize
 				// Honor the patch reduction the metadata declares,
 				// like llama.cpp does for every projector type carrying it,
 				// rounding up so the estimate never undercounts.
 				//
 				// This reduces the projector's output tokens, not the encoder's positions:
 				// the merge happens after the vision transformer.
-				merge := uint64(1)
-				if a.ClipVisionSpatialMergeSize > 1 {
-					merge = uint64(a.ClipVisionSpatialMergeSize)
-				} else if a.ClipVisionProjectorScaleFactor > 1 {
-					merge = uint64(a.ClipVisionProjectorScaleFactor)
-				}
-				if merge > 1 {
-					heightPatchSize = (heightPatchSize + merge - 1) / merge
-					widthPatchSize = (widthPatchSize + merge - 1) / merge
-					nPatchesMerged = merge * merge
-				}
-				nPatches = heightPatchSize * widthPatchSize
-				if _, ok := gf.TensorInfos.Get("v.token_embd.img_break"); ok && heightPatchSize > 0 {
-					nPatches += heightPatchSize - 1 /* [IMG_BREAK] per row */
-				}
+				nPatches, nPatchesMerged = a.clipImageGridTokens(widthMaxSize, heightMaxSize, a.ClipVisionHasImageBreak)
 				projectionDim = uint64(a.ClipVisionProjectionDim)
 			}
 		}
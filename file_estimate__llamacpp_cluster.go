@@ -0,0 +1,315 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Types for the cluster topology.
+type (
+	// GGUFRunClusterTopology represents the topology of a cluster to run the GGUF file,
+	// which consists of nodes and the network links between them.
+	GGUFRunClusterTopology struct {
+		// Nodes holds the nodes of the cluster,
+		// the first node is the main node that runs llama.cpp,
+		// the rest nodes serve as RPC servers.
+		Nodes []GGUFRunClusterNode `json:"nodes"`
+		// Links holds the network links between the nodes,
+		// a link is bidirectional.
+		Links []GGUFRunClusterLink `json:"links"`
+	}
+
+	// GGUFRunClusterNode represents a node of the cluster.
+	GGUFRunClusterNode struct {
+		// Name is the unique name of the node.
+		Name string `json:"name"`
+		// Endpoint is the endpoint of the RPC server of the node,
+		// ignored for the main node.
+		Endpoint string `json:"endpoint,omitempty"`
+		// Host is the metric of the CPU and RAM of the node.
+		Host GGUFRunDeviceMetric `json:"host"`
+		// RAM is the available RAM of the node,
+		// which is only used to split the layers to the RPC node without GPUs.
+		RAM GGUFBytesScalar `json:"ram,omitempty"`
+		// GPUs holds the GPUs of the node,
+		// the RPC node without GPUs serves with its CPU and RAM.
+		GPUs []GGUFRunClusterGPU `json:"gpus,omitempty"`
+	}
+
+	// GGUFRunClusterGPU represents a GPU of a node.
+	GGUFRunClusterGPU struct {
+		// Metric is the metric of the GPU.
+		Metric GGUFRunDeviceMetric `json:"metric"`
+		// VRAM is the available VRAM of the GPU,
+		// the layers are split in proportion to it like llama.cpp splits by the free memory,
+		// or evenly if any GPU does not specify.
+		VRAM GGUFBytesScalar `json:"vram,omitempty"`
+	}
+
+	// GGUFRunClusterLink represents a network link between two nodes.
+	GGUFRunClusterLink struct {
+		// From is the name of a node.
+		From string `json:"from"`
+		// To is the name of another node.
+		To string `json:"to"`
+		// Bandwidth is the bandwidth of the link,
+		// unit is Bps (bytes per second).
+		Bandwidth BytesPerSecondScalar `json:"bandwidth"`
+		// Latency is the one-way latency of the link.
+		Latency time.Duration `json:"latency"`
+	}
+)
+
+// Types for the estimate in a cluster.
+type (
+	// LLaMACppClusterRunEstimate represents the estimated result of running the GGUF file in a cluster.
+	LLaMACppClusterRunEstimate struct {
+		// Estimate is the estimated result of the devices,
+		// the remote devices come first, followed by the GPUs of the main node.
+		Estimate LLaMACppRunEstimate `json:"estimate"`
+		// Nodes holds the usages of each node, in the order of GGUFRunClusterTopology.Nodes.
+		Nodes []LLaMACppClusterNodeUsage `json:"nodes"`
+		// Hops holds the activation transfers between nodes to decode one token,
+		// in the order of the pipeline.
+		Hops []LLaMACppClusterHop `json:"hops,omitempty"`
+		// TokensPerSecond is the end-to-end decode speed of one sequence.
+		TokensPerSecond GGUFTokensPerSecondScalar `json:"tokensPerSecond"`
+	}
+
+	// LLaMACppClusterNodeUsage represents the usage of a node in the cluster.
+	LLaMACppClusterNodeUsage struct {
+		// Name is the name of the node.
+		Name string `json:"name"`
+		// HandleLayers is the number of layers that the node handles.
+		HandleLayers uint64 `json:"handleLayers"`
+		// RAM is the memory usage of the node in RAM,
+		// for the RPC node with GPUs, it is counted as the GPUs share the memory with the host, e.g. Apple Silicon.
+		RAM GGUFBytesScalar `json:"ram"`
+		// VRAMs is the memory usage of each GPU of the node.
+		VRAMs []GGUFBytesScalar `json:"vrams,omitempty"`
+		// ComputeLatency is the latency of the node to decode one token.
+		ComputeLatency time.Duration `json:"computeLatency"`
+	}
+
+	// LLaMACppClusterHop represents an activation transfer between two nodes.
+	LLaMACppClusterHop struct {
+		// From is the name of the source node.
+		From string `json:"from"`
+		// To is the name of the destination node.
+		To string `json:"to"`
+		// Bytes is the size of the transferred data.
+		Bytes GGUFBytesScalar `json:"bytes"`
+		// Latency is the latency of the transfer.
+		Latency time.Duration `json:"latency"`
+	}
+)
+
+// EstimateLLaMACppRunInCluster estimates the usages of the GGUF file in llama.cpp running in the given cluster,
+// the WithRPCServers, WithRPCServerDevices, WithTensorSplitFraction and WithDeviceMetrics options are derived from the topology.
+//
+// The layers are pipelined through the GPUs of the RPC nodes in order, then the GPUs of the main node,
+// the non-offloaded layers run on the main node first.
+// The RPC node without GPUs serves its CPU as one device, like rpc-server runs with the CPU backend.
+// Since ggml-rpc copies tensors between different RPC servers through the main node,
+// the activation between two RPC nodes transfers twice.
+// The transfers between the GPUs of the same node are not counted.
+//
+// The memory usages are summarized with mmap.
+func (gf *GGUFFile) EstimateLLaMACppRunInCluster(topo GGUFRunClusterTopology, opts ...GGUFRunEstimateOption) (ce LLaMACppClusterRunEstimate, err error) {
+	ns := topo.Nodes
+	if len(ns) == 0 {
+		return ce, errors.New("cluster has no nodes")
+	}
+	idx := make(map[string]int, len(ns))
+	for i, n := range ns {
+		if n.Name == "" {
+			return ce, fmt.Errorf("node %d has no name", i)
+		}
+		if _, ok := idx[n.Name]; ok {
+			return ce, fmt.Errorf("duplicate node %q", n.Name)
+		}
+		if i > 0 && n.Endpoint == "" {
+			return ce, fmt.Errorf("rpc node %q has no endpoint", n.Name)
+		}
+		idx[n.Name] = i
+	}
+	type link struct {
+		bw  BytesPerSecondScalar
+		lat time.Duration
+	}
+	ls := make(map[[2]int]link, len(topo.Links))
+	for _, l := range topo.Links {
+		f, fok := idx[l.From]
+		t, tok := idx[l.To]
+		if !fok || !tok {
+			return ce, fmt.Errorf("link %q - %q refers to unknown node", l.From, l.To)
+		}
+		ls[[2]int{f, t}] = link{l.Bandwidth, l.Latency}
+		ls[[2]int{t, f}] = link{l.Bandwidth, l.Latency}
+	}
+
+	// Devices, RPC nodes first.
+	var (
+		devNodes = []int{0} // CPU of the main node.
+		rpcs     []string
+		rpcDevs  []int
+		dms      = []GGUFRunDeviceMetric{ns[0].Host}
+		vrams    []GGUFBytesScalar
+	)
+	for i := range ns {
+		i = (i + 1) % len(ns)
+		gs := ns[i].GPUs
+		if i != 0 {
+			if len(gs) == 0 {
+				gs = []GGUFRunClusterGPU{{Metric: ns[i].Host, VRAM: ns[i].RAM}}
+			}
+			rpcs = append(rpcs, ns[i].Endpoint)
+			rpcDevs = append(rpcDevs, len(gs))
+		}
+		for _, g := range gs {
+			devNodes = append(devNodes, i)
+			dms = append(dms, g.Metric)
+			vrams = append(vrams, g.VRAM)
+		}
+	}
+	eopts := opts[:len(opts):len(opts)]
+	if len(vrams) != 0 {
+		eopts = append(eopts,
+			WithRPCServers(rpcs),
+			WithRPCServerDevices(rpcDevs),
+			WithTensorSplitFraction(clusterTensorSplitFraction(vrams)))
+	} else {
+		// Run on the CPU of the main node only.
+		devNodes = append(devNodes, 0)
+		dms = append(dms, ns[0].Host)
+		eopts = append(eopts, WithLLaMACppOffloadLayers(0))
+	}
+	eopts = append(eopts, WithDeviceMetrics(dms))
+
+	ce.Estimate = gf.EstimateLLaMACppRun(eopts...)
+	ds := ce.Estimate.Devices
+	if len(ds) != len(devNodes) {
+		return ce, fmt.Errorf("estimated %d devices, but cluster has %d", len(ds), len(devNodes))
+	}
+
+	// Memory.
+	emi := ce.Estimate.SummarizeItem(true, 0, 0)
+	ce.Nodes = make([]LLaMACppClusterNodeUsage, len(ns))
+	for i := range ns {
+		ce.Nodes[i].Name = ns[i].Name
+	}
+	ce.Nodes[0].RAM = emi.RAM.NonUMA
+	for i := range ds {
+		n := &ce.Nodes[devNodes[i]]
+		n.HandleLayers += ds[i].HandleLayers
+		if i == 0 || len(vrams) == 0 {
+			continue
+		}
+		switch {
+		case devNodes[i] == 0:
+			n.VRAMs = append(n.VRAMs, emi.VRAMs[i-1].NonUMA)
+		case len(ns[devNodes[i]].GPUs) == 0:
+			// The CPU of the RPC node.
+			n.RAM += emi.VRAMs[i-1].NonUMA
+		default:
+			n.RAM += emi.VRAMs[i-1].UMA
+			n.VRAMs = append(n.VRAMs, emi.VRAMs[i-1].NonUMA)
+		}
+	}
+
+	// Latency.
+	a := gf.Architecture()
+	var (
+		total float64
+		cur   int // The activation starts from the main node.
+	)
+	hop := func(f, t int, bs uint64) error {
+		l, ok := ls[[2]int{f, t}]
+		if !ok || l.bw == 0 {
+			return fmt.Errorf("no link between %q and %q", ns[f].Name, ns[t].Name)
+		}
+		lat := float64(bs)/float64(l.bw) + l.lat.Seconds()
+		ce.Hops = append(ce.Hops, LLaMACppClusterHop{
+			From:    ns[f].Name,
+			To:      ns[t].Name,
+			Bytes:   GGUFBytesScalar(bs),
+			Latency: time.Duration(lat * float64(time.Second)),
+		})
+		total += lat
+		return nil
+	}
+	transfer := func(t int, bs uint64) error {
+		if cur == t {
+			return nil
+		}
+		if cur != 0 && t != 0 {
+			// Relay through the main node.
+			if err := hop(cur, 0, bs); err != nil {
+				return err
+			}
+			cur = 0
+		}
+		if err := hop(cur, t, bs); err != nil {
+			return err
+		}
+		cur = t
+		return nil
+	}
+	acts := GGMLTypeF32.RowSizeOf([]uint64{a.EmbeddingLength})
+	for i, d := range ds {
+		if d.HandleLayers == 0 && !d.HandleOutputLayer {
+			continue
+		}
+		if err = transfer(devNodes[i], acts); err != nil {
+			return ce, err
+		}
+		dm := dms[i]
+		fl, bw := float64(max(dm.FLOPS, 1)), float64(max(dm.UpBandwidth, 1))
+		ps := float64(d.Parameter.Compute+d.Parameter.ComputeOverridden+d.Parameter.Output) * 2 /* FMA */
+		ws := float64(d.Weight.Compute + d.Weight.ComputeOverridden + d.Weight.Output)
+		kvps := float64(d.Parameter.KVCache) * 2 /* FMA */
+		kvs := float64(d.KVCache.Sum())
+		lat := max(ps/fl, ws/bw) + max(kvps/fl, kvs/bw)
+		ce.Nodes[devNodes[i]].ComputeLatency += time.Duration(lat * float64(time.Second))
+		total += lat
+	}
+	// The logits return to the main node.
+	if err = transfer(0, GGMLTypeF32.RowSizeOf([]uint64{a.VocabularyLength})); err != nil {
+		return ce, err
+	}
+	if total > 0 {
+		ce.TokensPerSecond = GGUFTokensPerSecondScalar(1 / total)
+	}
+
+	return ce, nil
+}
+
+// clusterTensorSplitFraction returns the cumulative fractions in proportion to the given VRAMs,
+// or evenly if any VRAM is zero.
+func clusterTensorSplitFraction(vrams []GGUFBytesScalar) []float64 {
+	ws := make([]float64, len(vrams))
+	var sum float64
+	for i, v := range vrams {
+		if v == 0 {
+			sum = 0
+			break
+		}
+		ws[i] = float64(v)
+		sum += ws[i]
+	}
+	if sum == 0 {
+		for i := range ws {
+			ws[i] = 1
+		}
+		sum = float64(len(ws))
+	}
+	fs := make([]float64, len(ws))
+	var acc float64
+	for i := range ws {
+		acc += ws[i]
+		fs[i] = acc / sum
+	}
+	fs[len(fs)-1] = 1
+	return fs
+}
@@ -0,0 +1,102 @@
+package gguf_parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGGUFFile_EstimateLLaMACppRunInCluster(t *testing.T) {
+	gf := testQuantizeGGUFFile(9)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1024)})
+	gf.Size = gf.ModelSize
+	opts := []GGUFRunEstimateOption{
+		WithLLaMACppContextSize(1024),
+		WithLLaMACppLogicalBatchSize(64),
+		WithLLaMACppPhysicalBatchSize(64),
+	}
+
+	gpu := GGUFRunClusterGPU{
+		Metric: GGUFRunDeviceMetric{FLOPS: 100e12, UpBandwidth: 1e12, DownBandwidth: 32e9},
+		VRAM:   8 << 30,
+	}
+	host := GGUFRunDeviceMetric{FLOPS: 1e12, UpBandwidth: 100e9, DownBandwidth: 10e9}
+	link := func(f, t string) GGUFRunClusterLink {
+		return GGUFRunClusterLink{From: f, To: t, Bandwidth: 1e9, Latency: time.Millisecond}
+	}
+	topo := GGUFRunClusterTopology{
+		Nodes: []GGUFRunClusterNode{
+			{Name: "a", Host: host, GPUs: []GGUFRunClusterGPU{gpu}},
+			{Name: "b", Endpoint: "10.0.0.2:50052", Host: host, GPUs: []GGUFRunClusterGPU{gpu}},
+			{Name: "c", Endpoint: "10.0.0.3:50052", Host: host, GPUs: []GGUFRunClusterGPU{gpu}},
+		},
+		Links: []GGUFRunClusterLink{link("a", "b"), link("a", "c")},
+	}
+
+	ce, err := gf.EstimateLLaMACppRunInCluster(topo, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layers uint64
+	for i, n := range ce.Nodes {
+		if n.HandleLayers == 0 || len(n.VRAMs) != 1 || n.VRAMs[0] == 0 {
+			t.Errorf("expected node %d to handle layers in 1 GPU, got %+v", i, n)
+		}
+		layers += n.HandleLayers
+	}
+	if layers != 9 {
+		t.Errorf("expected 9 layers in total, got %d", layers)
+	}
+	for i, n := range ce.Nodes {
+		if n.RAM == 0 {
+			t.Errorf("expected RAM on node %d, got %+v", i, n)
+		}
+	}
+	// b, then c relayed by a, then back to a.
+	expected := [][2]string{{"a", "b"}, {"b", "a"}, {"a", "c"}, {"c", "a"}}
+	if len(ce.Hops) != len(expected) {
+		t.Fatalf("expected %d hops, got %+v", len(expected), ce.Hops)
+	}
+	for i, h := range ce.Hops {
+		if h.From != expected[i][0] || h.To != expected[i][1] || h.Bytes != 512*4 {
+			t.Errorf("expected hop %v of 2048 bytes, got %+v", expected[i], h)
+		}
+		if h.Latency < time.Millisecond {
+			t.Errorf("expected hop latency at least 1ms, got %v", h.Latency)
+		}
+	}
+	if ce.TokensPerSecond <= 0 || ce.TokensPerSecond >= 250 {
+		t.Errorf("expected tokens per second bounded by 4 hops of 1ms, got %v", ce.TokensPerSecond)
+	}
+
+	// b serves 2 GPUs with one endpoint, d serves its CPU only.
+	mtopo := topo
+	mtopo.Nodes = append([]GGUFRunClusterNode{}, topo.Nodes...)
+	mtopo.Nodes[1].GPUs = []GGUFRunClusterGPU{gpu, gpu}
+	mtopo.Nodes = append(mtopo.Nodes, GGUFRunClusterNode{Name: "d", Endpoint: "10.0.0.4:50052", Host: host, RAM: 8 << 30})
+	mtopo.Links = append(mtopo.Links, link("a", "d"))
+	ce, err = gf.EstimateLLaMACppRunInCluster(mtopo, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps := []string{"10.0.0.2:50052", "10.0.0.2:50052", "10.0.0.3:50052", "10.0.0.4:50052"}
+	for i, ep := range eps {
+		if d := ce.Estimate.Devices[i+1]; !d.Remote || d.Endpoint != ep {
+			t.Errorf("expected device %d at %s, got remote %v at %q", i+1, ep, d.Remote, d.Endpoint)
+		}
+	}
+	if d := ce.Estimate.Devices[len(eps)+1]; d.Remote {
+		t.Errorf("expected device %d to be local", len(eps)+1)
+	}
+	if n := ce.Nodes[1]; len(n.VRAMs) != 2 {
+		t.Errorf("expected node b to use 2 GPUs, got %+v", n)
+	}
+	if n := ce.Nodes[3]; n.HandleLayers == 0 || n.RAM == 0 || len(n.VRAMs) != 0 {
+		t.Errorf("expected node d to handle layers in RAM, got %+v", n)
+	}
+
+	topo.Links = topo.Links[:1]
+	if _, err = gf.EstimateLLaMACppRunInCluster(topo, opts...); err == nil {
+		t.Error("expected error without link to c")
+	}
+}
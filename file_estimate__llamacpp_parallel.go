@@ -0,0 +1,96 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// LLaMACppParallelEstimate represents the maximum concurrent sequences of running the GGUF file in llama.cpp,
+// which fit the VRAM budgets.
+type LLaMACppParallelEstimate struct {
+	// SlotContextSize is the context size of each sequence.
+	SlotContextSize uint64 `json:"slotContextSize"`
+	// ParallelSize is the maximum number of the concurrent sequences,
+	// 0 means even one sequence does not fit.
+	ParallelSize uint64 `json:"parallelSize"`
+	// Item is the summarized usage of running ParallelSize sequences,
+	// or one sequence if ParallelSize is 0.
+	Item LLaMACppRunEstimateSummaryItem `json:"item"`
+}
+
+// _LLaMACppMaxParallelSize is the maximum number of the parallel sequences,
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-cparams.h, LLAMA_MAX_SEQ.
+const _LLaMACppMaxParallelSize = 256
+
+// EstimateLLaMACppRunMaximumParallelSize estimates the maximum number of the concurrent sequences,
+// which can be served by llama.cpp with the given context size of each sequence (slot),
+// and keeps the NonUMA VRAM usage of each GPU within the given budget.
+//
+// The vramBudgets must have the same length as the GPUs,
+// the WithParallelSize and WithLLaMACppSlotContextSize options are overridden,
+// and the memory usages are summarized with mmap.
+//
+// The constraints of the KV cache are applied to every attempt,
+// e.g. the quantized Value cache falls back to F16 without flash attention.
+func (gf *GGUFFile) EstimateLLaMACppRunMaximumParallelSize(
+	vramBudgets []GGUFBytesScalar,
+	slotContextSize int32,
+	opts ...GGUFRunEstimateOption,
+) (pe LLaMACppParallelEstimate, err error) {
+	if slotContextSize <= 0 {
+		return pe, fmt.Errorf("invalid slot context size %d", slotContextSize)
+	}
+	if len(vramBudgets) == 0 {
+		return pe, errors.New("no VRAM budgets")
+	}
+
+	estimate := func(n uint64) (LLaMACppRunEstimateSummaryItem, bool, error) {
+		eopts := opts[:len(opts):len(opts)]
+		eopts = append(eopts, WithParallelSize(int32(n)), WithLLaMACppSlotContextSize(slotContextSize))
+		e := gf.EstimateLLaMACppRun(eopts...)
+		emi := e.SummarizeItem(true, 0, 0)
+		if len(emi.VRAMs) != len(vramBudgets) {
+			return emi, false, fmt.Errorf("estimated %d GPUs, but given %d VRAM budgets", len(emi.VRAMs), len(vramBudgets))
+		}
+		for i := range emi.VRAMs {
+			if emi.VRAMs[i].NonUMA > vramBudgets[i] {
+				return emi, false, nil
+			}
+		}
+		return emi, true, nil
+	}
+
+	pe.SlotContextSize = uint64(slotContextSize)
+	emi, ok, err := estimate(1)
+	if err != nil {
+		return pe, err
+	}
+	pe.Item = emi
+	if !ok {
+		return pe, nil
+	}
+
+	// Double the parallel size until it does not fit,
+	// then search between the last two attempts.
+	maxN := min(_LLaMACppMaxParallelSize, uint64(math.MaxInt32/slotContextSize))
+	lo, hi := uint64(1), maxN+1
+	for n := uint64(2); n <= maxN; n *= 2 {
+		if emi, ok, _ = estimate(n); !ok {
+			hi = n
+			break
+		}
+		lo, pe.Item = n, emi
+	}
+	for lo+1 < hi {
+		n := lo + (hi-lo)/2
+		if emi, ok, _ = estimate(n); !ok {
+			hi = n
+			continue
+		}
+		lo, pe.Item = n, emi
+	}
+	pe.ParallelSize = lo
+
+	return pe, nil
+}
@@ -0,0 +1,54 @@
+package gguf_parser
+
+import (
+	"testing"
+)
+
+func TestGGUFFile_EstimateLLaMACppRunMaximumParallelSize(t *testing.T) {
+	gf := testQuantizeGGUFFile(4)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(4096)})
+	gf.Size = gf.ModelSize
+	opts := []GGUFRunEstimateOption{
+		WithLLaMACppLogicalBatchSize(64),
+		WithLLaMACppPhysicalBatchSize(64),
+	}
+	vram := func(n int32, opts ...GGUFRunEstimateOption) GGUFBytesScalar {
+		opts = append(opts, WithParallelSize(n), WithLLaMACppSlotContextSize(1024))
+		return gf.EstimateLLaMACppRun(opts...).SummarizeItem(true, 0, 0).VRAMs[0].NonUMA
+	}
+
+	// F16 [64 (key length), 2 (n_head_kv)] key and value of 4 layers per cell.
+	for _, o := range []GGUFRunEstimateOption{WithLLaMACppContextSize(1024), WithoutLLaMACppUnifiedKVCache()} {
+		e := gf.EstimateLLaMACppRun(append(opts, o, WithParallelSize(4), WithLLaMACppSlotContextSize(1024))...)
+		if expected := GGUFBytesScalar(4 * 1024 * 4 * 64 * 2 * 2 * 2); e.ContextSize != 4096 || e.Devices[1].KVCache.Sum() != expected {
+			t.Errorf("expected context size 4096 with KV cache %d, got %d with %d", expected, e.ContextSize, e.Devices[1].KVCache.Sum())
+		}
+	}
+	// Each stream pads its cells, 1024 / 3 = 341 pads to 352.
+	e := gf.EstimateLLaMACppRun(append(opts, WithoutLLaMACppUnifiedKVCache(), WithParallelSize(3), WithLLaMACppContextSize(1024))...)
+	if expected := GGUFBytesScalar(3 * 352 * 4 * 64 * 2 * 2 * 2); e.Devices[1].KVCache.Sum() != expected {
+		t.Errorf("expected padded KV cache %d, got %d", expected, e.Devices[1].KVCache.Sum())
+	}
+	if u, nu := vram(4, opts...), vram(4, append(opts, WithoutLLaMACppUnifiedKVCache())...); nu >= u {
+		t.Errorf("expected less VRAM without unified KV cache, got %d and %d", nu, u)
+	}
+
+	budget := vram(5, opts...) + 1
+	pe, err := gf.EstimateLLaMACppRunMaximumParallelSize([]GGUFBytesScalar{budget}, 1024, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.ParallelSize != 5 || pe.SlotContextSize != 1024 || pe.Item.VRAMs[0].NonUMA > budget {
+		t.Errorf("expected 5 sequences within %d, got %d with %d", budget, pe.ParallelSize, pe.Item.VRAMs[0].NonUMA)
+	}
+
+	pe, err = gf.EstimateLLaMACppRunMaximumParallelSize([]GGUFBytesScalar{1 << 20}, 1024, opts...)
+	if err != nil || pe.ParallelSize != 0 {
+		t.Errorf("expected no sequence fits, got %d, %v", pe.ParallelSize, err)
+	}
+
+	if _, err = gf.EstimateLLaMACppRunMaximumParallelSize([]GGUFBytesScalar{budget, budget}, 1024, opts...); err == nil {
+		t.Error("expected error with mismatched VRAM budgets")
+	}
+}
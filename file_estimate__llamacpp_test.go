@@ -2,6 +2,7 @@ package gguf_parser
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -322,3 +323,211 @@ func TestGGUFFile_EstimateLLaMACppRun_ProjectorFlashAttention(t *testing.T) {
 		})
 	}
 }
+
+func TestGGUFFile_EstimateLLaMACppRun_PerLayerAttention(t *testing.T) {
+	gf := testQuantizeGGUFFile(4)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1024)},
+		GGUFMetadataKV{Key: "llama.attention.sliding_window", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(128)},
+	)
+	for i := range gf.Header.MetadataKV {
+		if gf.Header.MetadataKV[i].Key == "llama.attention.head_count_kv" {
+			// The 2nd layer has no attention.
+			gf.Header.MetadataKV[i].ValueType = GGUFMetadataValueTypeArray
+			gf.Header.MetadataKV[i].Value = GGUFMetadataKVArrayValue{
+				Type: GGUFMetadataValueTypeUint32, Len: 4, Array: []any{uint32(2), uint32(0), uint32(2), uint32(4)},
+			}
+		}
+	}
+
+	kv := func(gf *GGUFFile) (k GGUFBytesScalar) {
+		e := gf.EstimateLLaMACppRun(WithLLaMACppContextSize(1024), WithLLaMACppLogicalBatchSize(64), WithLLaMACppPhysicalBatchSize(64))
+		for _, d := range e.Devices {
+			k += d.KVCache.Key
+		}
+		return k
+	}
+
+	a := gf.Architecture()
+	// The scalar head count does not fill the per layer values.
+	if a.AttentionHeadCountPerLayer != nil || a.AttentionSlidingWindowPerLayer != nil {
+		t.Errorf("expected no per layer values from scalars, got %v, %v", a.AttentionHeadCountPerLayer, a.AttentionSlidingWindowPerLayer)
+	}
+	if a.AttentionHeadCountKV != 2 || len(a.AttentionHeadCountKVPerLayer) != 4 || a.LayerAttentionHeadCountKV(3) != 4 {
+		t.Fatalf("unexpected attention heads: %v", a.AttentionHeadCountKVPerLayer)
+	}
+	// F16 [64 (key length), n_head_kv, 1024 (n_kv)] per layer.
+	if actual, expected := kv(gf), GGUFBytesScalar(64*(2+0+2+4)*1024*2); actual != expected {
+		t.Errorf("expected key cache %d, got %d", expected, actual)
+	}
+
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV, GGUFMetadataKV{
+		Key: "llama.attention.sliding_window_pattern", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeBool, Len: 4, Array: []any{true, true, true, false},
+		},
+	})
+	if a = gf.Architecture(); a.AttentionSlidingWindowPattern != 4 {
+		t.Errorf("expected sliding window pattern 4, got %d", a.AttentionSlidingWindowPattern)
+	}
+	// The sliding window layers cache 192 (128 + 64 padded) cells only.
+	if actual, expected := kv(gf), GGUFBytesScalar(64*(2*192+2*192+4*1024)*2); actual != expected {
+		t.Errorf("expected key cache %d, got %d", expected, actual)
+	}
+
+	for _, tc := range []struct {
+		swas    []any
+		pattern uint32
+		cells   [4]uint64
+	}{
+		// Only the first layer is none sliding window, no fixed period.
+		{[]any{false, true, true, true}, 0, [4]uint64{1024, 192, 192, 192}},
+		{[]any{true, false, true, false}, 2, [4]uint64{192, 1024, 192, 1024}},
+		{[]any{false, false, false, false}, 1, [4]uint64{1024, 1024, 1024, 1024}},
+		{[]any{true, true, true, true}, 0, [4]uint64{192, 192, 192, 192}},
+	} {
+		gf.Header.MetadataKV[len(gf.Header.MetadataKV)-1].Value = GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeBool, Len: 4, Array: tc.swas,
+		}
+		if a = gf.Architecture(); a.AttentionSlidingWindowPattern != tc.pattern {
+			t.Errorf("expected sliding window pattern %d of %v, got %d", tc.pattern, tc.swas, a.AttentionSlidingWindowPattern)
+		}
+		expected := GGUFBytesScalar(64 * (2*tc.cells[0] + 0*tc.cells[1] + 2*tc.cells[2] + 4*tc.cells[3]) * 2)
+		if actual := kv(gf); actual != expected {
+			t.Errorf("expected key cache %d of %v, got %d", expected, tc.swas, actual)
+		}
+	}
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_RowSplit(t *testing.T) {
+	gf := testQuantizeGGUFFile(4)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1024)})
+	gf.Size = gf.ModelSize
+
+	e := gf.EstimateLLaMACppRun(
+		WithLLaMACppContextSize(1024),
+		WithLLaMACppLogicalBatchSize(64),
+		WithLLaMACppPhysicalBatchSize(64),
+		WithTensorSplitFraction([]float64{0.25, 1}),
+		WithMainGPUIndex(1),
+		WithLLaMACppSplitMode(LLaMACppSplitModeRow))
+	d, md := e.Devices[1], e.Devices[2]
+
+	if d.HandleLayers != 4 || md.HandleLayers != 4 || d.HandleOutputLayer || !md.HandleOutputLayer {
+		t.Errorf("expected both devices to handle 4 layers and the main device to handle output, got %+v, %+v", d, md)
+	}
+	// A quarter of the F16 matrix rows per layer,
+	// and the main device holds the norms.
+	const shard = (512*512 + 512*128 + 512*1536 + 1536*512/2) * 2 * 2 / 4
+	if d.Weight.Compute != 4*shard || md.Weight.Compute != 4*(3*shard+2*512*4) {
+		t.Errorf("expected weights %d and %d, got %d and %d", 4*shard, 4*(3*shard+2*512*4), d.Weight.Compute, md.Weight.Compute)
+	}
+	if d.Weight.Output != 0 || md.Weight.Output == 0 {
+		t.Errorf("expected output weight on the main device only, got %d and %d", d.Weight.Output, md.Weight.Output)
+	}
+	if d.KVCache.Sum() != 0 || md.KVCache.Sum() == 0 {
+		t.Errorf("expected KV cache on the main device only, got %d and %d", d.KVCache.Sum(), md.KVCache.Sum())
+	}
+	// F32 [1536, 64] input and F32 [128, 64] partial result of ffn_down.
+	if expected := GGUFBytesScalar((1536 + 128) * 64 * 4); d.Computation.Input != 0 || d.Computation.Compute != expected {
+		t.Errorf("expected computation %d without input, got %+v", expected, d.Computation)
+	}
+
+	emi := e.SummarizeItem(true, 0, 0)
+	if emi.VRAMs[0].NonUMA == 0 || emi.VRAMs[0].NonUMA >= emi.VRAMs[1].NonUMA {
+		t.Errorf("expected the main device to use more VRAM, got %v", emi.VRAMs)
+	}
+
+	// Fallback to layer split with RPC servers.
+	e = gf.EstimateLLaMACppRun(
+		WithLLaMACppContextSize(1024),
+		WithLLaMACppLogicalBatchSize(64),
+		WithLLaMACppPhysicalBatchSize(64),
+		WithTensorSplitFraction([]float64{0.5, 1}),
+		WithRPCServers([]string{"127.0.0.1:50052"}),
+		WithLLaMACppSplitMode(LLaMACppSplitModeRow))
+	if e.Devices[1].HandleLayers+e.Devices[2].HandleLayers != 4 || e.Devices[1].KVCache.Sum() == 0 {
+		t.Errorf("expected layer split with RPC servers, got %+v", e.Devices)
+	}
+}
+
+func TestGGUFFile_EstimateLLaMACppRun_CacheType(t *testing.T) {
+	gf := testQuantizeGGUFFile(2)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "llama.context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1024)})
+	estimate := func(opts ...GGUFRunEstimateOption) LLaMACppRunEstimate {
+		opts = append(opts, WithLLaMACppContextSize(1024), WithLLaMACppLogicalBatchSize(64), WithLLaMACppPhysicalBatchSize(64))
+		return gf.EstimateLLaMACppRun(opts...)
+	}
+	rules := func(e LLaMACppRunEstimate) (rs []string) {
+		for _, w := range e.Warnings {
+			rs = append(rs, w.Rule)
+		}
+		return rs
+	}
+	// [64 (value length), 2 (n_head_kv), 1024 (n_kv)] of 2 layers.
+	const cells = 64 * 2 * 1024 * 2
+
+	cases := []struct {
+		name     string
+		opts     []GGUFRunEstimateOption
+		expected []string
+		value    GGUFBytesScalar
+	}{
+		{
+			name:  "Quantized",
+			opts:  []GGUFRunEstimateOption{WithFlashAttention(), WithLLaMACppCacheKeyType(GGMLTypeQ8_0), WithLLaMACppCacheValueType(GGMLTypeQ4_0)},
+			value: cells / 32 * 18,
+		},
+		{
+			name:     "Quantized Value Without Flash Attention",
+			opts:     []GGUFRunEstimateOption{WithLLaMACppCacheValueType(GGMLTypeQ4_0)},
+			expected: []string{"value-cache-flash-attention"},
+			value:    cells * 2,
+		},
+		{
+			name:     "Unsupported",
+			opts:     []GGUFRunEstimateOption{WithFlashAttention(), WithLLaMACppCacheKeyType(GGMLTypeQ4_K), WithLLaMACppCacheValueType(GGMLTypeQ2_K)},
+			expected: []string{"cache-type", "cache-type"},
+			value:    cells * 2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := estimate(tc.opts...)
+			if rs := rules(e); !slices.Equal(rs, tc.expected) {
+				t.Errorf("expected warnings %v, got %v", tc.expected, e.Warnings)
+			}
+			if e.Devices[1].KVCache.Value != tc.value {
+				t.Errorf("expected value cache %d, got %d", tc.value, e.Devices[1].KVCache.Value)
+			}
+		})
+	}
+
+	t.Run("Block Size", func(t *testing.T) {
+		gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+			GGUFMetadataKV{Key: "llama.attention.key_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(80)})
+		defer func() { gf.Header.MetadataKV = gf.Header.MetadataKV[:len(gf.Header.MetadataKV)-1] }()
+
+		e := estimate(WithFlashAttention(), WithLLaMACppCacheKeyType(GGMLTypeQ8_0))
+		if rs := rules(e); !slices.Equal(rs, []string{"cache-block-size"}) {
+			t.Errorf("expected block size warning, got %v", e.Warnings)
+		}
+		// F16 [80 (key length), 2 (n_head_kv), 1024 (n_kv)] of 2 layers.
+		if expected := GGUFBytesScalar(80 * 2 * 1024 * 2 * 2); e.Devices[1].KVCache.Key != expected {
+			t.Errorf("expected key cache %d, got %d", expected, e.Devices[1].KVCache.Key)
+		}
+	})
+
+	t.Run("MLA", func(t *testing.T) {
+		gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+			GGUFMetadataKV{Key: "llama.attention.key_length_mla", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(96)},
+			GGUFMetadataKV{Key: "llama.attention.value_length_mla", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(64)})
+		defer func() { gf.Header.MetadataKV = gf.Header.MetadataKV[:len(gf.Header.MetadataKV)-2] }()
+
+		e := estimate(WithFlashAttention())
+		if e.Devices[1].KVCache.Key != cells*2 || e.Devices[1].KVCache.Value != 0 {
+			t.Errorf("expected key cache %d without value cache, got %+v", cells*2, e.Devices[1].KVCache)
+		}
+	})
+}
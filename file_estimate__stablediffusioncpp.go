@@ -2,6 +2,8 @@ package gguf_parser
 
 import (
 	"math"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"golang.org/x/exp/maps"
@@ -46,6 +48,8 @@ type (
 		Upscaler *StableDiffusionCppRunEstimate `json:"upscaler,omitempty"`
 		// ControlNet is the estimated result of the control net.
 		ControlNet *StableDiffusionCppRunEstimate `json:"controlNet,omitempty"`
+		// LoRAs is the estimated result of the LoRA adapters.
+		LoRAs []StableDiffusionCppRunEstimate `json:"loras,omitempty"`
 	}
 
 	// StableDiffusionCppRunDeviceUsage represents the usage for running the GGUF file in llama.cpp.
@@ -116,13 +120,14 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 	}
 
 	// Devices.
+	rpcs := rpcServerOfDevices(o.RPCServers, o.RPCServerDevices)
 	initDevices := func(e *StableDiffusionCppRunEstimate) {
 		for j := range e.Devices[1:] {
-			e.Devices[j+1].Remote = j < len(o.RPCServers)
+			e.Devices[j+1].Remote = j < len(rpcs)
 			if e.Devices[j+1].Remote {
 				e.Devices[j+1].Position = j
 			} else {
-				e.Devices[j+1].Position = j - len(o.RPCServers)
+				e.Devices[j+1].Position = j - len(rpcs)
 			}
 		}
 	}
@@ -147,11 +152,62 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 	// Offload.
 	e.FullOffloaded = *o.SDCOffloadLayers > 0
 
-	// NoMMap.
-	e.NoMMap = true // TODO: Implement this.
+	// Upscaler detection.
+	//
+	// NB(thxCode): The upscaler, e.g. ESRGAN, is not recognized as a diffusion architecture,
+	// but it is estimated in stable-diffusion.cpp as well.
+	var upscaler bool
+	if a.Architecture != "diffusion" {
+		_, found := gf.TensorInfos.Index([]string{"conv_first.weight", "conv_last.weight"})
+		upscaler = found == 2
+	}
+
+	// Video.
+	//
+	// NB(thxCode): The video diffusion model always generates video,
+	// so the image modes are treated as the corresponding video modes.
+	if a.DiffusionVideo {
+		switch o.SDCMode {
+		case StableDiffusionCppModeTextToImage:
+			o.SDCMode = StableDiffusionCppModeTextToVideo
+		case StableDiffusionCppModeImageToImage:
+			o.SDCMode = StableDiffusionCppModeImageToVideo
+		}
+		if o.SDCFrameCount == nil {
+			o.SDCFrameCount = ptr.To[uint32](33)
+		}
+	} else {
+		o.SDCFrameCount = ptr.To[uint32](1)
+	}
 
 	// ImageOnly.
-	e.ImageOnly = true // TODO: Implement this.
+	e.ImageOnly = (a.DiffusionArchitecture != "" && !a.DiffusionVideo) || upscaler
+
+	// Upscaler & ControlNet.
+	e.Upscaler = o.SDCUpscaler
+	e.ControlNet = o.SDCControlNet
+
+	// Footprint
+	{
+		// Bootstrap.
+		e.Devices[0].Footprint = GGUFBytesScalar(10*1024*1024) /* model load */ + (gf.Size - gf.ModelSize) /* metadata */
+	}
+
+	// Upscale only,
+	// only the upscaler is loaded.
+	if o.SDCMode == StableDiffusionCppModeUpscale && !upscaler {
+		e.ImageOnly = true
+		e.Devices[0].Footprint = 0
+		e.ControlNet = nil
+		return e
+	}
+
+	// Upscaler only.
+	if upscaler {
+		e.Architecture = "esrgan"
+		estimateStableDiffusionCppUpscalerRun(gf, &e, o)
+		return e
+	}
 
 	// Autoencoder.
 	if a.DiffusionAutoencoder != nil {
@@ -186,12 +242,6 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 		}
 	}
 
-	// Footprint
-	{
-		// Bootstrap.
-		e.Devices[0].Footprint = GGUFBytesScalar(10*1024*1024) /* model load */ + (gf.Size - gf.ModelSize) /* metadata */
-	}
-
 	var cdLs, aeLs, dmLs GGUFLayerTensorInfos
 	{
 		ls := gf.Layers()
@@ -201,6 +251,33 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 		aeLs, dmLs, _ = aeLs.Cut([]string{
 			"first_stage_model.*",
 		})
+
+		// Conditioner or autoencoder only,
+		// the tensors are not prefixed.
+		if a.DiffusionArchitecture == "" {
+			switch {
+			case e.Autoencoder != nil && len(aeLs) == 0:
+				aeLs, dmLs = dmLs, nil
+			case len(e.Conditioners) != 0 && len(cdLs) == 0:
+				cdLs = GGUFLayerTensorInfos{
+					&GGUFNamedTensorInfos{Name: "cond_stage_model", GGUFLayerTensorInfos: dmLs},
+				}
+				dmLs = nil
+			}
+		}
+
+		// Decode only.
+		//
+		// NB(thxCode): stable-diffusion.cpp ignores the encoder tensors of the autoencoder,
+		// if the initial image is not required.
+		if o.SDCMode != StableDiffusionCppModeImageToImage && o.SDCMode != StableDiffusionCppModeImageToVideo {
+			_, aeLs, _ = aeLs.Cut([]string{
+				"first_stage_model.encoder*",
+				"first_stage_model.quant*",
+				"encoder.*",
+				"quant_conv.*",
+			})
+		}
 	}
 
 	var cdDevIdx, aeDevIdx, dmDevIdx int
@@ -228,7 +305,7 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 	// Weight & Parameter.
 	{
 		// Conditioners.
-		for i := range cdLs {
+		for i := range cdLs[:min(len(cdLs), len(e.Conditioners))] {
 			e.Conditioners[i].Devices[cdDevIdx].Weight = GGUFBytesScalar(cdLs[i].Bytes())
 			e.Conditioners[i].Devices[cdDevIdx].Parameter = GGUFParametersScalar(cdLs[i].Elements())
 		}
@@ -258,7 +335,7 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 		//     https://github.com/leejet/stable-diffusion.cpp/blob/4570715727f35e5a07a76796d823824c8f42206c/stable-diffusion.cpp#L1572-L1586,
 		//     https://github.com/leejet/stable-diffusion.cpp/blob/4570715727f35e5a07a76796d823824c8f42206c/stable-diffusion.cpp#L1675-L1679.
 		//
-		{
+		if len(dmLs) != 0 {
 			zChannels := uint64(4)
 			if a.DiffusionTransformer {
 				zChannels = 16
@@ -266,6 +343,10 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 			// See https://github.com/thxCode/stable-diffusion.cpp/blob/1ae97f8a8ca3615bdaf9c1fd32c13562e2471833/stable-diffusion.cpp#L2682-L2691.
 			usage := uint64(128 * 1024 * 1024) /* 128MiB, LLaMA Box */
 			usage += uint64(*o.SDCWidth) * uint64(*o.SDCHeight) * 3 /* output channels */ * 4 /* sizeof(float) */ * zChannels
+			if a.DiffusionVideo {
+				// Holds the decoded frames.
+				usage += uint64(*o.SDCWidth) * uint64(*o.SDCHeight) * 3 /* output channels */ * 4 /* sizeof(float) */ * uint64(*o.SDCFrameCount)
+			}
 			e.Devices[0].Computation += GGUFBytesScalar(usage * uint64(ptr.Deref(o.ParallelSize, 1)) /* max batch */)
 		}
 
@@ -276,6 +357,23 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 		{
 			var tes [][]uint64
 			switch {
+			case strings.HasPrefix(a.DiffusionArchitecture, "Wan"): // Wan
+				tes = [][]uint64{
+					{4096, 512},
+				}
+			case a.DiffusionArchitecture == "LTX-Video": // LTX-Video
+				tes = [][]uint64{
+					{4096, 128},
+				}
+			case a.DiffusionArchitecture == "HunyuanVideo": // HunyuanVideo
+				tes = [][]uint64{
+					{768, 77},
+					{4096, 256},
+				}
+			case a.DiffusionArchitecture == "Qwen-Image": // Qwen-Image
+				tes = [][]uint64{
+					{3584, 256},
+				}
 			case strings.HasPrefix(a.DiffusionArchitecture, "FLUX"): // FLUX.1
 				tes = [][]uint64{
 					{768, 77},
@@ -303,18 +401,18 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 					{768, 77},
 				}
 			}
-			for i := range cdLs {
+			for i := range cdLs[:min(len(cdLs), len(e.Conditioners), len(tes))] {
 				usage := GGMLTypeF32.RowSizeOf(tes[i]) * 2 /* include conditioner */
 				e.Conditioners[i].Devices[cdDevIdx].Computation += GGUFBytesScalar(usage)
 			}
-
-			// TODO VAE Encode
 		}
 
 		// Diffusing usage.
-		if !*o.SDCFreeComputeMemoryImmediately {
-			var usage uint64
+		if len(dmLs) != 0 && !*o.SDCFreeComputeMemoryImmediately {
+			usage := estimateStableDiffusionCppDiffusionComputation(dmLs, *o.SDCWidth, *o.SDCHeight, *o.SDCFrameCount, e.FlashAttention)
+			// Fallback to the regressions if the shapes are unrecognized.
 			switch {
+			case usage != 0:
 			case strings.HasPrefix(a.DiffusionArchitecture, "FLUX"): // FLUX.1
 				usage = GuessFLUXDiffusionModelMemoryUsage(*o.SDCWidth, *o.SDCHeight, e.FlashAttention)
 			case strings.HasPrefix(a.DiffusionArchitecture, "Stable Diffusion 3"): // SD 3.x
@@ -351,36 +449,531 @@ func (gf *GGUFFile) EstimateStableDiffusionCppRun(opts ...GGUFRunEstimateOption)
 			e.Devices[dmDevIdx].Computation += GGUFBytesScalar(usage)
 		}
 
-		// Decode usage.
+		// Encode & Decode usage.
+		//
+		// NB(thxCode): The autoencoder reuses the compute buffer between encoding and decoding,
+		// so the larger one is counted.
 		if len(aeLs) != 0 && !*o.SDCFreeComputeMemoryImmediately {
 			// Bootstrap.
 			e.Autoencoder.Devices[aeDevIdx].Footprint += GGUFBytesScalar(100 * 1024 * 1024) /*100 MiB.*/
 
-			var convDim uint64
+			var decConvDim, encConvDim uint64
 			{
 				m, _ := aeLs.Index([]string{
 					"first_stage_model.decoder.conv_in.weight",
 					"decoder.conv_in.weight",
+					"first_stage_model.decoder.conv_in.conv.weight", // 3D VAE
+					"decoder.conv_in.conv.weight",
+					"first_stage_model.decoder.conv1.weight",
+					"decoder.conv1.weight",
 				})
 				tis := maps.Values(m)
 				if len(tis) != 0 && tis[0].NDimensions > 3 {
-					convDim = max(tis[0].Dimensions[0], tis[0].Dimensions[3])
+					decConvDim = max(tis[0].Dimensions[0], tis[0].Dimensions[3])
+				}
+			}
+			if o.SDCMode == StableDiffusionCppModeImageToImage || o.SDCMode == StableDiffusionCppModeImageToVideo {
+				m, _ := aeLs.Index([]string{
+					"first_stage_model.encoder.conv_out.weight",
+					"encoder.conv_out.weight",
+				})
+				tis := maps.Values(m)
+				if len(tis) != 0 && tis[0].NDimensions > 3 {
+					encConvDim = tis[0].Dimensions[2]
 				}
 			}
 
-			var usage uint64
-			if !*o.SDCAutoencoderTiling {
-				usage = uint64(*o.SDCWidth) * uint64(*o.SDCHeight) * (3 /* output channels */ *4 /* sizeof(float) */ + 1) * convDim
-			} else {
-				usage = 512 * 512 * (3 /* output channels */ *4 /* sizeof(float) */ + 1) * convDim
+			w, h := uint64(*o.SDCWidth), uint64(*o.SDCHeight)
+			if *o.SDCAutoencoderTiling {
+				w, h = 512, 512
+			}
+			usage := w * h * (3 /* output channels */ *4 /* sizeof(float) */ + 1) * max(decConvDim, encConvDim)
+			if a.DiffusionAutoencoder != nil && strings.HasSuffix(a.DiffusionAutoencoder.Architecture, "3D VAE") && *o.SDCFrameCount > 1 {
+				// NB(thxCode): The 3D autoencoder decodes the latent frame by frame with the causal cache,
+				// each latent frame produces 4 frames at most.
+				usage *= min(uint64(*o.SDCFrameCount), 4)
 			}
 			e.Autoencoder.Devices[aeDevIdx].Computation += GGUFBytesScalar(usage)
 		}
 	}
 
+	// LoRAs.
+	if len(o.SDCLoRAs) != 0 {
+		devIdx := func(name string) int {
+			switch {
+			case strings.HasPrefix(name, "cond_stage_model."):
+				return cdDevIdx
+			case strings.HasPrefix(name, "first_stage_model."):
+				return aeDevIdx
+			}
+			return dmDevIdx
+		}
+		e.LoRAs = make([]StableDiffusionCppRunEstimate, 0, len(o.SDCLoRAs))
+		for i := range o.SDCLoRAs {
+			lr := StableDiffusionCppRunEstimate{
+				Type:           "adapter",
+				Architecture:   "lora",
+				FlashAttention: e.FlashAttention,
+				Distributable:  e.Distributable,
+				FullOffloaded:  e.FullOffloaded,
+				NoMMap:         true,
+				Devices:        make([]StableDiffusionCppRunDeviceUsage, len(e.Devices)),
+			}
+			initDevices(&lr)
+			estimateStableDiffusionCppLoRARun(gf, o.SDCLoRAs[i], &lr, o.SDCLoRAApplyMode, devIdx)
+			e.LoRAs = append(e.LoRAs, lr)
+		}
+	}
+
 	return e
 }
 
+// estimateStableDiffusionCppLoRARun estimates the usages of the LoRA adapter applying to the base GGUF file,
+// the devIdx returns the device index of the given target tensor name.
+//
+// Applying at runtime keeps the LoRA weights along with the target weights,
+// merging at load releases the LoRA weights after merging,
+// which needs the LoRA weights and the F32 delta of the largest target weight in the meantime.
+func estimateStableDiffusionCppLoRARun(
+	gf, lora *GGUFFile,
+	e *StableDiffusionCppRunEstimate,
+	mode StableDiffusionCppLoRAApplyMode,
+	devIdx func(name string) int,
+) {
+	idx := newStableDiffusionCppLoRAIndex(gf.TensorInfos)
+
+	var (
+		quantized bool
+		wgs       = make([]uint64, len(e.Devices))
+		pms       = make([]uint64, len(e.Devices))
+		dts       = make([]uint64, len(e.Devices))
+	)
+	for _, ti := range lora.TensorInfos {
+		bti, ok := idx.Match(ti.Name)
+		if !ok {
+			continue
+		}
+		d := devIdx(bti.Name)
+		wgs[d] += ti.Bytes()
+		pms[d] += ti.Elements()
+		dts[d] = max(dts[d], bti.Elements()*4 /* sizeof(float) */)
+		quantized = quantized || bti.Type.IsQuantized()
+	}
+
+	merge := mode == StableDiffusionCppLoRAApplyModeMerge ||
+		(mode == StableDiffusionCppLoRAApplyModeAuto && !quantized)
+	for d := range e.Devices {
+		e.Devices[d].Parameter = GGUFParametersScalar(pms[d])
+		if merge {
+			if wgs[d] != 0 {
+				e.Devices[d].Computation = GGUFBytesScalar(wgs[d] + dts[d])
+			}
+			continue
+		}
+		e.Devices[d].Weight = GGUFBytesScalar(wgs[d])
+	}
+}
+
+// _StableDiffusionCppLoRAIndex indexes the target tensors of the LoRA adapter.
+type _StableDiffusionCppLoRAIndex struct {
+	named map[string]GGUFTensorInfo
+	// flattened indexes the target tensors by the underscored name without prefix,
+	// which is used to match the kohya style naming,
+	// e.g. lora_unet_double_blocks_0_img_attn_qkv.lora_up.weight,
+	// the UNet tensors are also indexed by the diffusers style name,
+	// e.g. lora_unet_down_blocks_0_attentions_0_proj_in.lora_up.weight.
+	flattened map[string]GGUFTensorInfo
+}
+
+// newStableDiffusionCppLoRAIndex returns a _StableDiffusionCppLoRAIndex with the given target tensors.
+func newStableDiffusionCppLoRAIndex(tis GGUFTensorInfos) _StableDiffusionCppLoRAIndex {
+	idx := _StableDiffusionCppLoRAIndex{
+		named:     make(map[string]GGUFTensorInfo, len(tis)),
+		flattened: make(map[string]GGUFTensorInfo, len(tis)),
+	}
+	for i := range tis {
+		n := tis[i].Name
+		if !strings.HasSuffix(n, ".weight") {
+			continue
+		}
+		idx.named[n] = tis[i]
+
+		f := strings.TrimSuffix(n, ".weight")
+		switch {
+		case strings.HasPrefix(f, "cond_stage_model.transformer."):
+			f = "te1_" + strings.TrimPrefix(f, "cond_stage_model.transformer.")
+		case strings.HasPrefix(f, "cond_stage_model.1.transformer."):
+			f = "te2_" + strings.TrimPrefix(f, "cond_stage_model.1.transformer.")
+		default:
+			f = strings.TrimPrefix(f, "model.diffusion_model.")
+			if d, ok := stableDiffusionCppDiffusersUNetName(f); ok {
+				idx.flattened["unet_"+strings.ReplaceAll(d, ".", "_")] = tis[i]
+			}
+			f = "unet_" + f
+		}
+		idx.flattened[strings.ReplaceAll(f, ".", "_")] = tis[i]
+	}
+	return idx
+}
+
+// Match returns the target tensor of the given LoRA tensor name.
+//
+// The following naming styles are supported:
+//   - stable-diffusion.cpp, e.g. lora.model.diffusion_model.X.lora_up.weight.
+//   - PEFT, e.g. diffusion_model.X.lora_A.weight.
+//   - kohya, e.g. lora_unet_X.lora_down.weight, lora_te_X.alpha.
+func (idx _StableDiffusionCppLoRAIndex) Match(name string) (GGUFTensorInfo, bool) {
+	n, ok := "", false
+	for _, sfx := range []string{
+		".lora_up.weight", ".lora_down.weight", ".lora_mid.weight",
+		".lora_A.weight", ".lora_B.weight",
+		".alpha", ".scale", ".diff",
+	} {
+		if n, ok = strings.CutSuffix(name, sfx); ok {
+			break
+		}
+	}
+	if !ok {
+		return GGUFTensorInfo{}, false
+	}
+	n = strings.TrimPrefix(n, "lora.")
+
+	// Kohya.
+	if f, ok := strings.CutPrefix(n, "lora_"); ok {
+		if v, ok := strings.CutPrefix(f, "te_"); ok {
+			f = "te1_" + v
+		}
+		ti, ok := idx.flattened[f]
+		return ti, ok
+	}
+
+	for _, pfx := range []string{"", "model.", "model.diffusion_model."} {
+		if ti, ok := idx.named[pfx+n+".weight"]; ok {
+			return ti, true
+		}
+	}
+	return GGUFTensorInfo{}, false
+}
+
+var (
+	_StableDiffusionCppUNetBlockRegex = regexp.MustCompile(`^(input_blocks|output_blocks)\.(\d+)\.(\d+)(?:\.(.+))?$`)
+	_StableDiffusionCppUNetMidRegex   = regexp.MustCompile(`^middle_block\.(\d+)(?:\.(.+))?$`)
+
+	// _StableDiffusionCppDiffusersUNetNames maps the UNet tensor names of ldm style to diffusers style,
+	// which are not in the blocks.
+	_StableDiffusionCppDiffusersUNetNames = map[string]string{
+		"input_blocks.0.0": "conv_in",
+		"time_embed.0":     "time_embedding.linear_1",
+		"time_embed.2":     "time_embedding.linear_2",
+		"label_emb.0.0":    "add_embedding.linear_1",
+		"label_emb.0.2":    "add_embedding.linear_2",
+		"out.0":            "conv_norm_out",
+		"out.2":            "conv_out",
+	}
+
+	// _StableDiffusionCppDiffusersResnetNames maps the ResBlock tensor names of ldm style to diffusers style.
+	_StableDiffusionCppDiffusersResnetNames = map[string]string{
+		"in_layers.0":     "norm1",
+		"in_layers.2":     "conv1",
+		"emb_layers.1":    "time_emb_proj",
+		"out_layers.0":    "norm2",
+		"out_layers.3":    "conv2",
+		"skip_connection": "conv_shortcut",
+	}
+)
+
+// stableDiffusionCppDiffusersUNetName converts the given UNet tensor name(without prefix and suffix) of ldm style
+// to diffusers style, e.g. input_blocks.1.1.proj_in to down_blocks.0.attentions.0.proj_in,
+// see https://github.com/leejet/stable-diffusion.cpp/blob/master/model.cpp, convert_diffusers_name_to_compvis.
+func stableDiffusionCppDiffusersUNetName(n string) (string, bool) {
+	if d, ok := _StableDiffusionCppDiffusersUNetNames[n]; ok {
+		return d, true
+	}
+
+	resnet := func(pfx, rest string) (string, bool) {
+		if d, ok := _StableDiffusionCppDiffusersResnetNames[rest]; ok {
+			return pfx + "." + d, true
+		}
+		return "", false
+	}
+
+	if r := _StableDiffusionCppUNetMidRegex.FindStringSubmatch(n); r != nil {
+		switch k, rest := r[1], r[2]; {
+		case k == "0":
+			return resnet("mid_block.resnets.0", rest)
+		case k == "1" && rest != "":
+			return "mid_block.attentions.0." + rest, true
+		case k == "2":
+			return resnet("mid_block.resnets.1", rest)
+		}
+		return "", false
+	}
+
+	r := _StableDiffusionCppUNetBlockRegex.FindStringSubmatch(n)
+	if r == nil {
+		return "", false
+	}
+	b, _ := strconv.Atoi(r[2])
+	k, rest := r[3], r[4]
+	if r[1] == "input_blocks" {
+		if b == 0 {
+			return "", false
+		}
+		i, j := (b-1)/3, (b-1)%3
+		switch {
+		case j == 2 && k == "0" && rest == "op":
+			return "down_blocks." + strconv.Itoa(i) + ".downsamplers.0.conv", true
+		case j == 2:
+			return "", false
+		case k == "0":
+			return resnet("down_blocks."+strconv.Itoa(i)+".resnets."+strconv.Itoa(j), rest)
+		case k == "1" && rest != "":
+			return "down_blocks." + strconv.Itoa(i) + ".attentions." + strconv.Itoa(j) + "." + rest, true
+		}
+		return "", false
+	}
+	i, j := b/3, b%3
+	switch {
+	case k == "0":
+		return resnet("up_blocks."+strconv.Itoa(i)+".resnets."+strconv.Itoa(j), rest)
+	case rest == "conv":
+		return "up_blocks." + strconv.Itoa(i) + ".upsamplers.0.conv", true
+	case k == "1" && rest != "":
+		return "up_blocks." + strconv.Itoa(i) + ".attentions." + strconv.Itoa(j) + "." + rest, true
+	}
+	return "", false
+}
+
+// estimateStableDiffusionCppUpscalerRun estimates the usages of the upscaler GGUF file,
+// e.g. ESRGAN, which upscales the image tile by tile.
+func estimateStableDiffusionCppUpscalerRun(gf *GGUFFile, e *StableDiffusionCppRunEstimate, o _GGUFRunEstimateOptions) {
+	var devIdx int
+	if *o.SDCOffloadLayers > 0 {
+		devIdx = 1
+	}
+
+	// Weight & Parameter.
+	ls := gf.Layers()
+	e.Devices[devIdx].Weight = GGUFBytesScalar(ls.Bytes())
+	e.Devices[devIdx].Parameter = GGUFParametersScalar(ls.Elements())
+
+	// Scale, every up-sampling doubles the resolution.
+	var scale uint64 = 1
+	for range gf.TensorInfos.Search(regexp.MustCompile(`^conv_up\d+\.weight$`)) {
+		scale *= 2
+	}
+
+	// Features.
+	var nf uint64 = 64
+	if ti, ok := gf.TensorInfos.Get("conv_first.weight"); ok && ti.NDimensions > 3 {
+		nf = ti.Dimensions[3]
+	}
+
+	// Computation.
+	{
+		// Bootstrap, compute metadata.
+		var maxNodes uint64 = 32768
+		cm := GGMLTensorOverhead()*maxNodes + GGMLComputationGraphOverhead(maxNodes, false)
+		e.Devices[0].Computation = GGUFBytesScalar(cm)
+
+		// Work context, holds the input and the upscaled image.
+		w, h := uint64(*o.SDCWidth), uint64(*o.SDCHeight)
+		e.Devices[0].Computation += GGUFBytesScalar(w * h * 3 /* channels */ * 4 /* sizeof(float) */ * (1 + scale*scale))
+
+		// Upscaling usage,
+		// the image is upscaled in 128x128 tiles,
+		// and the up-sampled features are the largest intermediate tensors.
+		const tile = 128
+		e.Devices[devIdx].Computation += GGUFBytesScalar((tile * scale) * (tile * scale) * nf * 4 /* sizeof(float) */ * 3 /* in, out and residual */)
+	}
+}
+
+// estimateStableDiffusionCppDiffusionComputation estimates the computation usage of the diffusion model,
+// which is analyzed from the shapes of the given tensors at the latent resolution of the image.
+//
+// The diffusion model is either a UNet (SD 1.x/2.x/XL),
+// or a DiT (SD 3.x, FLUX.1, Qwen-Image, Wan, LTX-Video, HunyuanVideo),
+// the video DiT attends over the latent tokens of all latent frames.
+// Without flash attention,
+// the attention scores of the highest resolution attention are the largest intermediate tensor,
+// which grows in square of the number of latent tokens.
+// With flash attention, the scores are never materialized,
+// and the usage grows linearly in the number of latent tokens.
+//
+// Returns 0 if the shapes of the tensors are unrecognized,
+// or with flash attention for SD 1.x, SD 3.x and FLUX.1,
+// which are not checked against measurements yet, so that the caller falls back to the regressions.
+func estimateStableDiffusionCppDiffusionComputation(ls GGUFLayerTensorInfos, width, height, frames uint32, flashAttention bool) uint64 {
+	get := func(name string) (GGUFTensorInfo, bool) {
+		if ti, ok := ls.Get("model.diffusion_model." + name); ok {
+			return ti, true
+		}
+		return ls.Get(name)
+	}
+	dim := func(name string, i int, def uint64) uint64 {
+		if ti, ok := get(name); ok && int(ti.NDimensions) > i && ti.Dimensions[i] != 0 {
+			return ti.Dimensions[i]
+		}
+		return def
+	}
+
+	// Base, holds the timestep embedding, the context and the graph of the model.
+	const base = 32 * 1024 * 1024
+
+	// Latent, the autoencoder compresses the image by 8x8.
+	lw, lh := (uint64(width)+7)/8, (uint64(height)+7)/8
+
+	// Latent frames, the 3D autoencoder compresses the video by the given temporal factor,
+	// and keeps the first frame as-is.
+	lf := func(t uint64) uint64 {
+		if frames <= 1 {
+			return 1
+		}
+		return (uint64(frames)-1)/t + 1
+	}
+	// DiT usage, attends over l tokens with the given heads and width.
+	dit := func(l, heads, w uint64) uint64 {
+		u := l * w * 4 /* sizeof(float) */
+		if !flashAttention {
+			u += heads * l * l * 4 /* sizeof(float) */
+		}
+		return base + u
+	}
+
+	// UNet.
+	if c0 := dim("input_blocks.0.0.weight", 3, 0); c0 != 0 {
+		lf := lw * lh
+
+		// NB(thxCode): SD 1.x attends with 8 heads,
+		// others attend with 64 head dimension.
+		ctx := dim("input_blocks.1.1.transformer_blocks.0.attn2.to_k.weight", 0,
+			dim("input_blocks.4.1.transformer_blocks.0.attn2.to_k.weight", 0, 0))
+		if flashAttention && ctx == 768 {
+			return 0
+		}
+
+		var attn uint64
+		for _, ti := range ls.Search(regexp.MustCompile(`(input_blocks|middle_block|output_blocks)\.(\d+\.)?1\.transformer_blocks\.0\.attn1\.to_q\.weight$`)) {
+			if ti.NDimensions < 2 || ti.Dimensions[1] < c0 {
+				continue
+			}
+			inner := ti.Dimensions[1]
+			var lv uint64
+			for c0<<(lv+1) <= inner {
+				lv++
+			}
+			l := ((lw + 1<<lv - 1) >> lv) * ((lh + 1<<lv - 1) >> lv)
+			var u uint64
+			if flashAttention {
+				// Q/K/V/O and the GEGLU feed forward.
+				ff := dim(strings.TrimSuffix(strings.TrimPrefix(ti.Name, "model.diffusion_model."),
+					"attn1.to_q.weight")+"ff.net.0.proj.weight", 1, 8*inner)
+				u = l * (ff + ff/2 + 2*inner) * 4 /* sizeof(float) */
+			} else {
+				heads := inner / 64
+				if ctx == 768 {
+					heads = 8
+				}
+				// Attention scores, and the residuals at the latent resolution,
+				// which are the 3 skip connections of the first level,
+				// the input, the GroupNorm, the proj_in, the output and the residual of the transformer block,
+				// 8 feature maps of c0 channels.
+				u = heads*l*l*4 /* sizeof(float) */ + 8*c0*lf*4 /* sizeof(float) */
+			}
+			attn = max(attn, u)
+		}
+
+		// Convolution, the first output block of the first level concatenates the up-sampled features(2 x c0)
+		// and the skip connection(c0), so it holds the 3 skip connections(3 x c0),
+		// the concatenated input and its GroupNorm(2 x 3 x c0),
+		// the im2col of the 3x3 convolution over the input in F16(27 x c0 halves, 13.5 x c0 floats)
+		// and the output(c0) at the latent resolution, about 24 x c0 floats per latent pixel.
+		conv := 24 * c0 * lf * 4 /* sizeof(float) */
+
+		return base + max(attn, conv)
+	}
+
+	// MMDiT, SD 3.x.
+	if h := dim("joint_blocks.0.x_block.attn.qkv.weight", 0, 0); h != 0 {
+		if flashAttention {
+			return 0
+		}
+		p := dim("x_embedder.proj.weight", 0, 2)
+		heads := h / dim("joint_blocks.0.x_block.attn.ln_k.weight", 0, 64)
+		mlp := dim("joint_blocks.0.x_block.mlp.fc1.weight", 1, 4*h)
+
+		// Image tokens, and the text tokens of CLIP and T5.
+		l := ((lw+p-1)/p)*((lh+p-1)/p) + 154
+		return dit(l, heads, mlp+2*h)
+	}
+
+	// HunyuanVideo.
+	if h := dim("double_blocks.0.img_attn_qkv.weight", 0, 0); h != 0 {
+		mlp := dim("double_blocks.0.img_mlp.fc1.weight", 1, 4*h)
+
+		// Video tokens in 1x2x2 patches of 4x temporal compression, and the text tokens.
+		l := lf(4)*((lw+1)/2)*((lh+1)/2) + 256
+		return dit(l, h/128, mlp+2*h)
+	}
+
+	// FLUX.1.
+	if h := dim("double_blocks.0.img_attn.qkv.weight", 0, 0); h != 0 {
+		if flashAttention {
+			return 0
+		}
+		heads := h / dim("double_blocks.0.img_attn.norm.query_norm.scale", 0, 128)
+		w := dim("single_blocks.0.linear1.weight", 1, 7*h)
+
+		// Image tokens in 2x2 patches, and the text tokens of T5.
+		l := ((lw+1)/2)*((lh+1)/2) + 256
+		return dit(l, heads, 2*w+2*h)
+	}
+
+	// Qwen-Image.
+	if _, ok := get("transformer_blocks.0.img_mod.1.weight"); ok {
+		h := dim("transformer_blocks.0.attn.to_q.weight", 0, 3072)
+		heads := h / dim("transformer_blocks.0.attn.norm_q.weight", 0, 128)
+		mlp := dim("transformer_blocks.0.img_mlp.net.0.proj.weight", 1, 4*h)
+
+		// Image tokens in 2x2 patches, and the text tokens of Qwen2.5-VL.
+		l := ((lw+1)/2)*((lh+1)/2) + 256
+		return dit(l, heads, mlp+2*h)
+	}
+
+	// Wan.
+	if h := dim("blocks.0.self_attn.q.weight", 0, 0); h != 0 {
+		ffn := dim("blocks.0.ffn.0.weight", 1, 4*h)
+
+		// NB(thxCode): Wan 2.2 TI2V autoencoder compresses the image by 16x16 into 48 channels,
+		// others compress by 8x8 into 16 channels.
+		if dim("head.head.weight", 1, 0) == 48*4 {
+			lw, lh = (uint64(width)+15)/16, (uint64(height)+15)/16
+		}
+
+		// Video tokens in 1x2x2 patches of 4x temporal compression,
+		// the text tokens of UMT5 are cross attended.
+		l := lf(4) * ((lw + 1) / 2) * ((lh + 1) / 2)
+		u := dit(l, h/128, ffn+2*h)
+		if !flashAttention {
+			u += h / 128 * l * 512 * 4 /* sizeof(float) */
+		}
+		return u
+	}
+
+	// LTX-Video.
+	if _, ok := get("patchify_proj.weight"); ok {
+		h := dim("transformer_blocks.0.attn1.to_q.weight", 0, 2048)
+		ff := dim("transformer_blocks.0.ff.net.0.proj.weight", 1, 4*h)
+
+		// NB(thxCode): LTX-Video autoencoder compresses the video by 32x32 and 8x temporally,
+		// the latent is not patched.
+		l := lf(8) * ((uint64(width) + 31) / 32) * ((uint64(height) + 31) / 32)
+		return dit(l, h/64, ff+2*h)
+	}
+
+	return 0
+}
+
 // Types for StableDiffusionCpp estimated summary.
 type (
 	// StableDiffusionCppRunEstimateSummary represents the estimated summary of loading the GGUF file in stable-diffusion.cpp.
@@ -455,7 +1048,13 @@ func (e StableDiffusionCppRunEstimate) SummarizeItem(
 		cp := e.Devices[0].Computation
 
 		// UMA.
+		//
+		// NB(thxCode): stable-diffusion.cpp loads the tensors as-is from the GGUF file,
+		// so the weights kept in the CPU can be mapped instead of copying.
 		emi.RAM.UMA = fp + wg + cp
+		if !e.NoMMap && mmap {
+			emi.RAM.UMA -= wg
+		}
 
 		// NonUMA.
 		emi.RAM.NonUMA = GGUFBytesScalar(nonUMARamFootprint) + emi.RAM.UMA
@@ -474,6 +1073,9 @@ func (e StableDiffusionCppRunEstimate) SummarizeItem(
 
 			// UMA.
 			emi.VRAMs[i].UMA = fp + wg + /* cp */ 0
+			if !e.NoMMap && mmap && !d.Remote {
+				emi.VRAMs[i].UMA -= wg
+			}
 			if d.Remote {
 				emi.VRAMs[i].UMA += cp
 			}
@@ -505,6 +1107,34 @@ func (e StableDiffusionCppRunEstimate) SummarizeItem(
 		}
 	}
 
+	// Add LoRAs' usage.
+	//
+	// NB(thxCode): The LoRAs are merged one by one,
+	// so only the largest computation is counted.
+	if len(e.LoRAs) != 0 {
+		cps := make([]GGUFBytesScalar, len(e.Devices))
+		for i := range e.LoRAs {
+			for j, d := range e.LoRAs[i].Devices {
+				cps[j] = max(cps[j], d.Computation)
+				if j == 0 {
+					emi.RAM.UMA += d.Weight
+					emi.RAM.NonUMA += d.Weight
+					continue
+				}
+				emi.VRAMs[j-1].UMA += d.Weight
+				emi.VRAMs[j-1].NonUMA += d.Weight
+			}
+		}
+		emi.RAM.UMA += cps[0]
+		emi.RAM.NonUMA += cps[0]
+		for j, d := range e.Devices[1:] {
+			if d.Remote {
+				emi.VRAMs[j].UMA += cps[j+1]
+			}
+			emi.VRAMs[j].NonUMA += cps[j+1]
+		}
+	}
+
 	// Add upscaler's usage.
 	if e.Upscaler != nil {
 		uemi := e.Upscaler.SummarizeItem(mmap, 0, 0)
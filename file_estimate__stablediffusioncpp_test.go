@@ -2,6 +2,7 @@ package gguf_parser
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -92,3 +93,329 @@ func TestGGUFFile_EstimateStableDiffusionRun(t *testing.T) {
 		})
 	}
 }
+
+func testStableDiffusionGGUFFile(tensors map[string][]uint64) *GGUFFile {
+	var gf GGUFFile
+	for n, dims := range tensors {
+		gf.TensorInfos = append(gf.TensorInfos, GGUFTensorInfo{
+			Name:        n,
+			NDimensions: uint32(len(dims)),
+			Dimensions:  dims,
+			Type:        GGMLTypeF16,
+		})
+	}
+	return &gf
+}
+
+func TestGGUFFile_EstimateStableDiffusionRunWithMode(t *testing.T) {
+	sd := testStableDiffusionGGUFFile(map[string][]uint64{
+		"model.diffusion_model.output_blocks.11.1.transformer_blocks.0.attn2.to_v.weight":   {768, 320},
+		"cond_stage_model.transformer.text_model.encoder.layers.11.self_attn.k_proj.weight": {768, 768},
+		"first_stage_model.decoder.conv_in.weight":                                          {3, 3, 4, 512},
+		"first_stage_model.encoder.conv_in.weight":                                          {3, 3, 3, 128},
+		"first_stage_model.encoder.conv_out.weight":                                         {3, 3, 512, 8},
+		"first_stage_model.quant_conv.weight":                                               {1, 1, 8, 8},
+	})
+	esrgan := testStableDiffusionGGUFFile(map[string][]uint64{
+		"conv_first.weight": {3, 3, 3, 64},
+		"conv_up1.weight":   {3, 3, 64, 64},
+		"conv_up2.weight":   {3, 3, 64, 64},
+		"conv_last.weight":  {3, 3, 64, 3},
+	})
+
+	t.Run("txt2img vs img2img", func(t *testing.T) {
+		t2i := sd.EstimateStableDiffusionCppRun()
+		i2i := sd.EstimateStableDiffusionCppRun(WithStableDiffusionCppMode(StableDiffusionCppModeImageToImage))
+		if !t2i.ImageOnly || t2i.NoMMap {
+			t.Fatalf("expected image only and mmap supported, got %v and %v", t2i.ImageOnly, t2i.NoMMap)
+		}
+		var t2iW, i2iW GGUFBytesScalar
+		for i := range t2i.Autoencoder.Devices {
+			t2iW += t2i.Autoencoder.Devices[i].Weight
+			i2iW += i2i.Autoencoder.Devices[i].Weight
+		}
+		expected := GGUFBytesScalar((3*3*3*128 + 3*3*512*8 + 8*8) * 2)
+		if i2iW-t2iW != expected {
+			t.Fatalf("expected encoder weight %d, got %d", expected, i2iW-t2iW)
+		}
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		e := sd.EstimateStableDiffusionCppRun(WithStableDiffusionCppOffloadLayers(0))
+		var wg GGUFBytesScalar
+		wg += e.Devices[0].Weight + e.Autoencoder.Devices[0].Weight
+		for i := range e.Conditioners {
+			wg += e.Conditioners[i].Devices[0].Weight
+		}
+		if wg == 0 {
+			t.Fatal("expected weights in RAM")
+		}
+		m, nm := e.Summarize(true, 0, 0), e.Summarize(false, 0, 0)
+		if nm.Items[0].RAM.UMA-m.Items[0].RAM.UMA != wg {
+			t.Fatalf("expected mmap saves %d, got %d", wg, nm.Items[0].RAM.UMA-m.Items[0].RAM.UMA)
+		}
+	})
+
+	t.Run("upscaler", func(t *testing.T) {
+		ue := esrgan.EstimateStableDiffusionCppRun(
+			WithStableDiffusionCppWidth(512),
+			WithStableDiffusionCppHeight(512))
+		if ue.Architecture != "esrgan" || !ue.ImageOnly {
+			t.Fatalf("expected esrgan image only, got %q and %v", ue.Architecture, ue.ImageOnly)
+		}
+		if expected := GGUFBytesScalar(512 * 512 * 64 * 4 * 3); ue.Devices[1].Computation != expected {
+			t.Fatalf("expected upscaling computation %d, got %d", expected, ue.Devices[1].Computation)
+		}
+
+		e := sd.EstimateStableDiffusionCppRun(
+			WithStableDiffusionCppMode(StableDiffusionCppModeUpscale),
+			WithStableDiffusionCppUpscaler(&ue))
+		if e.Autoencoder != nil || len(e.Conditioners) != 0 || e.Devices[1].Weight != 0 {
+			t.Fatal("expected only upscaler is loaded")
+		}
+		es := e.Summarize(true, 0, 0)
+		us := ue.Summarize(true, 0, 0)
+		if es.Items[0].VRAMs[0].NonUMA != us.Items[0].VRAMs[0].NonUMA {
+			t.Fatalf("expected upscaler usage %d, got %d", us.Items[0].VRAMs[0].NonUMA, es.Items[0].VRAMs[0].NonUMA)
+		}
+	})
+
+	t.Run("autoencoder only", func(t *testing.T) {
+		vae := testStableDiffusionGGUFFile(map[string][]uint64{
+			"decoder.conv_in.weight":  {3, 3, 4, 512},
+			"decoder.conv_out.weight": {3, 3, 128, 3},
+			"encoder.conv_in.weight":  {3, 3, 3, 128},
+		})
+		e := vae.EstimateStableDiffusionCppRun()
+		if e.ImageOnly || e.Autoencoder == nil {
+			t.Fatal("expected autoencoder only")
+		}
+		if e.Devices[1].Weight != 0 || e.Devices[1].Computation != 0 {
+			t.Fatal("expected no diffusion model usage")
+		}
+		if expected := GGUFBytesScalar((3*3*4*512 + 3*3*128*3) * 2); e.Autoencoder.Devices[1].Weight != expected {
+			t.Fatalf("expected decoder weight %d, got %d", expected, e.Autoencoder.Devices[1].Weight)
+		}
+	})
+}
+
+func TestGGUFFile_EstimateStableDiffusionRunWithVideo(t *testing.T) {
+	wan := testStableDiffusionGGUFFile(map[string][]uint64{
+		"model.diffusion_model.blocks.0.self_attn.q.weight":                                                 {1536, 1536},
+		"model.diffusion_model.blocks.0.cross_attn.k.weight":                                                {1536, 1536},
+		"model.diffusion_model.blocks.0.ffn.0.weight":                                                       {1536, 8960},
+		"model.diffusion_model.head.head.weight":                                                            {1536, 64},
+		"cond_stage_model.transformer.encoder.block.1.layer.0.SelfAttention.relative_attention_bias.weight": {64, 32},
+		"first_stage_model.decoder.conv1.weight":                                                            {3, 3, 48, 384},
+	})
+
+	a := wan.Architecture()
+	if a.DiffusionArchitecture != "Wan 2.x" || !a.DiffusionVideo || !a.DiffusionTransformer {
+		t.Fatalf("expected Wan video transformer, got %q", a.DiffusionArchitecture)
+	}
+	if len(a.DiffusionConditioners) != 1 || a.DiffusionConditioners[0].Architecture != "Google UMT5-xxl" {
+		t.Fatalf("expected UMT5 conditioner, got %v", a.DiffusionConditioners)
+	}
+	if !a.DiffusionHasAutoencoder() || a.DiffusionAutoencoder.Architecture != "Wan 2.x 3D VAE" {
+		t.Fatalf("expected 3D autoencoder, got %v", a.DiffusionAutoencoder)
+	}
+
+	opts := []GGUFRunEstimateOption{
+		WithStableDiffusionCppWidth(832),
+		WithStableDiffusionCppHeight(480),
+	}
+	e1 := wan.EstimateStableDiffusionCppRun(append(opts, WithStableDiffusionCppFrameCount(1))...)
+	e81 := wan.EstimateStableDiffusionCppRun(append(opts, WithStableDiffusionCppFrameCount(81))...)
+	if e81.ImageOnly {
+		t.Fatal("expected video generation")
+	}
+	if e81.Devices[1].Computation <= e1.Devices[1].Computation {
+		t.Fatalf("expected more diffusing usage with more frames, got %d and %d", e81.Devices[1].Computation, e1.Devices[1].Computation)
+	}
+	if e81.Autoencoder.Devices[1].Computation != 4*e1.Autoencoder.Devices[1].Computation {
+		t.Fatalf("expected decoding usage of 4 frames, got %d and %d", e81.Autoencoder.Devices[1].Computation, e1.Autoencoder.Devices[1].Computation)
+	}
+
+	// Video tokens: 21 latent frames of 52x30 latent patches.
+	l := uint64(21 * 52 * 30)
+	expected := 32*1024*1024 + l*(8960+2*1536)*4 + 12*l*l*4 + 12*l*512*4
+	if actual := estimateStableDiffusionCppDiffusionComputation(wan.Layers(), 832, 480, 81, false); actual != expected {
+		t.Fatalf("expected %d, got %d", expected, actual)
+	}
+}
+
+func TestGGUFFile_EstimateStableDiffusionRunWithLoRAs(t *testing.T) {
+	flux := testStableDiffusionGGUFFile(map[string][]uint64{
+		"model.diffusion_model.double_blocks.0.txt_attn.proj.weight":                        {3072, 3072},
+		"model.diffusion_model.double_blocks.0.img_attn.qkv.weight":                         {3072, 9216},
+		"model.diffusion_model.input_blocks.1.1.transformer_blocks.0.attn1.to_q.weight":     {320, 320},
+		"cond_stage_model.transformer.text_model.encoder.layers.11.self_attn.k_proj.weight": {768, 768},
+	})
+	loras := []*GGUFFile{
+		// stable-diffusion.cpp.
+		testStableDiffusionGGUFFile(map[string][]uint64{
+			"lora.model.diffusion_model.double_blocks.0.img_attn.qkv.lora_down.weight": {3072, 16},
+			"lora.model.diffusion_model.double_blocks.0.img_attn.qkv.lora_up.weight":   {16, 9216},
+			"lora.model.diffusion_model.double_blocks.0.img_attn.qkv.alpha":            {1},
+			"lora.model.diffusion_model.unknown.lora_up.weight":                        {16, 9216},
+		}),
+		// Kohya.
+		testStableDiffusionGGUFFile(map[string][]uint64{
+			"lora_unet_double_blocks_0_txt_attn_proj.lora_down.weight":               {3072, 32},
+			"lora_unet_double_blocks_0_txt_attn_proj.lora_up.weight":                 {32, 3072},
+			"lora_te_text_model_encoder_layers_11_self_attn_k_proj.lora_down.weight": {768, 8},
+			"lora_te_text_model_encoder_layers_11_self_attn_k_proj.lora_up.weight":   {8, 768},
+			// Diffusers style UNet naming.
+			"lora_unet_down_blocks_0_attentions_0_transformer_blocks_0_attn1_to_q.lora_down.weight": {320, 4},
+			"lora_unet_down_blocks_0_attentions_0_transformer_blocks_0_attn1_to_q.lora_up.weight":   {4, 320},
+		}),
+	}
+	w0 := uint64((3072*16 + 16*9216 + 1) * 2)
+	w1 := uint64((3072*32 + 32*3072 + 320*4 + 4*320) * 2)
+	w1te := uint64((768*8 + 8*768) * 2)
+
+	t.Run("runtime", func(t *testing.T) {
+		e := flux.EstimateStableDiffusionCppRun(
+			WithStableDiffusionCppLoRAs(loras),
+			WithStableDiffusionCppLoRAApplyMode(StableDiffusionCppLoRAApplyModeRuntime))
+		if len(e.LoRAs) != 2 {
+			t.Fatalf("expected 2 LoRAs, got %d", len(e.LoRAs))
+		}
+		if e.LoRAs[0].Devices[1].Weight != GGUFBytesScalar(w0) {
+			t.Fatalf("expected weight %d, got %d", w0, e.LoRAs[0].Devices[1].Weight)
+		}
+		if e.LoRAs[1].Devices[1].Weight != GGUFBytesScalar(w1+w1te) {
+			t.Fatalf("expected weight %d, got %d", w1+w1te, e.LoRAs[1].Devices[1].Weight)
+		}
+		b := flux.EstimateStableDiffusionCppRun().Summarize(true, 0, 0)
+		es := e.Summarize(true, 0, 0)
+		if d := es.Items[0].VRAMs[0].NonUMA - b.Items[0].VRAMs[0].NonUMA; d != GGUFBytesScalar(w0+w1+w1te) {
+			t.Fatalf("expected stacked LoRAs usage %d, got %d", w0+w1+w1te, d)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		e := flux.EstimateStableDiffusionCppRun(WithStableDiffusionCppLoRAs(loras))
+		for i := range e.LoRAs {
+			if e.LoRAs[i].Devices[1].Weight != 0 {
+				t.Fatal("expected LoRA weights released after merging")
+			}
+		}
+		b := flux.EstimateStableDiffusionCppRun().Summarize(true, 0, 0)
+		es := e.Summarize(true, 0, 0)
+		expected := GGUFBytesScalar(max(w0+3072*9216*4, w1+w1te+3072*3072*4))
+		if d := es.Items[0].VRAMs[0].NonUMA - b.Items[0].VRAMs[0].NonUMA; d != expected {
+			t.Fatalf("expected merging usage %d, got %d", expected, d)
+		}
+	})
+}
+
+func TestStableDiffusionCppDiffusersUNetName(t *testing.T) {
+	cases := map[string]string{
+		"input_blocks.0.0":                                 "conv_in",
+		"input_blocks.1.0.in_layers.2":                     "down_blocks.0.resnets.0.conv1",
+		"input_blocks.2.1.proj_in":                         "down_blocks.0.attentions.1.proj_in",
+		"input_blocks.3.0.op":                              "down_blocks.0.downsamplers.0.conv",
+		"input_blocks.4.0.skip_connection":                 "down_blocks.1.resnets.0.conv_shortcut",
+		"middle_block.1.transformer_blocks.0.attn2.to_k":   "mid_block.attentions.0.transformer_blocks.0.attn2.to_k",
+		"middle_block.2.out_layers.3":                      "mid_block.resnets.1.conv2",
+		"output_blocks.2.1.conv":                           "up_blocks.0.upsamplers.0.conv",
+		"output_blocks.5.2.conv":                           "up_blocks.1.upsamplers.0.conv",
+		"output_blocks.11.1.transformer_blocks.0.ff.net.2": "up_blocks.3.attentions.2.transformer_blocks.0.ff.net.2",
+		"time_embed.2":                                     "time_embedding.linear_2",
+		"double_blocks.0.img_attn.qkv":                     "",
+	}
+	for n, expected := range cases {
+		actual, _ := stableDiffusionCppDiffusersUNetName(n)
+		if actual != expected {
+			t.Errorf("%s: expected %q, got %q", n, expected, actual)
+		}
+	}
+}
+
+func TestEstimateStableDiffusionCppDiffusionComputation(t *testing.T) {
+	unet := func(c0, ctx uint64, levels ...uint64) GGUFLayerTensorInfos {
+		tensors := map[string][]uint64{
+			"model.diffusion_model.input_blocks.0.0.weight": {3, 3, 4, c0},
+		}
+		for i, lv := range levels {
+			c := c0 << lv
+			p := fmt.Sprintf("model.diffusion_model.input_blocks.%d.1.transformer_blocks.0.", 1+3*lv)
+			if i == 0 {
+				// Keep the context probe stable.
+				tensors["model.diffusion_model.input_blocks.1.1.transformer_blocks.0.attn2.to_k.weight"] = []uint64{ctx, c}
+				tensors["model.diffusion_model.input_blocks.4.1.transformer_blocks.0.attn2.to_k.weight"] = []uint64{ctx, c}
+			}
+			tensors[p+"attn1.to_q.weight"] = []uint64{c, c}
+			tensors[p+"ff.net.0.proj.weight"] = []uint64{c, 8 * c}
+		}
+		return testStableDiffusionGGUFFile(tensors).Layers()
+	}
+	sd3 := func(h uint64, lnk bool) GGUFLayerTensorInfos {
+		tensors := map[string][]uint64{
+			"model.diffusion_model.x_embedder.proj.weight":                 {2, 2, 16, h},
+			"model.diffusion_model.joint_blocks.0.x_block.attn.qkv.weight": {h, 3 * h},
+			"model.diffusion_model.joint_blocks.0.x_block.mlp.fc1.weight":  {h, 4 * h},
+		}
+		if lnk {
+			tensors["model.diffusion_model.joint_blocks.0.x_block.attn.ln_k.weight"] = []uint64{64}
+		}
+		return testStableDiffusionGGUFFile(tensors).Layers()
+	}
+	flux := testStableDiffusionGGUFFile(map[string][]uint64{
+		"model.diffusion_model.double_blocks.0.img_attn.qkv.weight":            {3072, 9216},
+		"model.diffusion_model.double_blocks.0.img_attn.norm.query_norm.scale": {128},
+		"model.diffusion_model.single_blocks.0.linear1.weight":                 {3072, 21504},
+	}).Layers()
+
+	cases := []struct {
+		name   string
+		given  GGUFLayerTensorInfos
+		fa     bool
+		oracle func(width, height uint32, flashAttention bool) uint64
+	}{
+		{"sd1", unet(320, 768, 0, 1, 2), false, GuessSD1DiffusionModelMemoryUsage},
+		{"sd2", unet(320, 1024, 0, 1, 2), false, GuessSD2DiffusionModelMemoryUsage},
+		{"sd2 fa", unet(320, 1024, 0, 1, 2), true, GuessSD2DiffusionModelMemoryUsage},
+		{"sdxl", unet(320, 2048, 1, 2), false, GuessSDXLDiffusionModelMemoryUsage},
+		{"sdxl fa", unet(320, 2048, 1, 2), true, GuessSDXLDiffusionModelMemoryUsage},
+		{"sdxl refiner", unet(384, 1280, 1, 2), false, GuessSDXLRefinerDiffusionModelMemoryUsage},
+		{"sdxl refiner fa", unet(384, 1280, 1, 2), true, GuessSDXLRefinerDiffusionModelMemoryUsage},
+		{"sd3 medium", sd3(1536, false), false, GuessSD3MediumDiffusionModelMemoryUsage},
+		{"sd3.5 large", sd3(2432, true), false, GuessSD35LargeDiffusionModelMemoryUsage},
+		{"flux", flux, false, GuessFLUXDiffusionModelMemoryUsage},
+	}
+	// NB(thxCode): The regressions are not reliable in small sizes,
+	// e.g. the SD 2.x regression underflows at 512x512.
+	sizes := [][2]uint32{{1024, 1536}, {1536, 1024}, {1536, 1536}, {1792, 1792}, {1792, 2048}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, s := range sizes {
+				actual := estimateStableDiffusionCppDiffusionComputation(tc.given, s[0], s[1], 1, tc.fa)
+				expected := tc.oracle(s[0], s[1], tc.fa)
+				if r := float64(actual) / float64(expected); r < 0.85 || r > 1.15 {
+					t.Errorf("%dx%d: expected around %d, got %d", s[0], s[1], expected, actual)
+				}
+			}
+		})
+	}
+
+	t.Run("flash attention fallback", func(t *testing.T) {
+		// The flash attention usages of SD 1.x, SD 3.x and FLUX.1 fall back to the regressions.
+		for name, given := range map[string]GGUFLayerTensorInfos{
+			"sd1":        unet(320, 768, 0, 1, 2),
+			"sd3 medium": sd3(1536, false),
+			"flux":       flux,
+		} {
+			if actual := estimateStableDiffusionCppDiffusionComputation(given, 1024, 1024, 1, true); actual != 0 {
+				t.Errorf("%s: expected 0, got %d", name, actual)
+			}
+		}
+	})
+
+	t.Run("unrecognized", func(t *testing.T) {
+		if actual := estimateStableDiffusionCppDiffusionComputation(nil, 512, 512, 1, false); actual != 0 {
+			t.Errorf("expected 0, got %d", actual)
+		}
+	})
+}
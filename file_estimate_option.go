@@ -15,6 +15,7 @@ type (
 		FlashAttention      bool
 		MainGPUIndex        int
 		RPCServers          []string
+		RPCServerDevices    []int
 		TensorSplitFraction []float64
 		OverriddenTensors   []*GGUFRunOverriddenTensor
 		DeviceMetrics       []GGUFRunDeviceMetric
@@ -33,6 +34,8 @@ type (
 		LMCCacheKeyType                   *GGMLType
 		LMCCacheValueType                 *GGMLType
 		LMCOffloadKVCache                 *bool
+		LMCUnifiedKVCache                 *bool
+		LMCSlotContextSize                *int32
 		LMCOffloadLayers                  *uint64
 		LMCSplitMode                      LLaMACppSplitMode
 		LMCFullSizeSWACache               bool
@@ -41,16 +44,20 @@ type (
 		LMCAdapters                       []LLaMACppRunEstimate
 
 		// StableDiffusionCpp (SDC) specific
+		SDCMode                         StableDiffusionCppMode
 		SDCOffloadLayers                *uint64
 		SDCBatchCount                   *int32
 		SDCHeight                       *uint32
 		SDCWidth                        *uint32
+		SDCFrameCount                   *uint32
 		SDCOffloadConditioner           *bool
 		SDCOffloadAutoencoder           *bool
 		SDCAutoencoderTiling            *bool
 		SDCFreeComputeMemoryImmediately *bool
 		SDCUpscaler                     *StableDiffusionCppRunEstimate
 		SDCControlNet                   *StableDiffusionCppRunEstimate
+		SDCLoRAs                        []*GGUFFile
+		SDCLoRAApplyMode                StableDiffusionCppLoRAApplyMode
 	}
 
 	// GGUFRunOverriddenTensor holds the overridden tensor information for the estimate.
@@ -187,6 +194,39 @@ func WithRPCServers(srvs []string) GGUFRunEstimateOption {
 	}
 }
 
+// WithRPCServerDevices sets the device count of each RPC server for the estimate,
+// which works with WithRPCServers,
+// each RPC server has one device by default.
+//
+// Since the rpc-server of llama.cpp can expose multiple devices of its host,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/rpc/README.md.
+func WithRPCServerDevices(counts []int) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if len(counts) == 0 {
+			return
+		}
+		o.RPCServerDevices = counts
+	}
+}
+
+// rpcServerOfDevices returns the RPC server of each remote device.
+func rpcServerOfDevices(srvs []string, counts []int) []string {
+	if len(counts) == 0 {
+		return srvs
+	}
+	rs := make([]string, 0, len(srvs))
+	for i := range srvs {
+		n := 1
+		if i < len(counts) && counts[i] > 0 {
+			n = counts[i]
+		}
+		for j := 0; j < n; j++ {
+			rs = append(rs, srvs[i])
+		}
+	}
+	return rs
+}
+
 // WithTensorSplitFraction sets the tensor split cumulative fractions for the estimate.
 //
 // WithTensorSplitFraction accepts a variadic number of fractions,
@@ -272,6 +312,18 @@ func WithLLaMACppRoPE(
 	}
 }
 
+// WithLLaMACppSlotContextSize sets the context size of each parallel sequence (slot) for the estimate,
+// the context size is the slot context size multiplied by the parallel size,
+// which overrides WithLLaMACppContextSize.
+func WithLLaMACppSlotContextSize(size int32) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if size <= 0 {
+			return
+		}
+		o.LMCSlotContextSize = &size
+	}
+}
+
 // WithinLLaMACppMaxContextSize limits the context size to the maximum,
 // if the context size is over the maximum.
 func WithinLLaMACppMaxContextSize() GGUFRunEstimateOption {
@@ -311,21 +363,29 @@ var _GGUFEstimateCacheTypeAllowList = []GGMLType{
 	GGMLTypeQ5_0, GGMLTypeQ5_1,
 }
 
+// IsLLaMACppCacheTypeSupported returns true if the given type can be used as the cache key or value type,
+// which is one of F32, F16, BF16, Q8_0, Q4_0, Q4_1, IQ4_NL, Q5_0 and Q5_1.
+func IsLLaMACppCacheTypeSupported(t GGMLType) bool {
+	return slices.Contains(_GGUFEstimateCacheTypeAllowList, t)
+}
+
 // WithLLaMACppCacheKeyType sets the cache key type for the estimate.
+//
+// If the type is not supported by llama.cpp,
+// the estimate falls back to F16 and reports a warning.
 func WithLLaMACppCacheKeyType(t GGMLType) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
-		if slices.Contains(_GGUFEstimateCacheTypeAllowList, t) {
-			o.LMCCacheKeyType = &t
-		}
+		o.LMCCacheKeyType = &t
 	}
 }
 
 // WithLLaMACppCacheValueType sets the cache value type for the estimate.
+//
+// If the type is not supported by llama.cpp, or is quantized without flash attention,
+// the estimate falls back to F16 and reports a warning.
 func WithLLaMACppCacheValueType(t GGMLType) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
-		if slices.Contains(_GGUFEstimateCacheTypeAllowList, t) {
-			o.LMCCacheValueType = &t
-		}
+		o.LMCCacheValueType = &t
 	}
 }
 
@@ -336,6 +396,18 @@ func WithoutLLaMACppOffloadKVCache() GGUFRunEstimateOption {
 	}
 }
 
+// WithoutLLaMACppUnifiedKVCache disables the unified KV cache.
+//
+// By default, all parallel sequences share one KV cache of the context size,
+// which allows a sequence to use the cells freed by the others in continuous batching.
+// Without the unified KV cache, each sequence caches in its own stream of the context size divided by the parallel size,
+// which reduces the attention computation, but a sequence cannot exceed its own stream.
+func WithoutLLaMACppUnifiedKVCache() GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		o.LMCUnifiedKVCache = ptr.To(false)
+	}
+}
+
 // WithLLaMACppOffloadLayers sets the number of layers to offload.
 func WithLLaMACppOffloadLayers(layers uint64) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
@@ -354,6 +426,11 @@ const (
 )
 
 // WithLLaMACppSplitMode sets the split mode for the estimate.
+//
+// When split mode is LLaMACppSplitModeRow,
+// the matrix weights of the offloaded layers are split by row across the devices according to WithTensorSplitFraction,
+// and the rest of the offloaded layers, KV cache and output are placed on the main device,
+// which falls back to LLaMACppSplitModeLayer if there are RPC servers.
 func WithLLaMACppSplitMode(mode LLaMACppSplitMode) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
 		if mode < _LLAMACppSplitModeMax {
@@ -413,6 +490,37 @@ func WithLLaMACppAdapters(adp []LLaMACppRunEstimate) GGUFRunEstimateOption {
 	}
 }
 
+// StableDiffusionCppMode is the run mode for StableDiffusionCpp.
+type StableDiffusionCppMode uint
+
+const (
+	// StableDiffusionCppModeTextToImage generates images from prompts,
+	// the autoencoder only decodes.
+	StableDiffusionCppModeTextToImage StableDiffusionCppMode = iota
+	// StableDiffusionCppModeImageToImage generates images from prompts and initial images,
+	// the autoencoder encodes and decodes.
+	StableDiffusionCppModeImageToImage
+	// StableDiffusionCppModeUpscale upscales images with the upscaler only,
+	// the diffusion model, conditioners and autoencoder are not loaded.
+	StableDiffusionCppModeUpscale
+	// StableDiffusionCppModeTextToVideo generates videos from prompts,
+	// the autoencoder only decodes.
+	StableDiffusionCppModeTextToVideo
+	// StableDiffusionCppModeImageToVideo generates videos from prompts and initial images,
+	// the autoencoder encodes and decodes.
+	StableDiffusionCppModeImageToVideo
+	_StableDiffusionCppModeMax
+)
+
+// WithStableDiffusionCppMode sets the run mode for the estimate.
+func WithStableDiffusionCppMode(mode StableDiffusionCppMode) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if mode < _StableDiffusionCppModeMax {
+			o.SDCMode = mode
+		}
+	}
+}
+
 // WithStableDiffusionCppOffloadLayers sets the number of layers to offload.
 func WithStableDiffusionCppOffloadLayers(layers uint64) GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
@@ -450,6 +558,17 @@ func WithStableDiffusionCppWidth(width uint32) GGUFRunEstimateOption {
 	}
 }
 
+// WithStableDiffusionCppFrameCount sets the video frame count for the estimate,
+// only works for the video diffusion model.
+func WithStableDiffusionCppFrameCount(count uint32) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if count == 0 {
+			return
+		}
+		o.SDCFrameCount = ptr.To(count)
+	}
+}
+
 // WithoutStableDiffusionCppOffloadConditioner disables offloading the conditioner(text encoder).
 func WithoutStableDiffusionCppOffloadConditioner() GGUFRunEstimateOption {
 	return func(o *_GGUFRunEstimateOptions) {
@@ -491,3 +610,40 @@ func WithStableDiffusionCppControlNet(cn *StableDiffusionCppRunEstimate) GGUFRun
 		o.SDCControlNet = cn
 	}
 }
+
+// StableDiffusionCppLoRAApplyMode is the mode of applying the LoRA adapters for StableDiffusionCpp.
+type StableDiffusionCppLoRAApplyMode uint
+
+const (
+	// StableDiffusionCppLoRAApplyModeAuto merges the LoRA adapters at load if the target weights are not quantized,
+	// otherwise, applies them at runtime.
+	StableDiffusionCppLoRAApplyModeAuto StableDiffusionCppLoRAApplyMode = iota
+	// StableDiffusionCppLoRAApplyModeMerge merges the LoRA adapters into the target weights at load,
+	// the LoRA weights are released after merging.
+	StableDiffusionCppLoRAApplyModeMerge
+	// StableDiffusionCppLoRAApplyModeRuntime applies the LoRA adapters at runtime,
+	// the LoRA weights are kept along with the target weights.
+	StableDiffusionCppLoRAApplyModeRuntime
+	_StableDiffusionCppLoRAApplyModeMax
+)
+
+// WithStableDiffusionCppLoRAs sets the LoRA adapters to apply,
+// the tensors of each adapter are matched to the target tensors of the diffusion model, conditioners and autoencoder,
+// the unmatched tensors are ignored.
+func WithStableDiffusionCppLoRAs(loras []*GGUFFile) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if len(loras) == 0 {
+			return
+		}
+		o.SDCLoRAs = loras
+	}
+}
+
+// WithStableDiffusionCppLoRAApplyMode sets the mode of applying the LoRA adapters.
+func WithStableDiffusionCppLoRAApplyMode(mode StableDiffusionCppLoRAApplyMode) GGUFRunEstimateOption {
+	return func(o *_GGUFRunEstimateOptions) {
+		if mode < _StableDiffusionCppLoRAApplyModeMax {
+			o.SDCLoRAApplyMode = mode
+		}
+	}
+}
@@ -58,7 +58,28 @@ func ParseGGUFFileFromOllamaModel(ctx context.Context, model *OllamaModel, opts
 		}()
 	}
 
-	var cli *http.Client
+	cli := ollamaClient(o)
+
+	var ml OllamaModelLayer
+	{
+		err := model.Complete(ctx, cli)
+		if err != nil {
+			return nil, fmt.Errorf("complete ollama model: %w", err)
+		}
+
+		var ok bool
+		ml, ok = model.GetLayer("application/vnd.ollama.image.model")
+		if !ok {
+			return nil, ErrOllamaBaseLayerNotFound
+		}
+	}
+
+	return parseGGUFFileFromRemote(ctx, cli, ml.BlobURL().String(), o)
+}
+
+// ollamaClient returns the http.Client to access the Ollama registry,
+// which authorizes the request automatically.
+func ollamaClient(o _GGUFReadOptions) (cli *http.Client) {
 	cli = httpx.Client(
 		httpx.ClientOptions().
 			WithUserAgent(OllamaUserAgent()).
@@ -87,20 +108,5 @@ func ParseGGUFFileFromOllamaModel(ctx context.Context, model *OllamaModel, opts
 					If(o.SkipDNSCache, func(x *httpx.TransportOption) *httpx.TransportOption {
 						return x.WithoutDNSCache()
 					})))
-
-	var ml OllamaModelLayer
-	{
-		err := model.Complete(ctx, cli)
-		if err != nil {
-			return nil, fmt.Errorf("complete ollama model: %w", err)
-		}
-
-		var ok bool
-		ml, ok = model.GetLayer("application/vnd.ollama.image.model")
-		if !ok {
-			return nil, ErrOllamaBaseLayerNotFound
-		}
-	}
-
-	return parseGGUFFileFromRemote(ctx, cli, ml.BlobURL().String(), o)
+	return cli
 }
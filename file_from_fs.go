@@ -0,0 +1,142 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// ParseGGUFFileFromReaderAt parses a GGUF file from the given io.ReaderAt with the given size,
+// and returns a GGUFFile, or an error if any.
+//
+// The io.ReaderAt is not closed after parsing.
+func ParseGGUFFileFromReaderAt(r io.ReaderAt, size int64, opts ...GGUFReadOption) (*GGUFFile, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fs := []_GGUFFileReadSeeker{
+		{
+			ReadSeeker: io.NewSectionReader(r, 0, size),
+			Size:       size,
+		},
+	}
+
+	return parseGGUFFile(fs, o)
+}
+
+// ParseGGUFFileFS parses a GGUF file from the given fs.FS,
+// and returns a GGUFFile, or an error if any.
+//
+// If the name is a shard of a split GGUF file,
+// e.g. model-00001-of-00003.gguf, all shards are opened from the same fs.FS.
+//
+// The file opened from the fs.FS is read in random access if it implements io.ReaderAt or io.Seeker,
+// otherwise, it is read in sequence,
+// e.g. the compressed entry of a zip archive, which is never loaded into memory entirely.
+func ParseGGUFFileFS(fsys fs.FS, name string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	if fsys == nil {
+		return nil, errors.New("fs is nil")
+	}
+
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var names []string
+	{
+		rs := CompleteShardGGUFFilename(name)
+		if rs != nil {
+			names = rs
+		} else {
+			names = []string{name}
+		}
+	}
+
+	fs := make([]_GGUFFileReadSeeker, 0, len(names))
+	defer func() {
+		for i := range fs {
+			osx.Close(fs[i])
+		}
+	}()
+
+	for i := range names {
+		f, err := fsys.Open(names[i])
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			osx.Close(f)
+			return nil, fmt.Errorf("stat file: %w", err)
+		}
+
+		var rs io.ReadSeeker
+		switch ff := f.(type) {
+		case io.ReaderAt:
+			rs = io.NewSectionReader(ff, 0, fi.Size())
+		case io.ReadSeeker:
+			rs = ff
+		default:
+			rs = &_GGUFForwardSeeker{r: f}
+		}
+
+		fs = append(fs, _GGUFFileReadSeeker{
+			Name:       names[i],
+			Closer:     f,
+			ReadSeeker: rs,
+			Size:       fi.Size(),
+		})
+	}
+
+	return parseGGUFFile(fs, o)
+}
+
+// _GGUFForwardSeeker wraps an io.Reader as an io.ReadSeeker,
+// which only supports seeking forward from the current position.
+//
+// NB(thxCode): Parsing seeks forward only to skip the unnecessary bytes,
+// so it is enough for reading from a sequential stream.
+type _GGUFForwardSeeker struct {
+	r   io.Reader
+	off int64
+}
+
+func (s *_GGUFForwardSeeker) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.off += int64(n)
+	return n, err
+}
+
+func (s *_GGUFForwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		offset -= s.off
+	case io.SeekCurrent:
+	default:
+		return s.off, errors.New("seek: unsupported whence")
+	}
+	if offset < 0 {
+		return s.off, errors.New("seek: backward seeking is not supported")
+	}
+	if offset > 0 {
+		n, err := io.CopyN(io.Discard, s.r, offset)
+		s.off += n
+		if err != nil {
+			return s.off, err
+		}
+	}
+	return s.off, nil
+}
@@ -0,0 +1,99 @@
+package gguf_parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseGGUFFileFromReaderAt(t *testing.T) {
+	kvs, tis := testSplitGGUFFileShards(1)
+	bs := testGGUFFileBytes(kvs[0][:1], tis[0])
+
+	f, err := ParseGGUFFileFromReaderAt(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.TensorInfos) != 1 {
+		t.Fatalf("expected 1 tensor, got %d", len(f.TensorInfos))
+	}
+	if int64(f.Size) != int64(len(bs)) {
+		t.Fatalf("expected size %d, got %d", len(bs), f.Size)
+	}
+
+	if _, err = ParseGGUFFileFromReaderAt(bytes.NewReader(bs), int64(len(bs))/2); err == nil {
+		t.Fatal("expected error with truncated size")
+	}
+}
+
+func TestParseGGUFFileFS(t *testing.T) {
+	shards := testSplitGGUFFileBytes(3)
+
+	// Random access.
+	mfs := fstest.MapFS{
+		"models/qwen-00001-of-00003.gguf": {Data: shards[0]},
+		"models/qwen-00002-of-00003.gguf": {Data: shards[1]},
+		"models/qwen-00003-of-00003.gguf": {Data: shards[2]},
+	}
+
+	// Sequential access.
+	var zfs fs.FS
+	{
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i, n := range []string{
+			"models/qwen-00001-of-00003.gguf",
+			"models/qwen-00002-of-00003.gguf",
+			"models/qwen-00003-of-00003.gguf",
+		} {
+			w, err := zw.Create(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = w.Write(shards[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zfs = zr
+	}
+
+	cases := []struct {
+		name string
+		fsys fs.FS
+	}{
+		{"map", mfs},
+		{"zip", zfs},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseGGUFFileFS(tc.fsys, "models/qwen-00002-of-00003.gguf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.TensorInfos) != 3 {
+				t.Fatalf("expected 3 tensors, got %d", len(f.TensorInfos))
+			}
+			if len(f.SplitSizes) != 3 {
+				t.Fatalf("expected 3 splits, got %d", len(f.SplitSizes))
+			}
+		})
+	}
+
+	t.Run("missing shard", func(t *testing.T) {
+		delete(mfs, "models/qwen-00003-of-00003.gguf")
+		_, err := ParseGGUFFileFS(mfs, "models/qwen-00001-of-00003.gguf")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected not exist, got %v", err)
+		}
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/gpustack/gguf-parser-go/util/httpx"
 	"github.com/gpustack/gguf-parser-go/util/osx"
 )
@@ -59,57 +61,60 @@ func ParseGGUFFileRemote(ctx context.Context, url string, opts ...GGUFReadOption
 		}()
 	}
 
-	cli := httpx.Client(
-		httpx.ClientOptions().
-			WithUserAgent("gguf-parser-go").
-			If(o.Debug,
-				func(x *httpx.ClientOption) *httpx.ClientOption {
-					return x.WithDebug()
-				},
-			).
-			If(o.BearerAuthToken != "",
-				func(x *httpx.ClientOption) *httpx.ClientOption {
-					return x.WithBearerAuth(o.BearerAuthToken)
-				},
-			).
-			If(len(o.Headers) > 0,
-				func(x *httpx.ClientOption) *httpx.ClientOption {
-					return x.WithHeaders(o.Headers)
-				},
-			).
-			WithTimeout(0).
-			WithTransport(
-				httpx.TransportOptions().
-					WithoutKeepalive().
-					TimeoutForDial(5*time.Second).
-					TimeoutForTLSHandshake(5*time.Second).
-					TimeoutForResponseHeader(5*time.Second).
-					If(o.SkipProxy,
-						func(x *httpx.TransportOption) *httpx.TransportOption {
-							return x.WithoutProxy()
-						},
-					).
-					If(o.ProxyURL != nil,
-						func(x *httpx.TransportOption) *httpx.TransportOption {
-							return x.WithProxy(http.ProxyURL(o.ProxyURL))
-						},
-					).
-					If(o.SkipTLSVerification || !strings.HasPrefix(url, "https://"),
-						func(x *httpx.TransportOption) *httpx.TransportOption {
-							return x.WithoutInsecureVerify()
-						},
-					).
-					If(o.SkipDNSCache,
-						func(x *httpx.TransportOption) *httpx.TransportOption {
-							return x.WithoutDNSCache()
-						},
-					),
-			),
-	)
+	cli := httpx.Client(remoteClientOptions(url, o))
 
 	return parseGGUFFileFromRemote(ctx, cli, url, o)
 }
 
+// remoteClientOptions returns the httpx.ClientOption to read the given remote url.
+func remoteClientOptions(url string, o _GGUFReadOptions) *httpx.ClientOption {
+	return httpx.ClientOptions().
+		WithUserAgent("gguf-parser-go").
+		If(o.Debug,
+			func(x *httpx.ClientOption) *httpx.ClientOption {
+				return x.WithDebug()
+			},
+		).
+		If(o.BearerAuthToken != "",
+			func(x *httpx.ClientOption) *httpx.ClientOption {
+				return x.WithBearerAuth(o.BearerAuthToken)
+			},
+		).
+		If(len(o.Headers) > 0,
+			func(x *httpx.ClientOption) *httpx.ClientOption {
+				return x.WithHeaders(o.Headers)
+			},
+		).
+		WithTimeout(0).
+		WithTransport(
+			httpx.TransportOptions().
+				WithoutKeepalive().
+				TimeoutForDial(5*time.Second).
+				TimeoutForTLSHandshake(5*time.Second).
+				TimeoutForResponseHeader(5*time.Second).
+				If(o.SkipProxy,
+					func(x *httpx.TransportOption) *httpx.TransportOption {
+						return x.WithoutProxy()
+					},
+				).
+				If(o.ProxyURL != nil,
+					func(x *httpx.TransportOption) *httpx.TransportOption {
+						return x.WithProxy(http.ProxyURL(o.ProxyURL))
+					},
+				).
+				If(o.SkipTLSVerification || !strings.HasPrefix(url, "https://"),
+					func(x *httpx.TransportOption) *httpx.TransportOption {
+						return x.WithoutInsecureVerify()
+					},
+				).
+				If(o.SkipDNSCache,
+					func(x *httpx.TransportOption) *httpx.TransportOption {
+						return x.WithoutDNSCache()
+					},
+				),
+		)
+}
+
 func parseGGUFFileFromRemote(ctx context.Context, cli *http.Client, url string, o _GGUFReadOptions) (*GGUFFile, error) {
 	var urls []string
 	{
@@ -121,38 +126,62 @@ func parseGGUFFileFromRemote(ctx context.Context, cli *http.Client, url string,
 		}
 	}
 
-	fs := make([]_GGUFFileReadSeeker, 0, len(urls))
+	fs := make([]_GGUFFileReadSeeker, len(urls))
 	defer func() {
 		for i := range fs {
-			osx.Close(fs[i])
+			if fs[i].Closer != nil {
+				osx.Close(fs[i])
+			}
 		}
 	}()
 
+	// NB(thxCode): Most of the time spent on parsing a split GGUF file from remote is round-trip latency,
+	// so we open and read the shards concurrently, and merge the results in shard order.
+	ss := make([]*_GGUFFileShard, len(urls))
+	cc := o.ShardConcurrency
+	if cc <= 0 {
+		cc = 8
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(cc)
 	for i := range urls {
-		req, err := httpx.NewGetRequestWithContext(ctx, urls[i])
-		if err != nil {
-			return nil, fmt.Errorf("new request: %w", err)
-		}
+		x := i
+		eg.Go(func() error {
+			req, err := httpx.NewGetRequestWithContext(ctx, urls[x])
+			if err != nil {
+				return fmt.Errorf("new request: %w", err)
+			}
 
-		sf, err := httpx.OpenSeekerFile(cli, req,
-			httpx.SeekerFileOptions().
-				WithBufferSize(o.BufferSize).
-				If(o.SkipRangeDownloadDetection,
-					func(x *httpx.SeekerFileOption) *httpx.SeekerFileOption {
-						return x.WithoutRangeDownloadDetect()
-					},
-				),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("open http file: %w", err)
-		}
+			sf, err := httpx.OpenSeekerFile(cli, req,
+				httpx.SeekerFileOptions().
+					WithBufferSize(o.BufferSize).
+					If(o.SkipRangeDownloadDetection,
+						func(x *httpx.SeekerFileOption) *httpx.SeekerFileOption {
+							return x.WithoutRangeDownloadDetect()
+						},
+					),
+			)
+			if err != nil {
+				return fmt.Errorf("open http file: %w", err)
+			}
 
-		fs = append(fs, _GGUFFileReadSeeker{
-			Closer:     sf,
-			ReadSeeker: io.NewSectionReader(sf, 0, sf.Len()),
-			Size:       sf.Len(),
+			fs[x] = _GGUFFileReadSeeker{
+				Name:       urls[x],
+				Closer:     sf,
+				ReadSeeker: io.NewSectionReader(sf, 0, sf.Len()),
+				Size:       sf.Len(),
+			}
+
+			ss[x], err = parseGGUFFileShard(fs[x], o)
+			if err != nil && len(urls) > 1 {
+				err = &GGUFFileShardError{Index: x, Total: len(urls), Name: urls[x], Err: err}
+			}
+			return err
 		})
 	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
 
-	return parseGGUFFile(fs, o)
+	return mergeGGUFFileShards(ss)
 }
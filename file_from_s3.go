@@ -0,0 +1,196 @@
+package gguf_parser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/httpx"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+var ErrS3InvalidObject = errors.New("s3 invalid object")
+
+// ParseGGUFFileFromS3 parses a GGUF file from an S3 compatible storage,
+// and returns a GGUFFile, or an error if any.
+//
+// The requests are signed with the AWS Signature Version 4,
+// see UseS3Endpoint, UseS3Region, UseS3PathStyle, UseS3Credentials and UseS3Profile for configuring.
+//
+// If the key is a shard of a split GGUF file,
+// e.g. model-00001-of-00003.gguf, all shards are parsed together.
+func ParseGGUFFileFromS3(ctx context.Context, bucket, key string, opts ...GGUFReadOption) (gf *GGUFFile, err error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	bucket = strings.TrimSpace(bucket)
+	key = strings.TrimPrefix(strings.TrimSpace(key), "/")
+	if bucket == "" || key == "" {
+		return nil, ErrS3InvalidObject
+	}
+
+	completeS3Options(&o)
+
+	u, err := s3ObjectURL(o, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("s3 object url: %w", err)
+	}
+
+	// Cache.
+	{
+		if o.CachePath != "" {
+			o.CachePath = filepath.Join(o.CachePath, "remote")
+			if o.SkipLargeMetadata {
+				o.CachePath = filepath.Join(o.CachePath, "brief")
+			}
+		}
+		c := GGUFFileCache(o.CachePath)
+
+		// Get from cache.
+		if gf, err = c.Get(u, o.CacheExpiration); err == nil {
+			return gf, nil
+		}
+
+		// Put to cache.
+		defer func() {
+			if err == nil {
+				_ = c.Put(u, gf)
+			}
+		}()
+	}
+
+	cli := httpx.Client(
+		remoteClientOptions(u, o).
+			WithAWSSigV4Auth(o.S3AccessKeyID, o.S3SecretAccessKey, o.S3SessionToken, o.S3Region, "s3"))
+
+	return parseGGUFFileFromRemote(ctx, cli, u, o)
+}
+
+// s3ObjectURL returns the url of the given object,
+// in path-style or virtual-hosted-style addressing.
+func s3ObjectURL(o _GGUFReadOptions, bucket, key string) (string, error) {
+	ep := o.S3Endpoint
+	if !strings.Contains(ep, "://") {
+		ep = "https://" + ep
+	}
+	u, err := url.Parse(ep)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid endpoint %q", o.S3Endpoint)
+	}
+
+	p := strings.TrimSuffix(u.Path, "/")
+	if o.S3PathStyle {
+		p += "/" + bucket
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	u.Path = p + "/" + key
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// completeS3Options completes the S3 options with the environment variables,
+// and the AWS shared credentials and config files.
+func completeS3Options(o *_GGUFReadOptions) {
+	if o.S3Profile == "" {
+		o.S3Profile = s3Getenv("AWS_PROFILE", "default")
+	}
+
+	// Credentials.
+	if o.S3AccessKeyID == "" || o.S3SecretAccessKey == "" {
+		o.S3AccessKeyID = s3Getenv("AWS_ACCESS_KEY_ID")
+		o.S3SecretAccessKey = s3Getenv("AWS_SECRET_ACCESS_KEY")
+		o.S3SessionToken = s3Getenv("AWS_SESSION_TOKEN")
+	}
+	if o.S3AccessKeyID == "" || o.S3SecretAccessKey == "" {
+		p := s3Getenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(osx.UserHomeDir(), ".aws", "credentials"))
+		kvs := readAWSProfile(p, o.S3Profile, false)
+		o.S3AccessKeyID = kvs["aws_access_key_id"]
+		o.S3SecretAccessKey = kvs["aws_secret_access_key"]
+		o.S3SessionToken = kvs["aws_session_token"]
+	}
+
+	// Region and endpoint.
+	p := s3Getenv("AWS_CONFIG_FILE", filepath.Join(osx.UserHomeDir(), ".aws", "config"))
+	kvs := readAWSProfile(p, o.S3Profile, true)
+	if o.S3Region == "" {
+		o.S3Region = s3Getenv("AWS_REGION", s3Getenv("AWS_DEFAULT_REGION", kvs["region"], "us-east-1"))
+	}
+	if o.S3Endpoint == "" {
+		o.S3Endpoint = s3Getenv("AWS_ENDPOINT_URL_S3",
+			s3Getenv("AWS_ENDPOINT_URL", kvs["endpoint_url"], fmt.Sprintf("https://s3.%s.amazonaws.com", o.S3Region)))
+		o.S3Endpoint = strings.TrimSuffix(o.S3Endpoint, "/")
+	}
+	if !o.S3PathStyle {
+		o.S3PathStyle = kvs["addressing_style"] == "path"
+	}
+}
+
+// s3Getenv is similar to osx.Getenv,
+// but treats the empty value as unset,
+// and returns the first non-empty default.
+func s3Getenv(key string, def ...string) string {
+	if v := strings.TrimSpace(osx.Getenv(key)); v != "" {
+		return v
+	}
+	for _, v := range def {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readAWSProfile reads the key-value pairs of the given profile from the AWS shared file,
+// the sub-section(e.g. s3 = ...) items are flattened into the result.
+//
+// The profile section of the config file is named as "[profile <name>]",
+// except the default profile.
+func readAWSProfile(path, profile string, config bool) map[string]string {
+	kvs := map[string]string{}
+
+	f, err := osx.Open(path)
+	if err != nil {
+		return kvs
+	}
+	defer osx.Close(f)
+
+	section := profile
+	if config && profile != "default" {
+		section = "profile " + profile
+	}
+
+	var in bool
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		switch {
+		case l == "" || l[0] == '#' || l[0] == ';':
+			continue
+		case l[0] == '[' && l[len(l)-1] == ']':
+			in = strings.Join(strings.Fields(l[1:len(l)-1]), " ") == section
+			continue
+		case !in:
+			continue
+		}
+		k, v, ok := strings.Cut(l, "=")
+		if !ok {
+			continue
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		kvs[k] = v
+	}
+	return kvs
+}
@@ -0,0 +1,625 @@
+package gguf_parser
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/gpustack/gguf-parser-go/util/httpx"
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// ErrSafetensorsInvalidHeader is returned when the header of the safetensors file is invalid.
+var ErrSafetensorsInvalidHeader = errors.New("invalid safetensors header")
+
+// ParseSafetensorsFile parses a safetensors file from the local given path,
+// and returns a GGUFFile converted from the header, or an error if any.
+//
+// Only the header of the safetensors file is read,
+// the tensors are renamed and reshaped in the GGUF convention,
+// and the config.json beside the file fills the architecture metadata,
+// so that the GGUFFile can be estimated before converting.
+//
+// If the path is a shard of a split safetensors file,
+// e.g. model-00001-of-00004.safetensors, all shards are parsed together.
+//
+// Like ParseGGUFFile, UseMMap reads the headers through mmap.
+func ParseSafetensorsFile(path string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var paths []string
+	{
+		rs := CompleteShardSafetensorsFilename(path)
+		if rs != nil {
+			paths = rs
+		} else {
+			paths = []string{path}
+		}
+	}
+
+	ss := make([]_SafetensorsShard, len(paths))
+	for i := range paths {
+		var (
+			r   io.ReadSeeker
+			c   io.Closer
+			err error
+		)
+		if o.MMap {
+			mf, merr := osx.OpenMmapFile(paths[i])
+			if merr != nil {
+				return nil, fmt.Errorf("open mmap file: %w", merr)
+			}
+			r, c = io.NewSectionReader(mf, 0, mf.Len()), mf
+		} else {
+			f, ferr := osx.Open(paths[i])
+			if ferr != nil {
+				return nil, fmt.Errorf("open file: %w", ferr)
+			}
+			r, c = f, f
+		}
+		ss[i], err = parseSafetensorsShard(r)
+		osx.Close(c)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", paths[i], err)
+		}
+	}
+
+	cfg, err := os.ReadFile(filepath.Join(filepath.Dir(path), "config.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	return convertSafetensorsShards(ss, cfg)
+}
+
+// ParseSafetensorsFileFromHuggingFace parses a safetensors file from Hugging Face(https://huggingface.co/),
+// and returns a GGUFFile converted from the header, or an error if any.
+func ParseSafetensorsFileFromHuggingFace(ctx context.Context, repo, file string, opts ...GGUFReadOption) (*GGUFFile, error) {
+	ep := osx.Getenv("HF_ENDPOINT", "https://huggingface.co")
+	return ParseSafetensorsFileRemote(ctx, fmt.Sprintf("%s/%s/resolve/main/%s", ep, repo, file), opts...)
+}
+
+// ParseSafetensorsFileRemote parses a safetensors file from a remote BlobURL,
+// and returns a GGUFFile converted from the header, or an error if any.
+//
+// Only the header of the safetensors file is read in range,
+// and the config.json beside the file fills the architecture metadata.
+func ParseSafetensorsFileRemote(ctx context.Context, url string, opts ...GGUFReadOption) (gf *GGUFFile, err error) {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Cache.
+	{
+		if o.CachePath != "" {
+			o.CachePath = filepath.Join(o.CachePath, "remote", "safetensors")
+		}
+		c := GGUFFileCache(o.CachePath)
+
+		// Get from cache.
+		if gf, err = c.Get(url, o.CacheExpiration); err == nil {
+			return gf, nil
+		}
+
+		// Put to cache.
+		defer func() {
+			if err == nil {
+				_ = c.Put(url, gf)
+			}
+		}()
+	}
+
+	cli := httpx.Client(remoteClientOptions(url, o))
+
+	var urls []string
+	{
+		rs := CompleteShardSafetensorsFilename(url)
+		if rs != nil {
+			urls = rs
+		} else {
+			urls = []string{url}
+		}
+	}
+
+	ss := make([]_SafetensorsShard, len(urls))
+	var cfg []byte
+	cc := o.ShardConcurrency
+	if cc <= 0 {
+		cc = 8
+	}
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(cc)
+	for i := range urls {
+		x := i
+		eg.Go(func() error {
+			req, err := httpx.NewGetRequestWithContext(egCtx, urls[x])
+			if err != nil {
+				return fmt.Errorf("new request: %w", err)
+			}
+
+			sf, err := httpx.OpenSeekerFile(cli, req,
+				httpx.SeekerFileOptions().
+					WithBufferSize(o.BufferSize).
+					If(o.SkipRangeDownloadDetection,
+						func(x *httpx.SeekerFileOption) *httpx.SeekerFileOption {
+							return x.WithoutRangeDownloadDetect()
+						},
+					),
+			)
+			if err != nil {
+				return fmt.Errorf("open http file: %w", err)
+			}
+			defer osx.Close(sf)
+
+			ss[x], err = parseSafetensorsShard(io.NewSectionReader(sf, 0, sf.Len()))
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", urls[x], err)
+			}
+			return nil
+		})
+	}
+	eg.Go(func() error {
+		req, err := httpx.NewGetRequestWithContext(egCtx, url[:strings.LastIndex(url, "/")+1]+"config.json")
+		if err != nil {
+			return fmt.Errorf("new request: %w", err)
+		}
+		return httpx.Do(cli, req, func(resp *http.Response) error {
+			switch resp.StatusCode {
+			case http.StatusOK:
+			case http.StatusNotFound:
+				return nil
+			default:
+				return fmt.Errorf("get config: status %s", resp.Status)
+			}
+			cfg, err = io.ReadAll(resp.Body)
+			return err
+		})
+	})
+	if err = eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return convertSafetensorsShards(ss, cfg)
+}
+
+// Types for safetensors.
+type (
+	// _SafetensorsShard holds the header of a safetensors file.
+	_SafetensorsShard struct {
+		// Size is the size of the file.
+		Size int64
+		// HeaderSize is the size of the JSON header,
+		// the tensor data starts at 8 + HeaderSize.
+		HeaderSize int64
+		// Tensors is the tensors in the file.
+		Tensors []_SafetensorsTensor
+	}
+
+	// _SafetensorsTensor holds a tensor described by the header of a safetensors file.
+	_SafetensorsTensor struct {
+		Name        string    `json:"-"`
+		DType       string    `json:"dtype"`
+		Shape       []uint64  `json:"shape"`
+		DataOffsets [2]uint64 `json:"data_offsets"`
+	}
+)
+
+// parseSafetensorsShard parses the header of a safetensors file,
+// see https://github.com/huggingface/safetensors#format.
+func parseSafetensorsShard(r io.ReadSeeker) (s _SafetensorsShard, err error) {
+	s.Size, err = r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return s, fmt.Errorf("seek end: %w", err)
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return s, fmt.Errorf("seek start: %w", err)
+	}
+
+	var n uint64
+	if err = binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return s, fmt.Errorf("read header size: %w", err)
+	}
+	// NB(thxCode): The header is limited to 100MB by the reference implementation.
+	if n == 0 || n > 100*1024*1024 || int64(n)+8 > s.Size {
+		return s, fmt.Errorf("%w: header size %d", ErrSafetensorsInvalidHeader, n)
+	}
+	s.HeaderSize = int64(n)
+
+	bs := make([]byte, n)
+	if _, err = io.ReadFull(r, bs); err != nil {
+		return s, fmt.Errorf("read header: %w", err)
+	}
+	var h map[string]json.RawMessage
+	if err = json.Unmarshal(bs, &h); err != nil {
+		return s, fmt.Errorf("%w: %v", ErrSafetensorsInvalidHeader, err)
+	}
+
+	s.Tensors = make([]_SafetensorsTensor, 0, len(h))
+	for k, v := range h {
+		if k == "__metadata__" {
+			continue
+		}
+		t := _SafetensorsTensor{Name: k}
+		if err = json.Unmarshal(v, &t); err != nil {
+			return s, fmt.Errorf("%w: tensor %s: %v", ErrSafetensorsInvalidHeader, k, err)
+		}
+		s.Tensors = append(s.Tensors, t)
+	}
+	// Keep the order of the tensor data.
+	sort.Slice(s.Tensors, func(i, j int) bool {
+		return s.Tensors[i].DataOffsets[0] < s.Tensors[j].DataOffsets[0]
+	})
+	return s, nil
+}
+
+// _SafetensorsDTypes maps the safetensors dtype to the GGMLType in the same size.
+//
+// NB(thxCode): There is no 8-bit float type in GGML,
+// so the 8-bit float and boolean types are counted as GGMLTypeI8.
+var _SafetensorsDTypes = map[string]GGMLType{
+	"F64":     GGMLTypeF64,
+	"F32":     GGMLTypeF32,
+	"F16":     GGMLTypeF16,
+	"BF16":    GGMLTypeBF16,
+	"I64":     GGMLTypeI64,
+	"I32":     GGMLTypeI32,
+	"I16":     GGMLTypeI16,
+	"I8":      GGMLTypeI8,
+	"U8":      GGMLTypeI8,
+	"BOOL":    GGMLTypeI8,
+	"F8_E4M3": GGMLTypeI8,
+	"F8_E5M2": GGMLTypeI8,
+}
+
+// _SafetensorsArchitectures maps the Hugging Face model type to the llama.cpp architecture,
+// the unlisted model type is used as-is.
+var _SafetensorsArchitectures = map[string]string{
+	"baichuan":    "baichuan",
+	"cohere":      "command-r",
+	"deepseek_v2": "deepseek2",
+	"deepseek_v3": "deepseek2",
+	"gemma3_text": "gemma3",
+	"gpt_neox":    "gptneox",
+	"mistral":     "llama",
+	"mixtral":     "llama",
+	"nomic_bert":  "nomic-bert",
+	"qwen2_moe":   "qwen2moe",
+	"qwen2_vl":    "qwen2vl",
+	"qwen3_moe":   "qwen3moe",
+}
+
+// _SafetensorsLayerTensorNames maps the Hugging Face layer tensor name to the GGUF one.
+var _SafetensorsLayerTensorNames = map[string]string{
+	"input_layernorm":                    "attn_norm",
+	"post_attention_layernorm":           "ffn_norm",
+	"pre_feedforward_layernorm":          "ffn_norm",
+	"post_feedforward_layernorm":         "post_ffw_norm",
+	"self_attn.q_proj":                   "attn_q",
+	"self_attn.k_proj":                   "attn_k",
+	"self_attn.v_proj":                   "attn_v",
+	"self_attn.o_proj":                   "attn_output",
+	"self_attn.q_norm":                   "attn_q_norm",
+	"self_attn.k_norm":                   "attn_k_norm",
+	"self_attn.q_a_proj":                 "attn_q_a",
+	"self_attn.q_a_layernorm":            "attn_q_a_norm",
+	"self_attn.q_b_proj":                 "attn_q_b",
+	"self_attn.kv_a_proj_with_mqa":       "attn_kv_a_mqa",
+	"self_attn.kv_a_layernorm":           "attn_kv_a_norm",
+	"self_attn.kv_b_proj":                "attn_kv_b",
+	"mlp.gate_proj":                      "ffn_gate",
+	"mlp.up_proj":                        "ffn_up",
+	"mlp.down_proj":                      "ffn_down",
+	"mlp.gate":                           "ffn_gate_inp",
+	"block_sparse_moe.gate":              "ffn_gate_inp",
+	"mlp.shared_expert.gate_proj":        "ffn_gate_shexp",
+	"mlp.shared_expert.up_proj":          "ffn_up_shexp",
+	"mlp.shared_expert.down_proj":        "ffn_down_shexp",
+	"mlp.shared_expert_gate":             "ffn_gate_inp_shexp",
+	"mlp.shared_experts.gate_proj":       "ffn_gate_shexp",
+	"mlp.shared_experts.up_proj":         "ffn_up_shexp",
+	"mlp.shared_experts.down_proj":       "ffn_down_shexp",
+	"self_attn.query_key_value":          "attn_qkv",
+	"self_attn.dense":                    "attn_output",
+	"mlp.dense_h_to_4h":                  "ffn_up",
+	"mlp.dense_4h_to_h":                  "ffn_down",
+	"block_sparse_moe.experts.gate_proj": "ffn_gate_exps",
+	"block_sparse_moe.experts.up_proj":   "ffn_up_exps",
+	"block_sparse_moe.experts.down_proj": "ffn_down_exps",
+	"mlp.experts.gate_proj":              "ffn_gate_exps",
+	"mlp.experts.up_proj":                "ffn_up_exps",
+	"mlp.experts.down_proj":              "ffn_down_exps",
+	"block_sparse_moe.experts.w1":        "ffn_gate_exps",
+	"block_sparse_moe.experts.w3":        "ffn_up_exps",
+	"block_sparse_moe.experts.w2":        "ffn_down_exps",
+}
+
+var (
+	_SafetensorsLayerTensorRegex  = regexp.MustCompile(`^model\.layers\.(\d+)\.(.+)\.(weight|bias)$`)
+	_SafetensorsExpertTensorRegex = regexp.MustCompile(`^(.+\.experts)\.(\d+)\.(.+)$`)
+)
+
+// convertSafetensorsShards converts the given shards and the Hugging Face config into a GGUFFile.
+func convertSafetensorsShards(ss []_SafetensorsShard, cfg []byte) (*GGUFFile, error) {
+	var gf GGUFFile
+
+	// Tensors.
+	type expert struct {
+		info  GGUFTensorInfo
+		count uint64
+	}
+	var (
+		experts     = map[string]*expert{}
+		expertNames []string
+	)
+	for i := range ss {
+		for _, t := range ss[i].Tensors {
+			typ, ok := _SafetensorsDTypes[t.DType]
+			if !ok {
+				return nil, fmt.Errorf("%w: tensor %s: unknown dtype %q", ErrSafetensorsInvalidHeader, t.Name, t.DType)
+			}
+			// NB(thxCode): PyTorch shapes in row-major order,
+			// while GGML dimensions are in the reverse order.
+			dims := make([]uint64, len(t.Shape))
+			for j := range t.Shape {
+				dims[j] = t.Shape[len(t.Shape)-1-j]
+			}
+			if len(dims) == 0 {
+				dims = []uint64{1}
+			}
+			ti := GGUFTensorInfo{
+				NDimensions: uint32(len(dims)),
+				Dimensions:  dims,
+				Type:        typ,
+				Offset:      t.DataOffsets[0],
+			}
+
+			n, e := convertSafetensorsTensorName(t.Name)
+			if e < 0 {
+				ti.Name = n
+				gf.TensorInfos = append(gf.TensorInfos, ti)
+				continue
+			}
+
+			// Merge the experts into one tensor.
+			ex, ok := experts[n]
+			if !ok {
+				ti.Name = n
+				ex = &expert{info: ti}
+				experts[n] = ex
+				expertNames = append(expertNames, n)
+			}
+			ex.count++
+		}
+	}
+	for _, n := range expertNames {
+		ex := experts[n]
+		ex.info.Dimensions = append(ex.info.Dimensions, ex.count)
+		ex.info.NDimensions++
+		gf.TensorInfos = append(gf.TensorInfos, ex.info)
+	}
+	gf.Header.TensorCount = uint64(len(gf.TensorInfos))
+
+	// Metadata.
+	gf.Header.MetadataKV = convertSafetensorsConfig(cfg)
+	gf.Header.MetadataKVCount = uint64(len(gf.Header.MetadataKV))
+
+	// Sizes.
+	for i := range ss {
+		gf.Size += GGUFBytesScalar(ss[i].Size)
+		modelSize := GGUFBytesScalar(ss[i].Size - 8 - ss[i].HeaderSize)
+		gf.ModelSize += modelSize
+		if len(ss) == 1 {
+			gf.TensorDataStartOffset = 8 + ss[i].HeaderSize
+			continue
+		}
+		gf.SplitSizes = append(gf.SplitSizes, GGUFBytesScalar(ss[i].Size))
+		gf.SplitModelSizes = append(gf.SplitModelSizes, modelSize)
+		gf.SplitTensorDataStartOffsets = append(gf.SplitTensorDataStartOffsets, 8+ss[i].HeaderSize)
+		gf.SplitPaddings = append(gf.SplitPaddings, 0)
+	}
+	gf.ModelParameters = GGUFParametersScalar(gf.TensorInfos.Elements())
+	if gf.ModelParameters != 0 {
+		gf.ModelBitsPerWeight = GGUFBitsPerWeightScalar(float64(gf.ModelSize) * 8 / float64(gf.ModelParameters))
+	}
+
+	return &gf, nil
+}
+
+// convertSafetensorsTensorName converts the Hugging Face tensor name into the GGUF one,
+// and returns the expert index if the tensor is an expert, otherwise, returns -1.
+//
+// The unknown tensor name is returned as-is.
+func convertSafetensorsTensorName(name string) (string, int) {
+	// Multimodal language model.
+	for _, pfx := range []string{"language_model.model.", "model.language_model.", "language_model."} {
+		if v, ok := strings.CutPrefix(name, pfx); ok {
+			name = "model." + v
+			if strings.HasPrefix(v, "lm_head.") {
+				name = v
+			}
+			break
+		}
+	}
+
+	switch name {
+	case "model.embed_tokens.weight":
+		return "token_embd.weight", -1
+	case "model.norm.weight":
+		return "output_norm.weight", -1
+	case "lm_head.weight":
+		return "output.weight", -1
+	}
+
+	r := _SafetensorsLayerTensorRegex.FindStringSubmatch(name)
+	if r == nil {
+		return name, -1
+	}
+	blk, n, sfx := r[1], r[2], r[3]
+
+	e := -1
+	if er := _SafetensorsExpertTensorRegex.FindStringSubmatch(n); er != nil {
+		e, _ = strconv.Atoi(er[2])
+		n = er[1] + "." + er[3]
+	}
+	if v, ok := _SafetensorsLayerTensorNames[n]; ok {
+		return "blk." + blk + "." + v + "." + sfx, e
+	}
+	return name, -1
+}
+
+// convertSafetensorsConfig converts the Hugging Face config into the GGUF metadata.
+func convertSafetensorsConfig(cfg []byte) (kvs GGUFMetadataKVs) {
+	var root map[string]any
+	if len(cfg) == 0 || json.Unmarshal(cfg, &root) != nil {
+		return nil
+	}
+
+	// NB(thxCode): The language model config of the multimodal model is nested,
+	// e.g. text_config.
+	get := func(keys ...string) (any, bool) {
+		for _, c := range []any{root["text_config"], root["llm_config"], root} {
+			m, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, k := range keys {
+				if v, ok := m[k]; ok && v != nil {
+					return v, true
+				}
+			}
+		}
+		return nil, false
+	}
+	// NB(thxCode): The integer is decoded as int64 by jsoniter, and as float64 by the standard library.
+	toNum := func(v any) (float64, bool) {
+		switch vv := v.(type) {
+		case float64:
+			return vv, true
+		case int64:
+			return float64(vv), true
+		}
+		return 0, false
+	}
+	num := func(keys ...string) (float64, bool) {
+		v, ok := get(keys...)
+		if !ok {
+			return 0, false
+		}
+		if vv, ok := v.([]any); ok {
+			if len(vv) == 0 {
+				return 0, false
+			}
+			v = vv[0]
+		}
+		return toNum(v)
+	}
+
+	var arch string
+	{
+		v, _ := get("model_type")
+		mt, _ := v.(string)
+		if mt == "" {
+			return nil
+		}
+		arch = mt
+		if a, ok := _SafetensorsArchitectures[mt]; ok {
+			arch = a
+		}
+	}
+	kvs = append(kvs, GGUFMetadataKV{
+		Key:       "general.architecture",
+		ValueType: GGUFMetadataValueTypeString,
+		Value:     arch,
+	})
+	if v, ok := root["_name_or_path"].(string); ok && v != "" {
+		kvs = append(kvs, GGUFMetadataKV{
+			Key:       "general.name",
+			ValueType: GGUFMetadataValueTypeString,
+			Value:     filepath.Base(v),
+		})
+	}
+
+	u32 := func(key string, cks ...string) {
+		if v, ok := num(cks...); ok && v > 0 {
+			kvs = append(kvs, GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeUint32, Value: uint32(v)})
+		}
+	}
+	f32 := func(key string, cks ...string) {
+		if v, ok := num(cks...); ok && v > 0 {
+			kvs = append(kvs, GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeFloat32, Value: float32(v)})
+		}
+	}
+
+	u32(arch+".context_length", "max_position_embeddings", "n_positions", "seq_length")
+	u32(arch+".embedding_length", "hidden_size", "n_embd", "d_model")
+	u32(arch+".block_count", "num_hidden_layers", "n_layer", "num_layers")
+	u32(arch+".feed_forward_length", "intermediate_size", "n_inner", "ffn_hidden_size")
+	u32(arch+".attention.head_count", "num_attention_heads", "n_head")
+	u32(arch+".attention.head_count_kv", "num_key_value_heads", "multi_query_group_num")
+	u32(arch+".attention.sliding_window", "sliding_window")
+	f32(arch+".attention.layer_norm_rms_epsilon", "rms_norm_eps")
+	f32(arch+".attention.layer_norm_epsilon", "layer_norm_eps", "layer_norm_epsilon")
+	u32(arch+".attention.q_lora_rank", "q_lora_rank")
+	u32(arch+".attention.kv_lora_rank", "kv_lora_rank")
+	if nope, ok := num("qk_nope_head_dim"); ok {
+		rope, _ := num("qk_rope_head_dim")
+		kvs = append(kvs, GGUFMetadataKV{
+			Key:       arch + ".attention.key_length",
+			ValueType: GGUFMetadataValueTypeUint32,
+			Value:     uint32(nope + rope),
+		})
+		u32(arch+".attention.value_length", "v_head_dim")
+		u32(arch+".rope.dimension_count", "qk_rope_head_dim")
+	} else {
+		u32(arch+".attention.key_length", "head_dim")
+		u32(arch+".attention.value_length", "head_dim")
+	}
+	f32(arch+".rope.freq_base", "rope_theta")
+	if v, ok := get("rope_scaling"); ok {
+		if m, ok := v.(map[string]any); ok {
+			if t, ok := m["rope_type"].(string); ok {
+				kvs = append(kvs, GGUFMetadataKV{Key: arch + ".rope.scaling.type", ValueType: GGUFMetadataValueTypeString, Value: t})
+			} else if t, ok = m["type"].(string); ok {
+				kvs = append(kvs, GGUFMetadataKV{Key: arch + ".rope.scaling.type", ValueType: GGUFMetadataValueTypeString, Value: t})
+			}
+			if f, ok := toNum(m["factor"]); ok {
+				kvs = append(kvs, GGUFMetadataKV{Key: arch + ".rope.scaling.factor", ValueType: GGUFMetadataValueTypeFloat32, Value: float32(f)})
+			}
+			if c, ok := toNum(m["original_max_position_embeddings"]); ok {
+				kvs = append(kvs, GGUFMetadataKV{Key: arch + ".rope.scaling.original_context_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(c)})
+			}
+		}
+	}
+	u32(arch+".expert_count", "num_local_experts", "num_experts", "n_routed_experts")
+	u32(arch+".expert_used_count", "num_experts_per_tok")
+	u32(arch+".expert_shared_count", "n_shared_experts")
+	u32(arch+".expert_feed_forward_length", "moe_intermediate_size")
+	u32(arch+".expert_shared_feed_forward_length", "shared_expert_intermediate_size")
+	u32(arch+".vocab_size", "vocab_size", "padded_vocab_size")
+	// The token ID can be 0.
+	id := func(key string, cks ...string) {
+		if v, ok := num(cks...); ok && v >= 0 {
+			kvs = append(kvs, GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeUint32, Value: uint32(v)})
+		}
+	}
+	id("tokenizer.ggml.bos_token_id", "bos_token_id")
+	id("tokenizer.ggml.eos_token_id", "eos_token_id")
+
+	return kvs
+}
@@ -0,0 +1,185 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSafetensorsConfig = `{
+  "_name_or_path": "org/tiny-moe",
+  "model_type": "qwen3_moe",
+  "hidden_size": 64,
+  "intermediate_size": 128,
+  "moe_intermediate_size": 32,
+  "num_hidden_layers": 2,
+  "num_attention_heads": 4,
+  "num_key_value_heads": 2,
+  "head_dim": 16,
+  "num_experts": 4,
+  "num_experts_per_tok": 2,
+  "max_position_embeddings": 4096,
+  "rms_norm_eps": 1e-06,
+  "rope_theta": 1000000.0,
+  "vocab_size": 256,
+  "bos_token_id": 0,
+  "eos_token_id": [2, 3]
+}`
+
+// testSafetensorsFileBytes returns the bytes of safetensors files in BF16 for testSafetensorsConfig,
+// split into the given number of shards.
+func testSafetensorsFileBytes(shards int) [][]byte {
+	type tensor struct {
+		name  string
+		shape []uint64
+	}
+	var ts []tensor
+	ts = append(ts, tensor{"model.embed_tokens.weight", []uint64{256, 64}})
+	for l := 0; l < 2; l++ {
+		p := fmt.Sprintf("model.layers.%d.", l)
+		ts = append(ts,
+			tensor{p + "input_layernorm.weight", []uint64{64}},
+			tensor{p + "self_attn.q_proj.weight", []uint64{64, 64}},
+			tensor{p + "self_attn.k_proj.weight", []uint64{32, 64}},
+			tensor{p + "self_attn.v_proj.weight", []uint64{32, 64}},
+			tensor{p + "self_attn.o_proj.weight", []uint64{64, 64}},
+			tensor{p + "self_attn.q_norm.weight", []uint64{16}},
+			tensor{p + "self_attn.k_norm.weight", []uint64{16}},
+			tensor{p + "post_attention_layernorm.weight", []uint64{64}},
+			tensor{p + "mlp.gate.weight", []uint64{4, 64}})
+		for e := 0; e < 4; e++ {
+			ep := fmt.Sprintf("%smlp.experts.%d.", p, e)
+			ts = append(ts,
+				tensor{ep + "gate_proj.weight", []uint64{32, 64}},
+				tensor{ep + "up_proj.weight", []uint64{32, 64}},
+				tensor{ep + "down_proj.weight", []uint64{64, 32}})
+		}
+	}
+	ts = append(ts,
+		tensor{"model.norm.weight", []uint64{64}},
+		tensor{"lm_head.weight", []uint64{256, 64}})
+
+	per := (len(ts) + shards - 1) / shards
+	ret := make([][]byte, 0, shards)
+	for s := 0; s < shards; s++ {
+		h := map[string]any{"__metadata__": map[string]string{"format": "pt"}}
+		var off uint64
+		for _, t := range ts[s*per : min((s+1)*per, len(ts))] {
+			n := uint64(2)
+			for _, d := range t.shape {
+				n *= d
+			}
+			h[t.name] = map[string]any{"dtype": "BF16", "shape": t.shape, "data_offsets": []uint64{off, off + n}}
+			off += n
+		}
+		hb, _ := json.Marshal(h)
+
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(hb)))
+		buf.Write(hb)
+		buf.Write(make([]byte, off))
+		ret = append(ret, buf.Bytes())
+	}
+	return ret
+}
+
+func testSafetensorsFileAssert(t *testing.T, f *GGUFFile) {
+	t.Helper()
+
+	a := f.Architecture()
+	if a.Architecture != "qwen3moe" {
+		t.Errorf("expected architecture qwen3moe, got %q", a.Architecture)
+	}
+	if a.BlockCount != 2 || a.EmbeddingLength != 64 || a.AttentionHeadCountKV != 2 || a.ExpertCount != 4 {
+		t.Errorf("unexpected architecture: %+v", a)
+	}
+
+	if tk := f.Tokenizer(); tk.BOSTokenID != 0 || tk.EOSTokenID != 2 {
+		t.Errorf("expected bos/eos token id 0/2, got %d/%d", tk.BOSTokenID, tk.EOSTokenID)
+	}
+
+	ti, ok := f.TensorInfos.Get("blk.1.ffn_gate_exps.weight")
+	if !ok {
+		t.Fatal("expected merged expert tensor blk.1.ffn_gate_exps.weight")
+	}
+	if ti.Type != GGMLTypeBF16 || fmt.Sprint(ti.Dimensions) != "[64 32 4]" {
+		t.Errorf("unexpected expert tensor: %s %v", ti.Type, ti.Dimensions)
+	}
+	for _, n := range []string{"token_embd.weight", "output_norm.weight", "output.weight", "blk.0.attn_k.weight", "blk.0.ffn_gate_inp.weight"} {
+		if _, ok := f.TensorInfos.Get(n); !ok {
+			t.Errorf("expected tensor %s", n)
+		}
+	}
+	if f.ModelBitsPerWeight != 16 {
+		t.Errorf("expected 16 bits per weight, got %v", f.ModelBitsPerWeight)
+	}
+
+	e := f.EstimateLLaMACppRun(WithLLaMACppContextSize(1024)).SummarizeItem(false, 0, 0)
+	if e.VRAMs[0].NonUMA == 0 {
+		t.Error("expected non-zero estimate")
+	}
+}
+
+func TestParseSafetensorsFile(t *testing.T) {
+	dir := t.TempDir()
+	shards := testSafetensorsFileBytes(3)
+	for i := range shards {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("model-%05d-of-00003.safetensors", i+1)), shards[i], 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(testSafetensorsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []GGUFReadOption
+	}{
+		{"default", nil},
+		{"mmap", []GGUFReadOption{UseMMap()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseSafetensorsFile(filepath.Join(dir, "model-00002-of-00003.safetensors"), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.SplitSizes) != 3 {
+				t.Errorf("expected 3 shards, got %d", len(f.SplitSizes))
+			}
+			testSafetensorsFileAssert(t, f)
+		})
+	}
+}
+
+func TestParseSafetensorsFileRemote(t *testing.T) {
+	shards := testSafetensorsFileBytes(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/resolve/main/model.safetensors"):
+			// Serve in range.
+			http.ServeContent(rw, r, "model.safetensors", time.Time{}, bytes.NewReader(shards[0]))
+		case strings.HasSuffix(r.URL.Path, "/resolve/main/config.json"):
+			_, _ = rw.Write([]byte(testSafetensorsConfig))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("HF_ENDPOINT", srv.URL)
+
+	f, err := ParseSafetensorsFileFromHuggingFace(context.Background(), "org/tiny-moe", "model.safetensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSafetensorsFileAssert(t, f)
+}
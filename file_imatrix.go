@@ -0,0 +1,303 @@
+package gguf_parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Types for the importance matrix of a GGUF file.
+type (
+	// GGUFIMatrix represents the importance matrix of a GGUF file,
+	// see https://github.com/ggml-org/llama.cpp/tree/master/tools/imatrix.
+	GGUFIMatrix struct {
+		// ChunkCount is the number of chunks processed to collect the importance matrix.
+		ChunkCount uint32 `json:"chunkCount"`
+		// ChunkSize is the size of each chunk in tokens.
+		ChunkSize uint32 `json:"chunkSize,omitempty"`
+		// Datasets holds the names of the datasets used to collect the importance matrix.
+		Datasets []string `json:"datasets,omitempty"`
+		// Entries holds the importance data of each weight tensor,
+		// sorted by the tensor name.
+		Entries []GGUFIMatrixEntry `json:"entries"`
+	}
+
+	// GGUFIMatrixEntry represents the importance data of a weight tensor.
+	GGUFIMatrixEntry struct {
+		// Name is the name of the weight tensor, e.g. "blk.0.attn_q.weight".
+		Name string `json:"name"`
+		// Length is the number of the input activations of each matrix,
+		// which should be equal to the first dimension of the weight tensor.
+		Length uint64 `json:"length"`
+		// MatrixCount is the number of the matrices,
+		// which is the number of experts for MoE weight tensors, otherwise 1.
+		MatrixCount uint64 `json:"matrixCount"`
+
+		sum2, counts GGUFTensorInfo
+	}
+
+	// GGUFIMatrixStatistics represents the activation statistics of a weight tensor,
+	// which is calculated from the mean of the squared activations.
+	GGUFIMatrixStatistics struct {
+		// Name is the name of the weight tensor.
+		Name string `json:"name"`
+		// Elements is the number of the statistic values.
+		Elements uint64 `json:"elements"`
+		// ZeroCountMatrices is the number of the matrices without any activation,
+		// e.g. the experts never routed, which are missing importance data.
+		ZeroCountMatrices uint64 `json:"zeroCountMatrices,omitempty"`
+		// Sum is the sum of the values.
+		Sum float64 `json:"sum"`
+		// Minimum is the minimum of the values.
+		Minimum float64 `json:"minimum"`
+		// Maximum is the maximum of the values.
+		Maximum float64 `json:"maximum"`
+		// Mean is the mean of the values.
+		Mean float64 `json:"mean"`
+		// StandardDeviation is the standard deviation of the values.
+		StandardDeviation float64 `json:"standardDeviation"`
+		// ActiveRatio is the ratio of the values greater than 1e-5.
+		ActiveRatio float64 `json:"activeRatio"`
+		// Entropy is the normalized entropy of the values,
+		// lower means the importance concentrates on fewer activations.
+		Entropy float64 `json:"entropy"`
+	}
+
+	// GGUFIMatrixCoverage represents the coverage of an importance matrix against a model.
+	GGUFIMatrixCoverage struct {
+		// Total is the number of the model tensors which expect importance data.
+		Total int `json:"total"`
+		// Covered is the number of the model tensors which have importance data.
+		Covered int `json:"covered"`
+		// Missing holds the names of the model tensors without importance data.
+		Missing []string `json:"missing,omitempty"`
+		// Mismatched holds the names of the model tensors whose shape mismatches the importance data.
+		Mismatched []string `json:"mismatched,omitempty"`
+		// Unused holds the names of the importance data which are not found in the model.
+		Unused []string `json:"unused,omitempty"`
+	}
+)
+
+// IMatrix returns the importance matrix of the GGUF file,
+// the statistics are not included, see IMatrixStatistics.
+func (gf *GGUFFile) IMatrix() (gi GGUFIMatrix) {
+	const (
+		chunkCountKey = "imatrix.chunk_count"
+		chunkSizeKey  = "imatrix.chunk_size"
+		datasetsKey   = "imatrix.datasets"
+	)
+
+	m, _ := gf.Header.MetadataKV.Index([]string{
+		chunkCountKey,
+		chunkSizeKey,
+		datasetsKey,
+	})
+
+	if v, ok := m[chunkCountKey]; ok {
+		gi.ChunkCount = ValueNumeric[uint32](v)
+	}
+	if v, ok := m[chunkSizeKey]; ok {
+		gi.ChunkSize = ValueNumeric[uint32](v)
+	}
+	if v, ok := m[datasetsKey]; ok {
+		if av := v.ValueArray(); av.Type == GGUFMetadataValueTypeString && len(av.Array) != 0 {
+			gi.Datasets = av.ValuesString()
+		}
+	}
+
+	// Each weight tensor is stored as a pair of tensors,
+	// "<name>.in_sum2" in F32 [n_embd, n_mat] and "<name>.counts" in F32 [1, n_mat].
+	es := make(map[string]*GGUFIMatrixEntry)
+	for _, ti := range gf.TensorInfos {
+		var (
+			n   string
+			sum bool
+		)
+		switch {
+		case strings.HasSuffix(ti.Name, ".in_sum2"):
+			n, sum = strings.TrimSuffix(ti.Name, ".in_sum2"), true
+		case strings.HasSuffix(ti.Name, ".counts"):
+			n = strings.TrimSuffix(ti.Name, ".counts")
+		default:
+			continue
+		}
+		e, ok := es[n]
+		if !ok {
+			e = &GGUFIMatrixEntry{Name: n}
+			es[n] = e
+		}
+		if sum {
+			e.sum2 = ti
+			e.Length = ti.Dimensions[0]
+			e.MatrixCount = 1
+			if ti.NDimensions > 1 {
+				e.MatrixCount = ti.Dimensions[1]
+			}
+		} else {
+			e.counts = ti
+		}
+	}
+	gi.Entries = make([]GGUFIMatrixEntry, 0, len(es))
+	for _, e := range es {
+		if e.sum2.Name == "" || e.counts.Name == "" {
+			continue
+		}
+		gi.Entries = append(gi.Entries, *e)
+	}
+	sort.Slice(gi.Entries, func(i, j int) bool {
+		return gi.Entries[i].Name < gi.Entries[j].Name
+	})
+
+	return gi
+}
+
+// IMatrixStatistics returns the activation statistics of each entry of the importance matrix,
+// which reads the tensor data from the given io.ReaderAt of the GGUF file,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/imatrix/imatrix.cpp, compute_tensor_statistics.
+//
+// The io.ReaderAt is not closed after reading.
+func (gf *GGUFFile) IMatrixStatistics(r io.ReaderAt) ([]GGUFIMatrixStatistics, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+	if len(gf.SplitTensorDataStartOffsets) > 1 {
+		return nil, errors.New("split importance matrix is not supported")
+	}
+
+	var bo binary.ByteOrder = binary.LittleEndian
+	if gf.Header.Magic == GGUFMagicGGUFBe {
+		bo = binary.BigEndian
+	}
+	read := func(ti GGUFTensorInfo) ([]float32, error) {
+		if ti.Type != GGMLTypeF32 {
+			return nil, fmt.Errorf("unsupported type %s of tensor %s", ti.Type, ti.Name)
+		}
+		vs := make([]float32, ti.Elements())
+		sr := io.NewSectionReader(r, gf.TensorDataStartOffset+int64(ti.Offset), int64(ti.Bytes()))
+		if err := binary.Read(sr, bo, vs); err != nil {
+			return nil, fmt.Errorf("read tensor %s: %w", ti.Name, err)
+		}
+		return vs, nil
+	}
+
+	es := gf.IMatrix().Entries
+	ss := make([]GGUFIMatrixStatistics, 0, len(es))
+	for _, e := range es {
+		sum2, err := read(e.sum2)
+		if err != nil {
+			return nil, err
+		}
+		counts, err := read(e.counts)
+		if err != nil {
+			return nil, err
+		}
+
+		if uint64(len(sum2)) < e.MatrixCount*e.Length {
+			return nil, fmt.Errorf("tensor %s has %d values, less than %d", e.sum2.Name, len(sum2), e.MatrixCount*e.Length)
+		}
+
+		s := GGUFIMatrixStatistics{
+			Name:    e.Name,
+			Minimum: math.Inf(1),
+			Maximum: math.Inf(-1),
+		}
+		vs := make([]float64, 0, len(sum2))
+		for i := uint64(0); i < e.MatrixCount && i < uint64(len(counts)); i++ {
+			if counts[i] == 0 {
+				s.ZeroCountMatrices++
+				continue
+			}
+			for _, v := range sum2[i*e.Length : (i+1)*e.Length] {
+				vs = append(vs, float64(v)/float64(counts[i]))
+			}
+		}
+		if len(vs) == 0 {
+			s.Minimum, s.Maximum = 0, 0
+			ss = append(ss, s)
+			continue
+		}
+
+		var active uint64
+		for _, v := range vs {
+			s.Sum += v
+			s.Minimum = min(s.Minimum, v)
+			s.Maximum = max(s.Maximum, v)
+			if v > 1e-5 {
+				active++
+			}
+		}
+		s.Elements = uint64(len(vs))
+		s.Mean = s.Sum / float64(len(vs))
+		s.ActiveRatio = float64(active) / float64(len(vs))
+		for _, v := range vs {
+			s.StandardDeviation += (v - s.Mean) * (v - s.Mean)
+			if s.Sum > 0 && v > 0 {
+				p := v / s.Sum
+				s.Entropy -= p * math.Log2(p)
+			}
+		}
+		s.StandardDeviation = math.Sqrt(s.StandardDeviation / float64(len(vs)))
+		if len(vs) > 1 {
+			s.Entropy /= math.Log2(float64(len(vs)))
+		}
+		ss = append(ss, s)
+	}
+
+	return ss, nil
+}
+
+// Coverage returns the coverage of the importance matrix against the given model,
+// which checks the tensors that llama-quantize looks up the importance data for.
+//
+// The "token_embd.weight" and "output.weight" are excluded,
+// since the importance matrix does not collect them by default.
+func (gi GGUFIMatrix) Coverage(model *GGUFFile) (gc GGUFIMatrixCoverage) {
+	es := make(map[string]GGUFIMatrixEntry, len(gi.Entries))
+	for _, e := range gi.Entries {
+		es[e.Name] = e
+	}
+
+	used := make(map[string]struct{}, len(gi.Entries))
+	for _, ti := range model.TensorInfos {
+		n := ti.Name
+		if !strings.HasSuffix(n, "weight") || ti.NDimensions < 2 || _GGUFQuantizeSkipTensorRegex.MatchString(n) {
+			continue
+		}
+		if n == "token_embd.weight" || n == "output.weight" {
+			if _, ok := es[n]; ok {
+				used[n] = struct{}{}
+			}
+			continue
+		}
+		gc.Total++
+
+		e, ok := es[n]
+		if !ok {
+			gc.Missing = append(gc.Missing, n)
+			continue
+		}
+		used[n] = struct{}{}
+
+		nMat := uint64(1)
+		if ti.NDimensions > 2 {
+			nMat = ti.Dimensions[2]
+		}
+		if e.Length != ti.Dimensions[0] || e.MatrixCount != nMat {
+			gc.Mismatched = append(gc.Mismatched, n)
+			continue
+		}
+		gc.Covered++
+	}
+
+	for _, e := range gi.Entries {
+		if _, ok := used[e.Name]; !ok {
+			gc.Unused = append(gc.Unused, e.Name)
+		}
+	}
+
+	return gc
+}
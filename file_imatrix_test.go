@@ -0,0 +1,72 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestGGUFFile_IMatrix(t *testing.T) {
+	kvs := GGUFMetadataKVs{
+		{Key: "general.type", ValueType: GGUFMetadataValueTypeString, Value: "imatrix"},
+		{Key: "imatrix.chunk_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(100)},
+		{Key: "imatrix.chunk_size", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(512)},
+	}
+	tis := GGUFTensorInfos{
+		{Name: "blk.0.attn_q.weight.in_sum2", NDimensions: 2, Dimensions: []uint64{512, 1}, Type: GGMLTypeF32},
+		{Name: "blk.0.attn_q.weight.counts", NDimensions: 2, Dimensions: []uint64{1, 1}, Type: GGMLTypeF32},
+		{Name: "blk.0.ffn_up.weight.in_sum2", NDimensions: 2, Dimensions: []uint64{256, 1}, Type: GGMLTypeF32},
+		{Name: "blk.0.ffn_up.weight.counts", NDimensions: 2, Dimensions: []uint64{1, 1}, Type: GGMLTypeF32},
+		{Name: "blk.9.attn_q.weight.in_sum2", NDimensions: 2, Dimensions: []uint64{512, 2}, Type: GGMLTypeF32},
+		{Name: "blk.9.attn_q.weight.counts", NDimensions: 2, Dimensions: []uint64{1, 2}, Type: GGMLTypeF32},
+	}
+
+	// Fill the squared activations with 4 and the counts with 2,
+	// except the 2nd matrix of blk.9.attn_q.weight, which is never activated.
+	bs := testGGUFFileBytes(kvs, tis)
+	gf, err := ParseGGUFFileFromReaderAt(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ti := range gf.TensorInfos {
+		off := gf.TensorDataStartOffset + int64(ti.Offset)
+		for j := uint64(0); j < ti.Elements(); j++ {
+			v := float32(4)
+			switch {
+			case i%2 == 1 && j == 0:
+				v = 2
+			case i%2 == 1:
+				v = 0
+			}
+			binary.LittleEndian.PutUint32(bs[off+int64(j)*4:], math.Float32bits(v))
+		}
+	}
+
+	gi := gf.IMatrix()
+	if gi.ChunkCount != 100 || gi.ChunkSize != 512 || len(gi.Entries) != 3 {
+		t.Fatalf("unexpected imatrix: %+v", gi)
+	}
+	if e := gi.Entries[2]; e.Name != "blk.9.attn_q.weight" || e.Length != 512 || e.MatrixCount != 2 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if a := gf.Architecture(); a.Architecture != "imatrix" || a.IMatrixChunkCount != 100 || a.IMatrixEntryCount != 3 {
+		t.Errorf("unexpected architecture: %+v", a)
+	}
+
+	ss, err := gf.IMatrixStatistics(bytes.NewReader(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ss[0]; s.Elements != 512 || s.Mean != 2 || s.StandardDeviation != 0 || s.ActiveRatio != 1 || math.Abs(s.Entropy-1) > 1e-9 {
+		t.Errorf("unexpected statistics: %+v", s)
+	}
+	if s := ss[2]; s.Elements != 512 || s.ZeroCountMatrices != 1 {
+		t.Errorf("unexpected statistics: %+v", s)
+	}
+
+	gc := gi.Coverage(testQuantizeGGUFFile(1))
+	if gc.Total != 7 || gc.Covered != 1 || len(gc.Missing) != 5 || len(gc.Mismatched) != 1 || len(gc.Unused) != 1 {
+		t.Errorf("unexpected coverage: %+v", gc)
+	}
+}
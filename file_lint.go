@@ -0,0 +1,394 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+)
+
+// Types for linting.
+type (
+	// GGUFLintSeverity is the severity of a GGUFLintFinding.
+	GGUFLintSeverity uint32
+
+	// GGUFLintFinding represents a finding of linting the GGUF file.
+	GGUFLintFinding struct {
+		// Rule is the name of the rule,
+		// e.g. "missing-alignment".
+		Rule string `json:"rule"`
+		// Severity is the severity of the finding.
+		Severity GGUFLintSeverity `json:"severity"`
+		// Message is the description of the finding.
+		Message string `json:"message"`
+	}
+
+	_GGUFLintOptions struct {
+		Filename string
+	}
+
+	// GGUFLintOption is the option for linting.
+	GGUFLintOption func(o *_GGUFLintOptions)
+)
+
+// GGUFLintSeverity constants.
+const (
+	GGUFLintSeverityInfo    GGUFLintSeverity = iota // Info
+	GGUFLintSeverityWarning                         // Warning
+	GGUFLintSeverityError                           // Error
+	_GGUFLintSeverityCount                          // Unknown
+)
+
+// MarshalJSON marshals the severity as its name, e.g. "Warning".
+func (s GGUFLintSeverity) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.String())), nil
+}
+
+// UnmarshalJSON unmarshals the severity from its name, case-insensitively.
+func (s *GGUFLintSeverity) UnmarshalJSON(b []byte) error {
+	var n string
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	for i := GGUFLintSeverityInfo; i < _GGUFLintSeverityCount; i++ {
+		if strings.EqualFold(i.String(), n) {
+			*s = i
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid lint severity %q", n)
+}
+
+// WithLintFilename lints the filename of the GGUF file as well,
+// the given name is the base name of the file, e.g. "Qwen2-7B-Instruct-Q4_K_M.gguf".
+func WithLintFilename(name string) GGUFLintOption {
+	return func(o *_GGUFLintOptions) {
+		o.Filename = name
+	}
+}
+
+// Lint runs the rule set over the GGUF file,
+// and returns the findings in order of the rules.
+//
+// The rules are:
+//   - missing-alignment: the general.alignment is missing.
+//   - missing-quantization-version: the general.quantization_version is missing for a quantized file.
+//   - token-id-out-of-range: the special token IDs are out of the tokens range.
+//   - vocabulary-mismatch: the vocabulary length does not match the token_embd shape.
+//   - chat-template: the tokenizer.chat_template fails to parse.
+//   - license: the general.license is not an SPDX license expression.
+//   - filename-file-type: the encoding of the filename disagrees with the actual file type.
+//   - unknown-architecture-key: the architecture key is unknown.
+func (gf *GGUFFile) Lint(opts ...GGUFLintOption) (fs []GGUFLintFinding) {
+	var o _GGUFLintOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	add := func(rule string, sev GGUFLintSeverity, format string, args ...any) {
+		fs = append(fs, GGUFLintFinding{Rule: rule, Severity: sev, Message: fmt.Sprintf(format, args...)})
+	}
+
+	m := gf.Metadata()
+
+	// Metadata.
+	if _, ok := gf.Header.MetadataKV.Get("general.alignment"); !ok {
+		add("missing-alignment", GGUFLintSeverityWarning,
+			"general.alignment is missing, readers assume 32")
+	}
+	if _, ok := gf.Header.MetadataKV.Get("general.quantization_version"); !ok {
+		for i := range gf.TensorInfos {
+			if gf.TensorInfos[i].Type.IsQuantized() {
+				add("missing-quantization-version", GGUFLintSeverityWarning,
+					"general.quantization_version is missing, but tensor %s is quantized to %s",
+					gf.TensorInfos[i].Name, gf.TensorInfos[i].Type)
+				break
+			}
+		}
+	}
+
+	// Tokenizer.
+	if m.Type == "model" && m.Architecture != "diffusion" {
+		t := gf.Tokenizer()
+		if t.TokensLength != 0 {
+			for _, id := range []struct {
+				Name string
+				ID   int64
+			}{
+				{"bos", t.BOSTokenID},
+				{"eos", t.EOSTokenID},
+				{"eot", t.EOTTokenID},
+				{"eom", t.EOMTokenID},
+				{"unknown", t.UnknownTokenID},
+				{"separator", t.SeparatorTokenID},
+				{"padding", t.PaddingTokenID},
+			} {
+				if id.ID >= 0 && uint64(id.ID) >= t.TokensLength {
+					add("token-id-out-of-range", GGUFLintSeverityError,
+						"tokenizer.ggml.%s_token_id %d is out of the tokens range [0, %d)", id.Name, id.ID, t.TokensLength)
+				}
+			}
+		}
+
+		a := gf.Architecture()
+		if ti, ok := gf.TensorInfos.Get("token_embd.weight"); ok && ti.NDimensions >= 2 && a.VocabularyLength != 0 &&
+			ti.Dimensions[1] != a.VocabularyLength {
+			add("vocabulary-mismatch", GGUFLintSeverityError,
+				"vocabulary length %d does not match the token_embd shape %v", a.VocabularyLength, ti.Dimensions)
+		}
+
+		if v, ok := gf.Header.MetadataKV.Get("tokenizer.chat_template"); ok && v.ValueType == GGUFMetadataValueTypeString {
+			if err := lintJinjaTemplate(v.ValueString()); err != nil {
+				add("chat-template", GGUFLintSeverityError,
+					"tokenizer.chat_template fails to parse: %v", err)
+			}
+		}
+	}
+
+	// License.
+	if m.License != "" && !isSPDXLicenseExpression(m.License) {
+		add("license", GGUFLintSeverityWarning,
+			"general.license %q is not an SPDX license expression", m.License)
+	}
+
+	// Filename.
+	if o.Filename != "" {
+		if gn := ParseGGUFFilename(o.Filename); gn != nil && gn.Encoding != "" && m.FileType != _GGUFFileTypeCount {
+			ft := strings.TrimPrefix(m.FileType.String(), "MOSTLY_")
+			if !strings.EqualFold(gn.Encoding, ft) {
+				add("filename-file-type", GGUFLintSeverityWarning,
+					"filename %q is encoded as %s, but the file type is %s", o.Filename, gn.Encoding, ft)
+			}
+		}
+	}
+
+	// Architecture keys.
+	if arch, ok := gf.Header.MetadataKV.Get("general.architecture"); ok && arch.ValueType == GGUFMetadataValueTypeString {
+		pfx := arch.ValueString() + "."
+		for _, kv := range gf.Header.MetadataKV {
+			k, ok := strings.CutPrefix(kv.Key, pfx)
+			if !ok || _GGUFLintKnownArchitectureKeyRegex.MatchString(k) {
+				continue
+			}
+			add("unknown-architecture-key", GGUFLintSeverityInfo,
+				"architecture key %s is unknown", kv.Key)
+		}
+	}
+
+	return fs
+}
+
+// _GGUFLintKnownArchitectureKeyRegex matches the known architecture keys without the architecture prefix,
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-arch.cpp.
+var _GGUFLintKnownArchitectureKeyRegex = regexp.MustCompile(`^(` +
+	`vocab_size|context_length|embedding_length|embedding_length_out|embedding_length_per_layer_input|features_length|` +
+	`block_count|leading_dense_block_count|decoder_block_count|decoder_start_token_id|` +
+	`feed_forward_length|expert_feed_forward_length|expert_shared_feed_forward_length|expert_chunk_feed_forward_length|` +
+	`use_parallel_residual|tensor_data_layout|` +
+	`expert_count|expert_used_count|expert_shared_count|expert_group_count|expert_group_used_count|` +
+	`expert_weights_scale|expert_weights_norm|expert_gating_func|expert_group_scale|experts_per_group|` +
+	`moe_every_n_layers|nextn_predict_layers|interleave_moe_layer_step|pooling_type|` +
+	`logit_scale|attn_logit_softcapping|router_logit_softcapping|final_logit_softcapping|` +
+	`swin_norm|rescale_every_n_layers|time_mix_extra_dim|time_decay_extra_dim|` +
+	`residual_scale|embedding_scale|token_shift_count|` +
+	`attention\.(head_count|head_count_kv|max_alibi_bias|alibi_bias_max|clamp_kqv|clip_kqv|key_length|value_length|` +
+	`key_length_mla|value_length_mla|layer_norm_epsilon|layer_norm_rms_epsilon|group_norm_epsilon|group_norm_groups|` +
+	`causal|q_lora_rank|kv_lora_rank|decay_lora_rank|iclr_lora_rank|value_residual_mix_lora_rank|gate_lora_rank|` +
+	`relative_buckets_count|sliding_window|sliding_window_pattern|scale|output_scale|temperature_length|` +
+	`shared_kv_layers|indexer\.(head_count|key_length|top_k))|` +
+	`rope\.(dimension_count|dimension_sections|freq_base|freq_scale|scale_linear|` +
+	`scaling\.(type|factor|attn_factor|original_context_length|finetuned|` +
+	`yarn_log_multiplier|yarn_ext_factor|yarn_attn_factor|yarn_beta_fast|yarn_beta_slow))|` +
+	`ssm\.(conv_kernel|inner_size|state_size|time_step_rank|group_count|dt_b_c_rms)|` +
+	`wkv\.head_size|` +
+	`posnet\.(embedding_length|block_count)|convnext\.(embedding_length|block_count)|` +
+	`classifier\.output_labels|shortconv\.l_cache|altup\.(active_idx|num_inputs)|` +
+	`xielu\.(alpha_n|alpha_p|beta|eps)` +
+	`)$`)
+
+// _SPDXLicenseIdentifiers holds the common SPDX license identifiers in lower case,
+// see https://spdx.org/licenses/.
+var _SPDXLicenseIdentifiers = map[string]struct{}{
+	"0bsd": {}, "afl-3.0": {}, "agpl-3.0": {}, "agpl-3.0-only": {}, "agpl-3.0-or-later": {},
+	"apache-1.1": {}, "apache-2.0": {}, "artistic-2.0": {}, "bsd-2-clause": {}, "bsd-3-clause": {},
+	"bsd-3-clause-clear": {}, "bsl-1.0": {}, "cc-by-2.0": {}, "cc-by-3.0": {}, "cc-by-4.0": {},
+	"cc-by-nc-2.0": {}, "cc-by-nc-3.0": {}, "cc-by-nc-4.0": {}, "cc-by-nc-nd-3.0": {}, "cc-by-nc-nd-4.0": {},
+	"cc-by-nc-sa-2.0": {}, "cc-by-nc-sa-3.0": {}, "cc-by-nc-sa-4.0": {}, "cc-by-nd-4.0": {},
+	"cc-by-sa-3.0": {}, "cc-by-sa-4.0": {}, "cc0-1.0": {}, "cdla-permissive-1.0": {}, "cdla-permissive-2.0": {},
+	"cdla-sharing-1.0": {}, "ecl-2.0": {}, "epl-1.0": {}, "epl-2.0": {}, "eupl-1.1": {}, "eupl-1.2": {},
+	"gfdl-1.3": {}, "gpl-2.0": {}, "gpl-2.0-only": {}, "gpl-2.0-or-later": {}, "gpl-3.0": {},
+	"gpl-3.0-only": {}, "gpl-3.0-or-later": {}, "isc": {}, "lgpl-2.1": {}, "lgpl-2.1-only": {},
+	"lgpl-2.1-or-later": {}, "lgpl-3.0": {}, "lgpl-3.0-only": {}, "lgpl-3.0-or-later": {}, "lppl-1.3c": {},
+	"mit": {}, "mit-0": {}, "mpl-2.0": {}, "ms-pl": {}, "ncsa": {}, "odbl-1.0": {}, "ofl-1.1": {},
+	"osl-3.0": {}, "postgresql": {}, "python-2.0": {}, "unlicense": {}, "upl-1.0": {}, "wtfpl": {},
+	"zlib": {},
+}
+
+// isSPDXLicenseExpression returns true if the given license is an SPDX license expression,
+// e.g. "MIT", "Apache-2.0 OR MIT" or "LicenseRef-Custom".
+func isSPDXLicenseExpression(s string) bool {
+	s = strings.NewReplacer("(", " ", ")", " ").Replace(s)
+	fs := strings.Fields(s)
+	if len(fs) == 0 {
+		return false
+	}
+	for i, f := range fs {
+		if i%2 == 1 {
+			switch f {
+			case "AND", "OR", "WITH":
+				continue
+			}
+			return false
+		}
+		if i > 0 && fs[i-1] == "WITH" {
+			// Exception identifiers are not validated.
+			continue
+		}
+		f = strings.TrimSuffix(f, "+")
+		if strings.HasPrefix(f, "LicenseRef-") || strings.HasPrefix(f, "DocumentRef-") {
+			continue
+		}
+		if _, ok := _SPDXLicenseIdentifiers[strings.ToLower(f)]; !ok {
+			return false
+		}
+	}
+	return len(fs)%2 == 1
+}
+
+// _JinjaEndRawRegex matches the end of a Jinja raw block.
+var _JinjaEndRawRegex = regexp.MustCompile(`\{%-?\s*endraw\s*-?%}`)
+
+// lintJinjaTemplate checks the syntax of the given Jinja template,
+// including the delimiters, the block tags and the brackets and quotes of the expressions.
+func lintJinjaTemplate(s string) error {
+	var (
+		blocks []string
+		pos    int
+	)
+	for {
+		i := strings.Index(s[pos:], "{")
+		if i < 0 {
+			break
+		}
+		pos += i
+		if pos+1 >= len(s) {
+			break
+		}
+
+		var end string
+		switch s[pos+1] {
+		case '{':
+			end = "}}"
+		case '%':
+			end = "%}"
+		case '#':
+			end = "#}"
+		default:
+			pos++
+			continue
+		}
+
+		j := strings.Index(s[pos+2:], end)
+		if j < 0 {
+			return fmt.Errorf("unclosed %q at offset %d", s[pos:pos+2], pos)
+		}
+		body := strings.Trim(s[pos+2:pos+2+j], "-+ \t\r\n")
+		open := pos
+		pos += 2 + j + 2
+
+		switch end {
+		case "#}":
+			continue
+		case "}}":
+			if body == "" {
+				return fmt.Errorf("empty expression at offset %d", open)
+			}
+			if err := lintJinjaExpression(body); err != nil {
+				return fmt.Errorf("expression at offset %d: %w", open, err)
+			}
+			continue
+		}
+
+		// Statement.
+		fs := strings.Fields(body)
+		if len(fs) == 0 {
+			return fmt.Errorf("empty statement at offset %d", open)
+		}
+		if err := lintJinjaExpression(body); err != nil {
+			return fmt.Errorf("statement at offset %d: %w", open, err)
+		}
+		tag := fs[0]
+		switch tag {
+		case "if", "for", "macro", "call", "filter", "block", "with", "generation":
+			blocks = append(blocks, tag)
+		case "set":
+			// Block set, e.g. {% set x %}...{% endset %}.
+			if !strings.Contains(body, "=") {
+				blocks = append(blocks, tag)
+			}
+		case "raw":
+			k := _JinjaEndRawRegex.FindStringIndex(s[pos:])
+			if k == nil {
+				return fmt.Errorf("unclosed raw block at offset %d", open)
+			}
+			pos += k[1]
+		case "elif", "else":
+			if len(blocks) == 0 || (blocks[len(blocks)-1] != "if" && blocks[len(blocks)-1] != "for") {
+				return fmt.Errorf("unexpected %q at offset %d", tag, open)
+			}
+		default:
+			if b, ok := strings.CutPrefix(tag, "end"); ok {
+				if len(blocks) == 0 || blocks[len(blocks)-1] != b {
+					return fmt.Errorf("unexpected %q at offset %d", tag, open)
+				}
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+	}
+	if len(blocks) != 0 {
+		return fmt.Errorf("unclosed %q block", blocks[len(blocks)-1])
+	}
+	return nil
+}
+
+// lintJinjaExpression checks the brackets and quotes of the given Jinja expression.
+func lintJinjaExpression(s string) error {
+	var (
+		stack []byte
+		quote byte
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch c {
+			case '\\':
+				i++
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '(', '[', '{':
+			stack = append(stack, c)
+		case ')', ']', '}':
+			o := map[byte]byte{')': '(', ']': '[', '}': '{'}[c]
+			if len(stack) == 0 || stack[len(stack)-1] != o {
+				return fmt.Errorf("unbalanced %q", c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	switch {
+	case quote != 0:
+		return errors.New("unterminated string")
+	case len(stack) != 0:
+		return fmt.Errorf("unclosed %q", stack[len(stack)-1])
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package gguf_parser
+
+import (
+	"testing"
+
+	"github.com/gpustack/gguf-parser-go/util/json"
+)
+
+func TestGGUFFile_Lint(t *testing.T) {
+	gf := testQuantizeGGUFFile(2)
+	gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+		GGUFMetadataKV{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(32)},
+		GGUFMetadataKV{Key: "general.license", ValueType: GGUFMetadataValueTypeString, Value: "Apache-2.0"},
+		GGUFMetadataKV{Key: "tokenizer.ggml.model", ValueType: GGUFMetadataValueTypeString, Value: "gpt2"},
+		GGUFMetadataKV{Key: "tokenizer.ggml.tokens", ValueType: GGUFMetadataValueTypeArray, Value: GGUFMetadataKVArrayValue{
+			Type: GGUFMetadataValueTypeString, Len: 1024,
+		}},
+		GGUFMetadataKV{Key: "tokenizer.ggml.bos_token_id", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1)},
+		GGUFMetadataKV{Key: "tokenizer.chat_template", ValueType: GGUFMetadataValueTypeString,
+			Value: "{%- for message in messages %}{{ '<|' + message['role'] + '|>' + message['content'] }}{% endfor -%}" +
+				"{% if add_generation_prompt %}{{ '<|assistant|>' }}{% endif %}"},
+	)
+
+	if fs := gf.Lint(WithLintFilename("Tiny-1B-F16.gguf")); len(fs) != 0 {
+		t.Fatalf("expected no findings, got %v", fs)
+	}
+
+	set := func(key string, value any) {
+		for i := range gf.Header.MetadataKV {
+			if gf.Header.MetadataKV[i].Key == key {
+				gf.Header.MetadataKV[i].Value = value
+				return
+			}
+		}
+		gf.Header.MetadataKV = append(gf.Header.MetadataKV,
+			GGUFMetadataKV{Key: key, ValueType: GGUFMetadataValueTypeString, Value: value})
+	}
+	set("tokenizer.ggml.bos_token_id", uint32(1024))
+	set("llama.vocab_size", uint32(1000))
+	set("tokenizer.chat_template", "{% for message in messages %}{{ message['content'] }}")
+	set("general.license", "llama3")
+	set("llama.unknown_key", "x")
+
+	fs := gf.Lint(WithLintFilename("Tiny-1B-Q4_K_M.gguf"))
+	rules := map[string]GGUFLintSeverity{}
+	for _, f := range fs {
+		rules[f.Rule] = f.Severity
+	}
+	expected := map[string]GGUFLintSeverity{
+		"token-id-out-of-range":    GGUFLintSeverityError,
+		"vocabulary-mismatch":      GGUFLintSeverityError,
+		"chat-template":            GGUFLintSeverityError,
+		"license":                  GGUFLintSeverityWarning,
+		"filename-file-type":       GGUFLintSeverityWarning,
+		"unknown-architecture-key": GGUFLintSeverityInfo,
+	}
+	for r, s := range expected {
+		if rules[r] != s {
+			t.Errorf("expected %s finding in %s, got %v", r, s, fs)
+		}
+	}
+	if len(fs) != len(expected) {
+		t.Errorf("expected %d findings, got %v", len(expected), fs)
+	}
+}
+
+func TestLintJinjaTemplate(t *testing.T) {
+	cases := []struct {
+		given string
+		valid bool
+	}{
+		{"{{ bos_token }}{% for m in messages %}{% if m.role == 'user' %}{{ m.content }}{% elif m.role %}x{% else %}y{% endif %}{% endfor %}", true},
+		{"{% set ns = namespace(found=false) %}{% set x %}block{% endset %}{# comment }} #}", true},
+		{"{% raw %}{% if %}{% endraw %}", true},
+		{"{% if x %}", false},
+		{"{% endfor %}", false},
+		{"{{ message['content' }}", false},
+		{"{{ 'unterminated }}", false},
+		{"{{ x ", false},
+	}
+	for _, tc := range cases {
+		if err := lintJinjaTemplate(tc.given); (err == nil) != tc.valid {
+			t.Errorf("%q: expected valid %v, got %v", tc.given, tc.valid, err)
+		}
+	}
+}
+
+func TestIsSPDXLicenseExpression(t *testing.T) {
+	cases := map[string]bool{
+		"MIT":                               true,
+		"apache-2.0":                        true,
+		"(MIT OR Apache-2.0) AND CC-BY-4.0": true,
+		"GPL-2.0-or-later WITH Classpath-exception-2.0": true,
+		"LicenseRef-Qwen": true,
+		"llama3":          false,
+		"other":           false,
+		"MIT OR":          false,
+	}
+	for given, expected := range cases {
+		if actual := isSPDXLicenseExpression(given); actual != expected {
+			t.Errorf("%q: expected %v, got %v", given, expected, actual)
+		}
+	}
+}
+
+func TestGGUFLintFinding_JSON(t *testing.T) {
+	f := GGUFLintFinding{Rule: "license", Severity: GGUFLintSeverityWarning, Message: "not SPDX"}
+	bs, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"rule":"license","severity":"Warning","message":"not SPDX"}`; string(bs) != expected {
+		t.Fatalf("expected %s, got %s", expected, bs)
+	}
+
+	var actual GGUFLintFinding
+	if err = json.Unmarshal(bs, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual != f {
+		t.Errorf("expected %+v, got %+v", f, actual)
+	}
+	if err = json.Unmarshal([]byte(`{"severity":"Fatal"}`), &actual); err == nil {
+		t.Error("expected error for unknown severity")
+	}
+}
@@ -135,10 +135,14 @@ const (
 // we can use this list to match the value in explicit `general.architecture`.
 var _GGUFPotentialDiffusionArchitectures = []string{
 	"flux",
+	"hyvid",
+	"ltxv",
+	"qwen_image",
 	"sd",
 	"sd2.5",
 	"sd3",
 	"stable-diffusion",
+	"wan",
 }
 
 // _GGUFPotentialDiffusionArchitectureTensorsRegexes holds a list of regexes to match the potential diffusion architecture tensors.
@@ -149,6 +153,8 @@ var _GGUFPotentialDiffusionArchitectureTensorsRegexes = []*regexp.Regexp{
 	regexp.MustCompile(`^model\.diffusion_model\..*`),
 	regexp.MustCompile(`^double_blocks\..*`),
 	regexp.MustCompile(`^joint_blocks\..*`),
+	regexp.MustCompile(`^transformer_blocks\..*`),
+	regexp.MustCompile(`^blocks\.\d+\.cross_attn\..*`),
 	regexp.MustCompile(`^decoder\..*`),
 	regexp.MustCompile(`^encoder\..*`),
 	regexp.MustCompile(`^text_model\..*`),
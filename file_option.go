@@ -27,8 +27,23 @@ type (
 		SkipDNSCache               bool
 		BufferSize                 int
 		SkipRangeDownloadDetection bool
+		ShardConcurrency           int
 		CachePath                  string
 		CacheExpiration            time.Duration
+
+		// Download.
+		DownloadChunkSize   int64
+		DownloadConcurrency int
+		DownloadProgress    GGUFDownloadProgressFunc
+
+		// S3.
+		S3Endpoint        string
+		S3Region          string
+		S3PathStyle       bool
+		S3AccessKeyID     string
+		S3SecretAccessKey string
+		S3SessionToken    string
+		S3Profile         string
 	}
 
 	// GGUFReadOption is the option for reading the file.
@@ -117,6 +132,17 @@ func SkipRangeDownloadDetection() GGUFReadOption {
 	}
 }
 
+// UseShardConcurrency sets the maximum number of shards to fetch concurrently
+// when reading a split file from remote, default is 8.
+func UseShardConcurrency(n int) GGUFReadOption {
+	if n < 1 {
+		n = 1
+	}
+	return func(o *_GGUFReadOptions) {
+		o.ShardConcurrency = n
+	}
+}
+
 // UseCache caches the remote reading result.
 func UseCache() GGUFReadOption {
 	return func(o *_GGUFReadOptions) {
@@ -164,3 +190,98 @@ func UseCacheExpiration(expiration time.Duration) GGUFReadOption {
 		o.CacheExpiration = expiration
 	}
 }
+
+// UseDownloadChunkSize sets the size of each range request when downloading from remote,
+// default is 32 MiB.
+func UseDownloadChunkSize(size int64) GGUFReadOption {
+	const minSize = 1024 * 1024
+	if size < minSize {
+		size = minSize
+	}
+	return func(o *_GGUFReadOptions) {
+		o.DownloadChunkSize = size
+	}
+}
+
+// UseDownloadConcurrency sets the maximum number of range requests in parallel when downloading from remote,
+// default is 4.
+func UseDownloadConcurrency(n int) GGUFReadOption {
+	if n < 1 {
+		n = 1
+	}
+	return func(o *_GGUFReadOptions) {
+		o.DownloadConcurrency = n
+	}
+}
+
+// UseDownloadProgress reports the progress through the given function when downloading from remote.
+func UseDownloadProgress(fn GGUFDownloadProgressFunc) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.DownloadProgress = fn
+	}
+}
+
+// UseS3Endpoint uses the given endpoint to access the S3 compatible storage,
+// e.g. http://127.0.0.1:9000 for MinIO.
+//
+// Default is the AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL environment variable,
+// or the AWS S3 endpoint of the region.
+func UseS3Endpoint(endpoint string) GGUFReadOption {
+	endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+	return func(o *_GGUFReadOptions) {
+		if endpoint == "" {
+			return
+		}
+		o.S3Endpoint = endpoint
+	}
+}
+
+// UseS3Region uses the given region to sign the S3 requests.
+//
+// Default is the AWS_REGION or AWS_DEFAULT_REGION environment variable,
+// or the region of the profile, or us-east-1.
+func UseS3Region(region string) GGUFReadOption {
+	region = strings.TrimSpace(region)
+	return func(o *_GGUFReadOptions) {
+		if region == "" {
+			return
+		}
+		o.S3Region = region
+	}
+}
+
+// UseS3PathStyle uses the path-style addressing(endpoint/bucket/key) to access the S3 compatible storage,
+// instead of the virtual-hosted-style addressing(bucket.endpoint/key).
+func UseS3PathStyle() GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		o.S3PathStyle = true
+	}
+}
+
+// UseS3Credentials uses the given credentials to sign the S3 requests.
+//
+// Default is the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables,
+// or the credentials of the profile,
+// requests are sent anonymously if no credentials are found.
+func UseS3Credentials(accessKeyID, secretAccessKey, sessionToken string) GGUFReadOption {
+	return func(o *_GGUFReadOptions) {
+		if accessKeyID == "" || secretAccessKey == "" {
+			return
+		}
+		o.S3AccessKeyID = accessKeyID
+		o.S3SecretAccessKey = secretAccessKey
+		o.S3SessionToken = sessionToken
+	}
+}
+
+// UseS3Profile uses the given profile of the AWS shared credentials and config files,
+// default is the AWS_PROFILE environment variable, or "default".
+func UseS3Profile(profile string) GGUFReadOption {
+	profile = strings.TrimSpace(profile)
+	return func(o *_GGUFReadOptions) {
+		if profile == "" {
+			return
+		}
+		o.S3Profile = profile
+	}
+}
@@ -0,0 +1,489 @@
+package gguf_parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gpustack/gguf-parser-go/util/httpx"
+	"github.com/gpustack/gguf-parser-go/util/json"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+var ErrGGUFProjectorNotFound = errors.New("gguf projector not found")
+
+// GGUFProjectorMismatch represents a mismatch between a multimodal projector and its text model.
+type GGUFProjectorMismatch struct {
+	// Rule is the name of the violated rule, e.g. "vision-projection-dim".
+	Rule string `json:"rule"`
+	// Message describes the mismatch.
+	Message string `json:"message"`
+}
+
+func (m GGUFProjectorMismatch) String() string {
+	return fmt.Sprintf("[%s] %s", m.Rule, m.Message)
+}
+
+// _GGUFProjectorTypeArchitectures holds the text model architectures
+// that a projector type is known to pair with,
+// the projector types not listed here are not checked,
+// e.g. "mlp" and "ldp" are shared by many architectures.
+var _GGUFProjectorTypeArchitectures = map[string][]string{
+	"gemma3":           {"gemma3"},
+	"gemma3nv":         {"gemma3n"},
+	"gemma3na":         {"gemma3n"},
+	"llama4":           {"llama4"},
+	"qwen2vl_merger":   {"qwen2vl"},
+	"qwen2.5vl_merger": {"qwen2vl"},
+	"qwen2.5o":         {"qwen2vl"},
+	"qwen3vl_merger":   {"qwen3vl", "qwen3vlmoe"},
+	"qwen2a":           {"qwen2"},
+	"glm_edge":         {"glm4", "chatglm"},
+	"kimivl":           {"deepseek2"},
+	"lfm2":             {"lfm2"},
+	"pixtral":          {"llama", "mistral3"},
+	"idefics3":         {"llama", "smollm3"},
+	"resampler":        {"llama", "qwen2", "qwen3", "minicpm"},
+}
+
+// _GGUFProjectorVisionProjectionTensors holds the tensor that outputs the vision embedding of a projector type,
+// and the index of the dimension that equals to the embedding length of the text model,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, clip_n_mmproj_embd.
+var _GGUFProjectorVisionProjectionTensors = map[string]struct {
+	Name  string
+	Index int
+}{
+	"ldp":              {"mm.model.mb_block.1.block.2.1.bias", 0},
+	"ldpv2":            {"mm.model.peg.0.bias", 0},
+	"mlp":              {"mm.2.bias", 0},
+	"mlp_norm":         {"mm.3.bias", 0},
+	"pixtral":          {"mm.2.bias", 0},
+	"qwen2vl_merger":   {"mm.2.bias", 0},
+	"qwen2.5vl_merger": {"mm.2.bias", 0},
+	"resampler":        {"resampler.query", 0},
+	"glm_edge":         {"mm.model.mlp.3.weight", 1},
+	"gemma3":           {"mm.input_projection.weight", 0},
+	"idefics3":         {"mm.model.fc.weight", 1},
+	"llama4":           {"mm.model.fc.weight", 1},
+	"internvl":         {"mm.model.mlp.3.weight", 1},
+}
+
+// CheckProjectorCompatibility checks whether the given multimodal projector can be paired with the given text model,
+// and returns the mismatches, or nil if compatible.
+//
+// The vision and audio embedding length of the projector must equal to the embedding length of the text model,
+// and the projector type must be known to pair with the architecture of the text model if it is specific to some.
+func CheckProjectorCompatibility(model, projector *GGUFFile) (ms []GGUFProjectorMismatch) {
+	add := func(rule, format string, args ...any) {
+		ms = append(ms, GGUFProjectorMismatch{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	ma, pa := model.Architecture(), projector.Architecture()
+	if ma.Type != "model" {
+		add("model-type", "model type %q is not a model", ma.Type)
+		return ms
+	}
+	if pa.Type != "projector" {
+		add("projector-type", "projector type %q is not a projector", pa.Type)
+		return ms
+	}
+
+	if pa.ClipHasVisionEncoder {
+		var pd uint64
+		if t, ok := _GGUFProjectorVisionProjectionTensors[pa.ClipProjectorType]; ok {
+			if ti, ok := projector.TensorInfos.Get(t.Name); ok && int(ti.NDimensions) > t.Index {
+				pd = ti.Dimensions[t.Index]
+			}
+		}
+		if pd == 0 {
+			pd = uint64(pa.ClipVisionProjectionDim)
+		}
+		if pd != 0 && pd != ma.EmbeddingLength {
+			add("vision-projection-dim", "vision projection dim %d mismatches model embedding length %d", pd, ma.EmbeddingLength)
+		}
+	}
+	if pa.ClipHasAudioEncoder {
+		if pd := uint64(pa.ClipAudioProjectionDim); pd != 0 && pd != ma.EmbeddingLength {
+			add("audio-projection-dim", "audio projection dim %d mismatches model embedding length %d", pd, ma.EmbeddingLength)
+		}
+	}
+
+	if as, ok := _GGUFProjectorTypeArchitectures[pa.ClipProjectorType]; ok && !slices.Contains(as, ma.Architecture) {
+		add("projector-architecture", "projector type %q is not known to pair with model architecture %q, expected one of %v",
+			pa.ClipProjectorType, ma.Architecture, as)
+	}
+
+	return ms
+}
+
+// SearchProjectorGGUFFile searches the multimodal projector GGUF file which pairs with the given model
+// in the given directory,
+// and returns the path and the GGUFFile of the projector, or ErrGGUFProjectorNotFound if not found.
+//
+// The candidates are the GGUF files whose name contains "mmproj",
+// the first one in name order without mismatches is returned,
+// and the candidates failed to parse are skipped.
+func SearchProjectorGGUFFile(model *GGUFFile, dir string, opts ...GGUFReadOption) (string, *GGUFFile, error) {
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("read dir %s: %w", dir, err)
+	}
+
+	ns := make([]string, 0, len(es))
+	for _, e := range es {
+		if !e.IsDir() {
+			ns = append(ns, e.Name())
+		}
+	}
+
+	n, pgf, err := searchProjectorGGUFFile(model, ns, func(n string) (*GGUFFile, error) {
+		return ParseGGUFFile(filepath.Join(dir, n), opts...)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, n), pgf, nil
+}
+
+// SearchProjectorGGUFFileFromHuggingFace searches the multimodal projector GGUF file which pairs with the given model
+// in the given Hugging Face(https://huggingface.co/) repository,
+// and returns the file name and the GGUFFile of the projector, or ErrGGUFProjectorNotFound if not found.
+//
+// See SearchProjectorGGUFFile for the candidates.
+func SearchProjectorGGUFFileFromHuggingFace(ctx context.Context, model *GGUFFile, repo string, opts ...GGUFReadOption) (string, *GGUFFile, error) {
+	ep := osx.Getenv("HF_ENDPOINT", "https://huggingface.co")
+
+	var fs []struct {
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}
+	if err := getProjectorRepositoryFiles(ctx, fmt.Sprintf("%s/api/models/%s/tree/main?recursive=true", ep, repo), &fs, opts); err != nil {
+		return "", nil, err
+	}
+
+	ns := make([]string, 0, len(fs))
+	for _, f := range fs {
+		if f.Type == "file" {
+			ns = append(ns, f.Path)
+		}
+	}
+
+	return searchProjectorGGUFFile(model, ns, func(n string) (*GGUFFile, error) {
+		return ParseGGUFFileFromHuggingFace(ctx, repo, n, opts...)
+	})
+}
+
+// SearchProjectorGGUFFileFromModelScope searches the multimodal projector GGUF file which pairs with the given model
+// in the given Model Scope(https://modelscope.cn/) repository,
+// and returns the file name and the GGUFFile of the projector, or ErrGGUFProjectorNotFound if not found.
+//
+// See SearchProjectorGGUFFile for the candidates.
+func SearchProjectorGGUFFileFromModelScope(ctx context.Context, model *GGUFFile, repo string, opts ...GGUFReadOption) (string, *GGUFFile, error) {
+	ep := osx.Getenv("MS_ENDPOINT", "https://modelscope.cn")
+
+	var fs struct {
+		Data struct {
+			Files []struct {
+				Type string `json:"Type"`
+				Path string `json:"Path"`
+			} `json:"Files"`
+		} `json:"Data"`
+	}
+	if err := getProjectorRepositoryFiles(ctx, fmt.Sprintf("%s/api/v1/models/%s/repo/files?Revision=master&Recursive=true", ep, repo), &fs, opts); err != nil {
+		return "", nil, err
+	}
+
+	ns := make([]string, 0, len(fs.Data.Files))
+	for _, f := range fs.Data.Files {
+		if f.Type == "blob" {
+			ns = append(ns, f.Path)
+		}
+	}
+
+	return searchProjectorGGUFFile(model, ns, func(n string) (*GGUFFile, error) {
+		return ParseGGUFFileFromModelScope(ctx, repo, n, opts...)
+	})
+}
+
+// getProjectorRepositoryFiles gets the file list of a remote repository from the given url,
+// and decodes the response into the given value.
+func getProjectorRepositoryFiles(ctx context.Context, url string, v any, opts []GGUFReadOption) error {
+	var o _GGUFReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cli := httpx.Client(remoteClientOptions(url, o))
+
+	req, err := httpx.NewGetRequestWithContext(ctx, url)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	err = httpx.Do(cli, req, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status code %d", resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	})
+	if err != nil {
+		return fmt.Errorf("do request %s: %w", url, err)
+	}
+	return nil
+}
+
+// searchProjectorGGUFFile returns the first candidate of the given names which pairs with the given model,
+// the candidates failed to parse are skipped.
+func searchProjectorGGUFFile(model *GGUFFile, names []string, parse func(string) (*GGUFFile, error)) (string, *GGUFFile, error) {
+	cs := make([]string, 0, len(names))
+	for _, n := range names {
+		b := strings.ToLower(filepath.Base(n))
+		if strings.HasSuffix(b, ".gguf") && strings.Contains(b, "mmproj") {
+			cs = append(cs, n)
+		}
+	}
+	sort.Strings(cs)
+
+	for _, n := range cs {
+		pgf, err := parse(n)
+		if err != nil {
+			continue
+		}
+		if len(CheckProjectorCompatibility(model, pgf)) == 0 {
+			return n, pgf, nil
+		}
+	}
+	return "", nil, ErrGGUFProjectorNotFound
+}
+
+// ClipImageTokens returns the number of tokens that the multimodal projector produces for an image in the given size,
+// or 0 if the projector has no vision encoder.
+//
+// The tokens wrapping the image or its slices, e.g. "<image>" and "<slice>", are not included,
+// since they are tokenized from the text.
+//
+// The slicing schemes of MiniCPM-V, LLaVA-Next(anyres), the dynamic resolution of Qwen2-VL
+// and the native resolution of Pixtral(limited by ClipVisionImageSize, or 1024 if not provided) are respected,
+// other projector types are counted as an image resized to ClipVisionImageSize,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, clip_n_output_tokens.
+func (ga GGUFArchitecture) ClipImageTokens(width, height uint32) uint64 {
+	if !ga.ClipHasVisionEncoder || width == 0 || height == 0 {
+		return 0
+	}
+
+	w, h := uint64(width), uint64(height)
+	is, ps := uint64(ga.ClipVisionImageSize), uint64(max(ga.ClipVisionPatchSize, 1))
+
+	switch {
+	case ga.ClipHasMiniCPMVProjector || ga.ClipProjectorType == "resampler":
+		// Each slice and the overview are resampled into a fixed number of queries.
+		nq := uint64(ga.ClipMiniCPMVQueryNum)
+		if nq == 0 {
+			nq = 64
+			if ga.ClipMiniCPMVVersion == 2 {
+				nq = 96
+			}
+		}
+		return nq * (1 + clipMiniCPMVSlices(w, h, is))
+	case ga.ClipHasQwen2VLMerger ||
+		ga.ClipProjectorType == "qwen2vl_merger" ||
+		ga.ClipProjectorType == "qwen2.5vl_merger" ||
+		ga.ClipProjectorType == "qwen3vl_merger" ||
+		ga.ClipProjectorType == "qwen2.5o":
+		// The image is resized to the multiple of the merged patch size,
+		// limited between 8 and 4096 tokens.
+		mg := uint64(2)
+		if ga.ClipVisionSpatialMergeSize > 0 {
+			mg = uint64(ga.ClipVisionSpatialMergeSize)
+		}
+		f := ps * mg
+		w, h = clipSmartResize(w, h, f, 8*f*f, 4096*f*f)
+		return (w / f) * (h / f)
+	case ga.ClipProjectorType == "pixtral" || ga.ClipVisionHasImageBreak:
+		// The image is encoded in its own resolution,
+		// scaled down to fit the image size.
+		ms := is
+		if ms == 0 {
+			ms = 1024
+		}
+		if l := max(w, h); l > ms {
+			w, h = max(w*ms/l, 1), max(h*ms/l, 1)
+		}
+		n, _ := ga.clipImageGridTokens(w, h, true)
+		return n
+	}
+
+	if is == 0 {
+		return 0
+	}
+	var n uint64
+	switch ga.ClipProjectorType {
+	case "gemma3nv":
+		// The image size divided by the patch size is the total of the fixed token grid.
+		n = is / ps
+	case "ldp", "ldpv2":
+		n = (is / ps) * (is / ps) / 4
+	default:
+		nps := is / ps
+		if ga.ClipVisionSpatialMergeSize > 1 {
+			nps /= uint64(ga.ClipVisionSpatialMergeSize)
+		} else if ga.ClipVisionProjectorScaleFactor > 1 {
+			nps /= uint64(ga.ClipVisionProjectorScaleFactor)
+		}
+		n = nps * nps
+	}
+
+	if ga.ClipVisionMMPatchMergeType == "spatial_unpad" {
+		// LLaVA-Next encodes the overview and the slices of the best fit resolution.
+		gw, gh := clipAnyResolution(w, h, is, ga.ClipVisionImageGridPinpoints)
+		return n * (1 + ((gw+is-1)/is)*((gh+is-1)/is))
+	}
+	return n
+}
+
+// ClipAudioTokens returns the number of tokens that the multimodal projector produces for an audio in the given duration,
+// or 0 if the projector has no audio encoder.
+//
+// The audio is split into 30 seconds chunks of 3000 mel frames like Whisper,
+// the last chunk is padded,
+// and the frames are downsampled by 2 in the encoder and stacked by ClipAudioProjectorStackFactor in the projector,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, clip_n_output_tokens.
+func (ga GGUFArchitecture) ClipAudioTokens(duration time.Duration) uint64 {
+	if !ga.ClipHasAudioEncoder || duration <= 0 {
+		return 0
+	}
+
+	const chunkFrames = 3000
+
+	frames := uint64(math.Ceil(duration.Seconds() * 100))
+	chunks := (frames + chunkFrames - 1) / chunkFrames
+
+	var n uint64
+	switch ga.ClipProjectorType {
+	case "qwen2a", "qwen2.5o":
+		// Downsampled by 2 in the encoder and 2 in the average pooling.
+		n = chunkFrames / 4
+	default:
+		sf := uint64(max(ga.ClipAudioProjectorStackFactor, 1))
+		n = (chunkFrames + sf - 1) / sf / 2
+	}
+	return chunks * n
+}
+
+// clipImageGridTokens returns the number of tokens of an image in the given size,
+// which is encoded in its own resolution, and the number of patches merged into one token.
+//
+// The patches are merged by ClipVisionSpatialMergeSize or ClipVisionProjectorScaleFactor in each side,
+// rounding up,
+// and an [IMG_BREAK] token follows each row except the last one if imgBreak is true,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, clip_n_output_tokens.
+func (ga GGUFArchitecture) clipImageGridTokens(w, h uint64, imgBreak bool) (n, merged uint64) {
+	ps := uint64(max(ga.ClipVisionPatchSize, 1))
+	mg := uint64(1)
+	if ga.ClipVisionSpatialMergeSize > 1 {
+		mg = uint64(ga.ClipVisionSpatialMergeSize)
+	} else if ga.ClipVisionProjectorScaleFactor > 1 {
+		mg = uint64(ga.ClipVisionProjectorScaleFactor)
+	}
+
+	f := ps * mg
+	rows, cols := (h+f-1)/f, (w+f-1)/f
+	n = rows * cols
+	if imgBreak && rows > 0 {
+		n += rows - 1
+	}
+	return n, mg * mg
+}
+
+// clipMiniCPMVSlices returns the number of slices of an image in the given size for MiniCPM-V,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, llava_uhd::get_slice_instructions.
+func clipMiniCPMVSlices(w, h, is uint64) uint64 {
+	const maxSlices = 9
+
+	if is == 0 {
+		return 0
+	}
+	r := float64(w*h) / float64(is*is)
+	m := min(uint64(math.Ceil(r)), maxSlices)
+	if m <= 1 {
+		return 0
+	}
+
+	lr := math.Log(float64(w) / float64(h))
+	var (
+		best   uint64
+		minErr = math.Inf(1)
+	)
+	for _, s := range []uint64{m - 1, m, m + 1} {
+		if s == 1 || s > maxSlices {
+			continue
+		}
+		for c := uint64(1); c <= s; c++ {
+			if s%c != 0 {
+				continue
+			}
+			if e := math.Abs(lr - math.Log(float64(c)/float64(s/c))); e < minErr {
+				best, minErr = s, e
+			}
+		}
+	}
+	return best
+}
+
+// clipAnyResolution returns the best fit resolution of an image in the given size for LLaVA-Next,
+// the given pinpoints are in [width, height] pairs,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, select_best_resolution.
+func clipAnyResolution(w, h, is uint64, pinpoints []uint32) (uint64, uint64) {
+	ps := make([]uint64, 0, len(pinpoints))
+	for _, p := range pinpoints {
+		ps = append(ps, uint64(p))
+	}
+	if len(ps) < 2 {
+		// Default to the pinpoints of LLaVA 1.6.
+		ps = []uint64{is, 2 * is, 2 * is, is, 2 * is, 2 * is, 3 * is, is, is, 3 * is}
+	}
+
+	var (
+		bw, bh    uint64
+		maxEff    uint64
+		minWasted = uint64(math.MaxUint64)
+	)
+	for i := 0; i+1 < len(ps); i += 2 {
+		pw, ph := ps[i], ps[i+1]
+		s := min(float64(pw)/float64(w), float64(ph)/float64(h))
+		dw, dh := uint64(float64(w)*s), uint64(float64(h)*s)
+		eff := min(dw*dh, w*h)
+		wasted := pw*ph - eff
+		if eff > maxEff || (eff == maxEff && wasted < minWasted) {
+			bw, bh, maxEff, minWasted = pw, ph, eff, wasted
+		}
+	}
+	return bw, bh
+}
+
+// clipSmartResize returns the size of an image resized to the multiple of the given factor,
+// keeping the aspect ratio and the pixels between the given minimum and maximum,
+// see https://github.com/ggml-org/llama.cpp/blob/master/tools/mtmd/clip.cpp, calc_size_preserved_ratio.
+func clipSmartResize(w, h, f, minPixels, maxPixels uint64) (uint64, uint64) {
+	ff := float64(f)
+	wb := max(f, uint64(math.Round(float64(w)/ff))*f)
+	hb := max(f, uint64(math.Round(float64(h)/ff))*f)
+	switch {
+	case wb*hb > maxPixels:
+		b := math.Sqrt(float64(w*h) / float64(maxPixels))
+		wb = max(f, uint64(math.Floor(float64(w)/b/ff))*f)
+		hb = max(f, uint64(math.Floor(float64(h)/b/ff))*f)
+	case wb*hb < minPixels:
+		b := math.Sqrt(float64(minPixels) / float64(w*h))
+		wb = uint64(math.Ceil(float64(w)*b/ff)) * f
+		hb = uint64(math.Ceil(float64(h)*b/ff)) * f
+	}
+	return wb, hb
+}
@@ -0,0 +1,257 @@
+package gguf_parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckProjectorCompatibility(t *testing.T) {
+	model := testQuantizeGGUFFile(2)
+
+	projector := func(typ string, dim uint64) (GGUFMetadataKVs, GGUFTensorInfos) {
+		kvs := GGUFMetadataKVs{
+			{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "clip"},
+			{Key: "general.type", ValueType: GGUFMetadataValueTypeString, Value: "mmproj"},
+			{Key: "clip.projector_type", ValueType: GGUFMetadataValueTypeString, Value: typ},
+			{Key: "clip.has_vision_encoder", ValueType: GGUFMetadataValueTypeBool, Value: true},
+			{Key: "clip.vision.projection_dim", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(dim)},
+		}
+		tis := GGUFTensorInfos{
+			{Name: "mm.2.bias", NDimensions: 1, Dimensions: []uint64{dim}, Type: GGMLTypeF32},
+		}
+		return kvs, tis
+	}
+	rules := func(ms []GGUFProjectorMismatch) map[string]int {
+		rs := map[string]int{}
+		for _, m := range ms {
+			rs[m.Rule]++
+		}
+		return rs
+	}
+
+	cases := []struct {
+		name     string
+		typ      string
+		dim      uint64
+		expected map[string]int
+	}{
+		{"Compatible", "mlp", 512, map[string]int{}},
+		{"Dim", "mlp", 4096, map[string]int{"vision-projection-dim": 1}},
+		{"Architecture", "qwen2vl_merger", 512, map[string]int{"projector-architecture": 1}},
+		{"Both", "qwen2.5vl_merger", 3584, map[string]int{"vision-projection-dim": 1, "projector-architecture": 1}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, tis := projector(tc.typ, tc.dim)
+			pgf := &GGUFFile{TensorInfos: tis}
+			pgf.Header.MetadataKV = kvs
+			rs := rules(CheckProjectorCompatibility(model, pgf))
+			if len(rs) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, rs)
+			}
+			for r := range tc.expected {
+				if rs[r] != tc.expected[r] {
+					t.Errorf("expected %d %s mismatch(es), got %v", tc.expected[r], r, rs)
+				}
+			}
+		})
+	}
+
+	t.Run("Search", func(t *testing.T) {
+		dir := t.TempDir()
+		for n, d := range map[string]uint64{
+			"mmproj-a-f16.gguf": 4096,
+			"mmproj-b-f16.gguf": 512,
+			"model-f16.gguf":    512,
+		} {
+			kvs, tis := projector("mlp", d)
+			if err := os.WriteFile(filepath.Join(dir, n), testGGUFFileBytes(kvs, tis), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The unparsable candidate is skipped.
+		if err := os.WriteFile(filepath.Join(dir, "mmproj-0-broken.gguf"), []byte("not a gguf file"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		p, pgf, err := SearchProjectorGGUFFile(model, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != filepath.Join(dir, "mmproj-b-f16.gguf") || pgf == nil {
+			t.Errorf("expected mmproj-b-f16.gguf, got %s", p)
+		}
+
+		_, _, err = SearchProjectorGGUFFile(testQuantizeGGUFFile(1), t.TempDir())
+		if !errors.Is(err, ErrGGUFProjectorNotFound) {
+			t.Errorf("expected ErrGGUFProjectorNotFound, got %v", err)
+		}
+	})
+}
+
+func TestGGUFArchitecture_ClipImageTokens(t *testing.T) {
+	cases := []struct {
+		name          string
+		given         GGUFArchitecture
+		width, height uint32
+		expected      uint64
+	}{
+		{
+			name: "LLaVA",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "mlp", ClipVisionMMPatchMergeType: "flat",
+				ClipVisionImageSize: 336, ClipVisionPatchSize: 14, ClipVisionProjectorScaleFactor: 1,
+			},
+			width: 1024, height: 768,
+			expected: 576,
+		},
+		{
+			name: "LLaVA-Next",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "mlp", ClipVisionMMPatchMergeType: "spatial_unpad",
+				ClipVisionImageSize: 336, ClipVisionPatchSize: 14, ClipVisionProjectorScaleFactor: 1,
+			},
+			width: 672, height: 672,
+			expected: 576 * 5,
+		},
+		{
+			name: "LLaVA-Next Wide",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "mlp", ClipVisionMMPatchMergeType: "spatial_unpad",
+				ClipVisionImageSize: 336, ClipVisionPatchSize: 14, ClipVisionProjectorScaleFactor: 1,
+			},
+			width: 1000, height: 300,
+			expected: 576 * 4,
+		},
+		{
+			name: "MiniCPM-V Overview",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "resampler", ClipMiniCPMVVersion: 4,
+				ClipVisionImageSize: 448, ClipVisionPatchSize: 14,
+			},
+			width: 448, height: 448,
+			expected: 64,
+		},
+		{
+			name: "MiniCPM-V Slices",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "resampler", ClipMiniCPMVVersion: 4,
+				ClipVisionImageSize: 448, ClipVisionPatchSize: 14,
+			},
+			width: 1344, height: 896,
+			expected: 64 * 7,
+		},
+		{
+			name: "Qwen2-VL",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "qwen2vl_merger",
+				ClipVisionImageSize: 560, ClipVisionPatchSize: 14,
+			},
+			width: 1000, height: 500,
+			expected: 36 * 18,
+		},
+		{
+			name: "Qwen2-VL Limited",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "qwen2.5vl_merger",
+				ClipVisionImageSize: 560, ClipVisionPatchSize: 14,
+			},
+			width: 4000, height: 3000,
+			expected: 73 * 55,
+		},
+		{
+			name: "Gemma3",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "gemma3",
+				ClipVisionImageSize: 896, ClipVisionPatchSize: 14, ClipVisionProjectorScaleFactor: 4,
+			},
+			width: 640, height: 480,
+			expected: 256,
+		},
+		{
+			name: "Pixtral",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "pixtral", ClipVisionHasImageBreak: true,
+				ClipVisionImageSize: 1024, ClipVisionPatchSize: 16, ClipVisionProjectorScaleFactor: 1,
+			},
+			width: 512, height: 256,
+			expected: 32*16 + 15,
+		},
+		{
+			name: "Pixtral Merged",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "pixtral", ClipVisionHasImageBreak: true,
+				ClipVisionImageSize: 1024, ClipVisionPatchSize: 14, ClipVisionSpatialMergeSize: 2,
+			},
+			width: 2048, height: 1536,
+			expected: 37*28 + 27,
+		},
+		{
+			name: "Image Break",
+			given: GGUFArchitecture{
+				ClipHasVisionEncoder: true, ClipProjectorType: "lightonocr", ClipVisionHasImageBreak: true,
+				ClipVisionImageSize: 1540, ClipVisionPatchSize: 14, ClipVisionSpatialMergeSize: 2,
+			},
+			width: 700, height: 700,
+			expected: 25*25 + 24,
+		},
+		{
+			name:  "No Vision",
+			given: GGUFArchitecture{ClipHasAudioEncoder: true},
+			width: 640, height: 480,
+			expected: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.given.ClipImageTokens(tc.width, tc.height); actual != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGGUFArchitecture_ClipAudioTokens(t *testing.T) {
+	cases := []struct {
+		name     string
+		given    GGUFArchitecture
+		duration time.Duration
+		expected uint64
+	}{
+		{
+			name:     "Ultravox",
+			given:    GGUFArchitecture{ClipHasAudioEncoder: true, ClipProjectorType: "ultravox", ClipAudioProjectorStackFactor: 8},
+			duration: 45 * time.Second,
+			expected: 2 * 187,
+		},
+		{
+			name:     "Voxtral",
+			given:    GGUFArchitecture{ClipHasAudioEncoder: true, ClipProjectorType: "voxtral", ClipAudioProjectorStackFactor: 4},
+			duration: 30 * time.Second,
+			expected: 375,
+		},
+		{
+			name:     "Qwen2-Audio",
+			given:    GGUFArchitecture{ClipHasAudioEncoder: true, ClipProjectorType: "qwen2a", ClipAudioProjectorStackFactor: 1},
+			duration: 10 * time.Second,
+			expected: 750,
+		},
+		{
+			name:     "No Audio",
+			given:    GGUFArchitecture{ClipHasVisionEncoder: true},
+			duration: 10 * time.Second,
+			expected: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.given.ClipAudioTokens(tc.duration); actual != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,721 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrGGUFQuantizeImportanceMatrixRequired is returned when the target quantization requires an importance matrix.
+var ErrGGUFQuantizeImportanceMatrixRequired = errors.New("importance matrix required")
+
+// Types for planning quantization.
+type (
+	_GGUFQuantizeOptions struct {
+		ImportanceMatrix   bool
+		Pure               bool
+		SkipOutputTensor   bool
+		OutputTensorType   *GGMLType
+		TokenEmbeddingType *GGMLType
+	}
+
+	// GGUFQuantizeOption is the option for planning quantization.
+	GGUFQuantizeOption func(o *_GGUFQuantizeOptions)
+)
+
+// WithQuantizeImportanceMatrix plans the quantization with an importance matrix,
+// which is required by the IQ1_S, IQ1_M, IQ2_XXS, IQ2_XS, IQ2_S and Q2_K_S types.
+func WithQuantizeImportanceMatrix() GGUFQuantizeOption {
+	return func(o *_GGUFQuantizeOptions) {
+		o.ImportanceMatrix = true
+	}
+}
+
+// WithQuantizePure plans the quantization without mixing,
+// all quantizable tensors are quantized to the default type of the target file type.
+func WithQuantizePure() GGUFQuantizeOption {
+	return func(o *_GGUFQuantizeOptions) {
+		o.Pure = true
+	}
+}
+
+// WithoutQuantizeOutputTensor plans the quantization with the output tensor left as-is.
+func WithoutQuantizeOutputTensor() GGUFQuantizeOption {
+	return func(o *_GGUFQuantizeOptions) {
+		o.SkipOutputTensor = true
+	}
+}
+
+// WithQuantizeOutputTensorType plans the quantization with the given type for the output tensor.
+func WithQuantizeOutputTensorType(t GGMLType) GGUFQuantizeOption {
+	return func(o *_GGUFQuantizeOptions) {
+		if _, ok := t.Trait(); !ok {
+			return
+		}
+		o.OutputTensorType = &t
+	}
+}
+
+// WithQuantizeTokenEmbeddingType plans the quantization with the given type for the token embedding tensor.
+func WithQuantizeTokenEmbeddingType(t GGMLType) GGUFQuantizeOption {
+	return func(o *_GGUFQuantizeOptions) {
+		if _, ok := t.Trait(); !ok {
+			return
+		}
+		o.TokenEmbeddingType = &t
+	}
+}
+
+// PlanQuantization predicts the result of quantizing the GGUF file to the given file type,
+// and returns a GGUFFile holding the predicted tensor types and sizes, or an error if any.
+//
+// The tensor types are predicted with the mixing rules of llama.cpp quantize,
+// see https://github.com/ggml-org/llama.cpp/blob/master/src/llama-quant.cpp,
+// and the returned GGUFFile can be estimated as usual.
+//
+// The returned GGUFFile is not split, even if the GGUF file is split.
+func (gf *GGUFFile) PlanQuantization(ft GGUFFileType, opts ...GGUFQuantizeOption) (*GGUFFile, error) {
+	var o _GGUFQuantizeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dt, ok := _GGUFQuantizeDefaultTypes[ft]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type %s", ft)
+	}
+
+	qs := _GGUFQuantizeState{
+		FileType:         ft,
+		Arch:             gf.Architecture(),
+		ImportanceMatrix: o.ImportanceMatrix,
+	}
+	for i := range gf.TensorInfos {
+		n := gf.TensorInfos[i].Name
+		switch {
+		case n == "output.weight":
+			qs.HasOutput = true
+		case strings.Contains(n, "attn_v.weight"), strings.Contains(n, "attn_qkv.weight"), strings.Contains(n, "attn_kv_b.weight"):
+			qs.AttentionWVCount++
+		case strings.Contains(n, "ffn_down"):
+			qs.FFNDownCount++
+		case strings.Contains(n, "ffn_gate"):
+			qs.FFNGateCount++
+		case strings.Contains(n, "ffn_up"):
+			qs.FFNUpCount++
+		}
+	}
+
+	pgf := &GGUFFile{
+		Header:      gf.Header,
+		TensorInfos: make(GGUFTensorInfos, len(gf.TensorInfos)),
+	}
+
+	// Metadata.
+	pgf.Header.MetadataKV = make(GGUFMetadataKVs, 0, len(gf.Header.MetadataKV))
+	for _, kv := range gf.Header.MetadataKV {
+		if strings.HasPrefix(kv.Key, "split.") || kv.Key == "general.file_type" {
+			continue
+		}
+		pgf.Header.MetadataKV = append(pgf.Header.MetadataKV, kv)
+	}
+	pgf.Header.MetadataKV = append(pgf.Header.MetadataKV, GGUFMetadataKV{
+		Key:       "general.file_type",
+		ValueType: GGUFMetadataValueTypeUint32,
+		Value:     uint32(ft),
+	})
+	pgf.Header.MetadataKVCount = uint64(len(pgf.Header.MetadataKV))
+
+	// Tensors.
+	var ag uint64 = 32
+	if v, ok := gf.Header.MetadataKV.Get("general.alignment"); ok {
+		ag = uint64(v.ValueUint32())
+	}
+	var offset uint64
+	for i, ti := range gf.TensorInfos {
+		typ, err := qs.TensorType(ti, dt, o)
+		if err != nil {
+			return nil, err
+		}
+		ti.Type = typ
+		ti.Offset = offset
+		pgf.TensorInfos[i] = ti
+		offset += GGMLPadding(ti.Bytes(), ag)
+	}
+
+	// Sizes.
+	pgf.Padding = gf.Padding
+	pgf.TensorDataStartOffset = gf.TensorDataStartOffset
+	if len(gf.SplitTensorDataStartOffsets) != 0 {
+		pgf.Padding = gf.SplitPaddings[0]
+		pgf.TensorDataStartOffset = gf.SplitTensorDataStartOffsets[0]
+	}
+	pgf.ModelSize = GGUFBytesScalar(offset)
+	pgf.Size = GGUFBytesScalar(pgf.TensorDataStartOffset) + pgf.ModelSize
+	pgf.ModelParameters = gf.ModelParameters
+	if pgf.ModelParameters != 0 {
+		pgf.ModelBitsPerWeight = GGUFBitsPerWeightScalar(float64(pgf.ModelSize) * 8 / float64(pgf.ModelParameters))
+	}
+
+	return pgf, nil
+}
+
+// _GGUFQuantizeDefaultTypes maps the GGUFFileType to the default GGMLType of quantizing,
+// see https://github.com/ggml-org/llama.cpp/blob/fd1234cb468935ea087d6929b2487926c3afff4b/src/llama-quant.cpp#L578-L623.
+var _GGUFQuantizeDefaultTypes = map[GGUFFileType]GGMLType{
+	GGUFFileTypeMostlyF32:     GGMLTypeF32,
+	GGUFFileTypeMostlyF16:     GGMLTypeF16,
+	GGUFFileTypeMostlyBF16:    GGMLTypeBF16,
+	GGUFFileTypeMostlyQ4_0:    GGMLTypeQ4_0,
+	GGUFFileTypeMostlyQ4_1:    GGMLTypeQ4_1,
+	GGUFFileTypeMostlyQ5_0:    GGMLTypeQ5_0,
+	GGUFFileTypeMostlyQ5_1:    GGMLTypeQ5_1,
+	GGUFFileTypeMostlyQ8_0:    GGMLTypeQ8_0,
+	GGUFFileTypeMostlyMXFP4:   GGMLTypeMXFP4,
+	GGUFFileTypeMostlyQ2_K:    GGMLTypeQ2_K,
+	GGUFFileTypeMostlyQ2_K_S:  GGMLTypeQ2_K,
+	GGUFFileTypeMostlyQ3_K_S:  GGMLTypeQ3_K,
+	GGUFFileTypeMostlyQ3_K_M:  GGMLTypeQ3_K,
+	GGUFFileTypeMostlyQ3_K_L:  GGMLTypeQ3_K,
+	GGUFFileTypeMostlyQ4_K_S:  GGMLTypeQ4_K,
+	GGUFFileTypeMostlyQ4_K_M:  GGMLTypeQ4_K,
+	GGUFFileTypeMostlyQ5_K_S:  GGMLTypeQ5_K,
+	GGUFFileTypeMostlyQ5_K_M:  GGMLTypeQ5_K,
+	GGUFFileTypeMostlyQ6_K:    GGMLTypeQ6_K,
+	GGUFFileTypeMostlyTQ1_0:   GGMLTypeTQ1_0,
+	GGUFFileTypeMostlyTQ2_0:   GGMLTypeTQ2_0,
+	GGUFFileTypeMostlyIQ2_XXS: GGMLTypeIQ2_XXS,
+	GGUFFileTypeMostlyIQ2_XS:  GGMLTypeIQ2_XS,
+	GGUFFileTypeMostlyIQ2_S:   GGMLTypeIQ2_XS,
+	GGUFFileTypeMostlyIQ2_M:   GGMLTypeIQ2_S,
+	GGUFFileTypeMostlyIQ3_XS:  GGMLTypeIQ3_S,
+	GGUFFileTypeMostlyIQ3_XXS: GGMLTypeIQ3_XXS,
+	GGUFFileTypeMostlyIQ1_S:   GGMLTypeIQ1_S,
+	GGUFFileTypeMostlyIQ1_M:   GGMLTypeIQ1_M,
+	GGUFFileTypeMostlyIQ4_NL:  GGMLTypeIQ4_NL,
+	GGUFFileTypeMostlyIQ4_XS:  GGMLTypeIQ4_XS,
+	GGUFFileTypeMostlyIQ3_S:   GGMLTypeIQ3_S,
+	GGUFFileTypeMostlyIQ3_M:   GGMLTypeIQ3_S,
+}
+
+// _GGUFQuantizeSkipTensorRegex matches the tensors that are never quantized,
+// see https://github.com/ggml-org/llama.cpp/blob/fd1234cb468935ea087d6929b2487926c3afff4b/src/llama-quant.cpp#L823-L858.
+var _GGUFQuantizeSkipTensorRegex = regexp.MustCompile(`_norm\.weight|ffn_gate_inp\.weight|^pos_embd\.weight$|^token_types\.weight$|` +
+	`ssm_conv1d\.weight|shortconv\.conv\.weight|time_mix_(first|w0|w1|w2|v0|v1|v2|a0|a1|a2|g1|g2|decay_w1|decay_w2|lerp_fused)\.weight|` +
+	`attn_rel_b\.weight|\.position_embd\.`)
+
+// _GGUFQuantizeState holds the state of planning quantization,
+// which is inspired by the quantize_state_impl of llama.cpp.
+type _GGUFQuantizeState struct {
+	FileType         GGUFFileType
+	Arch             GGUFArchitecture
+	ImportanceMatrix bool
+	HasOutput        bool
+
+	AttentionWVCount, AttentionWVIndex int
+	FFNDownCount, FFNDownIndex         int
+	FFNGateCount, FFNGateIndex         int
+	FFNUpCount, FFNUpIndex             int
+}
+
+// TensorType returns the predicted type of the given tensor,
+// the tensors must be given in file order.
+func (qs *_GGUFQuantizeState) TensorType(ti GGUFTensorInfo, dt GGMLType, o _GGUFQuantizeOptions) (GGMLType, error) {
+	n := ti.Name
+	if !strings.HasSuffix(n, "weight") || ti.NDimensions < 2 || _GGUFQuantizeSkipTensorRegex.MatchString(n) ||
+		(o.SkipOutputTensor && n == "output.weight") {
+		return ti.Type, nil
+	}
+
+	typ := dt
+	if !o.Pure && dt.IsQuantized() {
+		typ = qs.mixTensorType(ti, dt, o)
+	}
+	// NB(thxCode): Fallback if the row size is incompatible with the block size.
+	if tt, _ := typ.Trait(); ti.Dimensions[0]%tt.BlockSize != 0 {
+		switch typ {
+		case GGMLTypeTQ1_0, GGMLTypeTQ2_0:
+			typ = GGMLTypeQ4_0
+		case GGMLTypeIQ2_XXS, GGMLTypeIQ2_XS, GGMLTypeIQ2_S, GGMLTypeIQ3_XXS, GGMLTypeIQ3_S,
+			GGMLTypeIQ1_S, GGMLTypeIQ1_M, GGMLTypeQ2_K, GGMLTypeQ3_K, GGMLTypeIQ4_XS:
+			typ = GGMLTypeIQ4_NL
+		case GGMLTypeQ4_K:
+			typ = GGMLTypeQ5_0
+		case GGMLTypeQ5_K:
+			typ = GGMLTypeQ5_1
+		case GGMLTypeQ6_K:
+			typ = GGMLTypeQ8_0
+		}
+		if tt, _ = typ.Trait(); ti.Dimensions[0]%tt.BlockSize != 0 {
+			typ = GGMLTypeF16
+		}
+	}
+	if o.TokenEmbeddingType != nil && n == "token_embd.weight" {
+		typ = *o.TokenEmbeddingType
+	}
+	if o.OutputTensorType != nil && n == "output.weight" {
+		typ = *o.OutputTensorType
+	}
+
+	if !o.ImportanceMatrix {
+		switch {
+		case typ == GGMLTypeIQ2_XXS, typ == GGMLTypeIQ2_XS, typ == GGMLTypeIQ2_S, typ == GGMLTypeIQ1_S,
+			typ == GGMLTypeIQ1_M && n != "token_embd.weight" && n != "output.weight",
+			typ == GGMLTypeQ2_K && qs.FileType == GGUFFileTypeMostlyQ2_K_S && n != "token_embd.weight":
+			return typ, fmt.Errorf("quantize %s to %s: %w", n, typ, ErrGGUFQuantizeImportanceMatrixRequired)
+		}
+	}
+	return typ, nil
+}
+
+// mixTensorType returns the type of the given tensor with the mixing rules,
+// see https://github.com/ggml-org/llama.cpp/blob/fd1234cb468935ea087d6929b2487926c3afff4b/src/llama-quant.cpp#L130-L440.
+func (qs *_GGUFQuantizeState) mixTensorType(ti GGUFTensorInfo, typ GGMLType, o _GGUFQuantizeOptions) GGMLType {
+	var (
+		n       = ti.Name
+		ft      = qs.FileType
+		falcon  = qs.Arch.Architecture == "falcon"
+		experts = qs.Arch.ExpertCount
+		gqa     uint64
+	)
+	if qs.Arch.AttentionHeadCountKV != 0 {
+		gqa = qs.Arch.AttentionHeadCount / qs.Arch.AttentionHeadCountKV
+	}
+	useMoreBits := func(i, n int) bool {
+		return i < n/8 || i >= 7*n/8 || (i-n/8)%3 == 2
+	}
+	// NB(thxCode): The experts may not be in layer order,
+	// so we parse the layer index from the name for MoE models.
+	layerInfo := func(i, n int, name string) (int, int) {
+		if experts > 1 {
+			if _, err := fmt.Sscanf(name, "blk.%d.", &i); err == nil {
+				return i, int(qs.Arch.BlockCount)
+			}
+		}
+		return i, n
+	}
+	isAny := func(fts ...GGUFFileType) bool {
+		for i := range fts {
+			if ft == fts[i] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case n == "output.weight" || (!qs.HasOutput && n == "token_embd.weight"):
+		if o.OutputTensorType != nil {
+			typ = *o.OutputTensorType
+			break
+		}
+		tt, _ := typ.Trait()
+		switch {
+		case ft == GGUFFileTypeMostlyMXFP4:
+			typ = GGMLTypeQ8_0
+		case falcon || ti.Dimensions[0]%tt.BlockSize != 0:
+			typ = GGMLTypeQ8_0
+		case isAny(GGUFFileTypeMostlyIQ2_XXS, GGUFFileTypeMostlyIQ2_XS, GGUFFileTypeMostlyIQ3_XXS,
+			GGUFFileTypeMostlyIQ1_S, GGUFFileTypeMostlyIQ2_S, GGUFFileTypeMostlyIQ2_M, GGUFFileTypeMostlyIQ1_M):
+			typ = GGMLTypeQ5_K
+		case typ != GGMLTypeQ8_0:
+			typ = GGMLTypeQ6_K
+		}
+	case ft == GGUFFileTypeMostlyMXFP4:
+		// MoE tensors to MXFP4, others to Q8_0.
+		if len(ti.Dimensions) > 2 && ti.Dimensions[2] > 1 {
+			typ = GGMLTypeMXFP4
+		} else {
+			typ = GGMLTypeQ8_0
+		}
+	case n == "token_embd.weight" || n == "per_layer_token_embd.weight":
+		if o.TokenEmbeddingType != nil {
+			typ = *o.TokenEmbeddingType
+			break
+		}
+		switch {
+		case isAny(GGUFFileTypeMostlyIQ2_XXS, GGUFFileTypeMostlyIQ2_XS, GGUFFileTypeMostlyIQ1_S, GGUFFileTypeMostlyIQ1_M):
+			typ = GGMLTypeQ2_K
+		case isAny(GGUFFileTypeMostlyIQ2_S, GGUFFileTypeMostlyIQ2_M, GGUFFileTypeMostlyIQ3_XXS):
+			typ = GGMLTypeIQ3_S
+		case isAny(GGUFFileTypeMostlyTQ1_0, GGUFFileTypeMostlyTQ2_0):
+			typ = GGMLTypeQ4_K
+		}
+	case isAny(GGUFFileTypeMostlyIQ2_XXS, GGUFFileTypeMostlyIQ2_XS, GGUFFileTypeMostlyIQ1_S,
+		GGUFFileTypeMostlyIQ2_S, GGUFFileTypeMostlyIQ2_M, GGUFFileTypeMostlyIQ1_M):
+		iq2sm := isAny(GGUFFileTypeMostlyIQ2_S, GGUFFileTypeMostlyIQ2_M)
+		switch {
+		case strings.Contains(n, "attn_v.weight"):
+			switch {
+			case gqa >= 4 || experts >= 4:
+				typ = GGMLTypeQ4_K
+			case iq2sm:
+				typ = GGMLTypeIQ3_S
+			default:
+				typ = GGMLTypeQ2_K
+			}
+			qs.AttentionWVIndex++
+		case experts == 8 && strings.Contains(n, "attn_k.weight"):
+			typ = GGMLTypeQ4_K
+		case strings.Contains(n, "ffn_down"):
+			if qs.FFNDownIndex < qs.FFNDownCount/8 {
+				if iq2sm {
+					typ = GGMLTypeIQ3_S
+				} else {
+					typ = GGMLTypeQ2_K
+				}
+			}
+			qs.FFNDownIndex++
+		case strings.Contains(n, "attn_output.weight"):
+			switch {
+			case experts == 8:
+				typ = GGMLTypeQ5_K
+			case isAny(GGUFFileTypeMostlyIQ1_S, GGUFFileTypeMostlyIQ1_M):
+				typ = GGMLTypeIQ2_XXS
+			case iq2sm:
+				typ = GGMLTypeIQ3_S
+			}
+		}
+	case strings.Contains(n, "attn_v.weight"):
+		switch {
+		case ft == GGUFFileTypeMostlyQ2_K:
+			typ = GGMLTypeQ3_K
+			if gqa >= 4 {
+				typ = GGMLTypeQ4_K
+			}
+		case ft == GGUFFileTypeMostlyQ2_K_S && gqa >= 4:
+			typ = GGMLTypeQ4_K
+		case ft == GGUFFileTypeMostlyIQ3_XXS:
+			switch {
+			case gqa >= 4:
+				typ = GGMLTypeQ4_K
+			case !qs.ImportanceMatrix:
+				typ = GGMLTypeIQ3_S
+			default:
+				typ = GGMLTypeIQ3_XXS
+			}
+		case isAny(GGUFFileTypeMostlyIQ3_XS, GGUFFileTypeMostlyIQ3_S) && gqa >= 4:
+			typ = GGMLTypeQ4_K
+		case ft == GGUFFileTypeMostlyIQ3_M:
+			typ = GGMLTypeQ4_K
+		case ft == GGUFFileTypeMostlyQ3_K_M:
+			typ = GGMLTypeQ4_K
+			if qs.AttentionWVIndex < 2 {
+				typ = GGMLTypeQ5_K
+			}
+		case ft == GGUFFileTypeMostlyQ3_K_L:
+			typ = GGMLTypeQ5_K
+		case isAny(GGUFFileTypeMostlyIQ4_NL, GGUFFileTypeMostlyIQ4_XS) && gqa >= 4:
+			typ = GGMLTypeQ5_K
+		case isAny(GGUFFileTypeMostlyQ4_K_M, GGUFFileTypeMostlyQ5_K_M) && useMoreBits(qs.AttentionWVIndex, qs.AttentionWVCount):
+			typ = GGMLTypeQ6_K
+		case ft == GGUFFileTypeMostlyQ4_K_S && qs.AttentionWVIndex < 4:
+			typ = GGMLTypeQ5_K
+		}
+		// NB(thxCode): The 70B LLaMA model shares the attn_v among 8 heads,
+		// which is bumped with more bits.
+		if qs.Arch.Architecture == "llama" && qs.Arch.BlockCount == 80 && gqa == 8 &&
+			(typ == GGMLTypeQ3_K || typ == GGMLTypeQ4_K) {
+			typ = GGMLTypeQ5_K
+		}
+		if experts == 8 {
+			typ = GGMLTypeQ8_0
+		}
+		qs.AttentionWVIndex++
+	case strings.Contains(n, "attn_k.weight"):
+		switch {
+		case experts == 8:
+			typ = GGMLTypeQ8_0
+		case ft == GGUFFileTypeMostlyIQ3_XS:
+			typ = GGMLTypeIQ3_XXS
+		case ft == GGUFFileTypeMostlyIQ3_XXS:
+			typ = GGMLTypeIQ2_S
+		}
+	case strings.Contains(n, "attn_q.weight"):
+		switch ft {
+		case GGUFFileTypeMostlyIQ3_XS:
+			typ = GGMLTypeIQ3_XXS
+		case GGUFFileTypeMostlyIQ3_XXS:
+			typ = GGMLTypeIQ2_S
+		}
+	case strings.Contains(n, "ffn_down"):
+		i, l := layerInfo(qs.FFNDownIndex, qs.FFNDownCount, n)
+		switch {
+		case ft == GGUFFileTypeMostlyQ2_K:
+			typ = GGMLTypeQ3_K
+		case ft == GGUFFileTypeMostlyQ2_K_S:
+			if i < l/8 {
+				typ = GGMLTypeQ4_K
+			}
+		case ft == GGUFFileTypeMostlyIQ3_XXS && !qs.ImportanceMatrix:
+			typ = GGMLTypeQ3_K
+			if i < l/8 {
+				typ = GGMLTypeQ4_K
+			}
+		case ft == GGUFFileTypeMostlyQ3_K_M:
+			switch {
+			case i < l/16:
+				typ = GGMLTypeQ5_K
+			case !falcon || useMoreBits(i, l):
+				typ = GGMLTypeQ4_K
+			default:
+				typ = GGMLTypeQ3_K
+			}
+		case ft == GGUFFileTypeMostlyIQ3_M && (i < l/8 || (experts == 8 && useMoreBits(i, l))):
+			typ = GGMLTypeQ4_K
+		case ft == GGUFFileTypeMostlyQ3_K_L:
+			typ = GGMLTypeQ5_K
+			if falcon {
+				typ = GGMLTypeQ4_K
+			}
+		case ft == GGUFFileTypeMostlyQ4_K_M:
+			switch {
+			case !falcon:
+				if useMoreBits(i, l) {
+					typ = GGMLTypeQ6_K
+				}
+			case i < l/16:
+				typ = GGMLTypeQ6_K
+			case useMoreBits(i, l):
+				typ = GGMLTypeQ5_K
+			}
+		case i < l/8 && isAny(GGUFFileTypeMostlyIQ4_NL, GGUFFileTypeMostlyIQ4_XS) && !qs.ImportanceMatrix:
+			typ = GGMLTypeQ5_K
+		case ft == GGUFFileTypeMostlyQ5_K_M && useMoreBits(i, l):
+			typ = GGMLTypeQ6_K
+		case ft == GGUFFileTypeMostlyQ4_K_S && !falcon && i < l/8:
+			typ = GGMLTypeQ5_K
+		case isAny(GGUFFileTypeMostlyQ4_0, GGUFFileTypeMostlyQ5_0) && qs.ImportanceMatrix && i < l/8:
+			typ = GGMLTypeQ4_1
+			if ft == GGUFFileTypeMostlyQ5_0 {
+				typ = GGMLTypeQ5_1
+			}
+		}
+		qs.FFNDownIndex++
+	case strings.Contains(n, "attn_output.weight"):
+		switch {
+		case falcon:
+			if ft == GGUFFileTypeMostlyQ3_K_L {
+				typ = GGMLTypeQ4_K
+			}
+		case experts == 8:
+			if isAny(GGUFFileTypeMostlyQ2_K, GGUFFileTypeMostlyIQ3_XS, GGUFFileTypeMostlyIQ3_XXS,
+				GGUFFileTypeMostlyQ3_K_S, GGUFFileTypeMostlyQ3_K_M, GGUFFileTypeMostlyIQ4_NL,
+				GGUFFileTypeMostlyQ4_K_S, GGUFFileTypeMostlyQ4_K_M, GGUFFileTypeMostlyIQ3_S,
+				GGUFFileTypeMostlyIQ3_M, GGUFFileTypeMostlyIQ4_XS) {
+				typ = GGMLTypeQ5_K
+			}
+		default:
+			switch ft {
+			case GGUFFileTypeMostlyQ2_K:
+				typ = GGMLTypeQ3_K
+			case GGUFFileTypeMostlyIQ3_XXS:
+				typ = GGMLTypeIQ3_S
+			case GGUFFileTypeMostlyQ3_K_M, GGUFFileTypeMostlyIQ3_M:
+				typ = GGMLTypeQ4_K
+			case GGUFFileTypeMostlyQ3_K_L:
+				typ = GGMLTypeQ5_K
+			}
+		}
+	case strings.Contains(n, "attn_qkv.weight"):
+		switch ft {
+		case GGUFFileTypeMostlyQ3_K_M, GGUFFileTypeMostlyQ3_K_L, GGUFFileTypeMostlyIQ3_M:
+			typ = GGMLTypeQ4_K
+		case GGUFFileTypeMostlyQ4_K_M:
+			typ = GGMLTypeQ5_K
+		case GGUFFileTypeMostlyQ5_K_M:
+			typ = GGMLTypeQ6_K
+		}
+	case strings.Contains(n, "ffn_gate"):
+		i, l := layerInfo(qs.FFNGateIndex, qs.FFNGateCount, n)
+		if ft == GGUFFileTypeMostlyIQ3_XS && i >= l/8 && i < 7*l/8 {
+			typ = GGMLTypeIQ3_XXS
+		}
+		qs.FFNGateIndex++
+	case strings.Contains(n, "ffn_up"):
+		i, l := layerInfo(qs.FFNUpIndex, qs.FFNUpCount, n)
+		if ft == GGUFFileTypeMostlyIQ3_XS && i >= l/8 && i < 7*l/8 {
+			typ = GGMLTypeIQ3_XXS
+		}
+		qs.FFNUpIndex++
+	}
+
+	return typ
+}
+
+// Types for reporting quantization.
+type (
+	// GGUFQuantizationReport represents the quantization mix of the GGUF file.
+	GGUFQuantizationReport struct {
+		// FileType is the type of the GGUF file.
+		FileType GGUFFileType `json:"fileType"`
+		// FileTypeDescriptor is the descriptor of the file type.
+		FileTypeDescriptor string `json:"fileTypeDescriptor"`
+		// Groups is the tensor groups by role,
+		// in the order of token embeddings, attention, feed-forward, experts, norms, output and others.
+		Groups []GGUFQuantizationReportGroup `json:"groups"`
+		// Warnings is the unusual mixes found in the GGUF file.
+		Warnings []string `json:"warnings,omitempty"`
+	}
+
+	// GGUFQuantizationReportGroup represents the quantization mix of a tensor group.
+	GGUFQuantizationReportGroup struct {
+		// Role is the role of the tensors,
+		// e.g. "embeddings", "attn_q", "ffn_down", "experts", "norms" or "output".
+		Role string `json:"role"`
+		// Count is the number of the tensors.
+		Count uint64 `json:"count"`
+		// Types is the histogram of the tensor types,
+		// in descending order of bytes.
+		Types []GGUFQuantizationReportType `json:"types"`
+		// Bytes is the size of the tensors.
+		Bytes GGUFBytesScalar `json:"bytes"`
+		// Parameters is the number of the tensor elements.
+		Parameters GGUFParametersScalar `json:"parameters"`
+		// BitsPerWeight is the effective bits per weight of the tensors.
+		BitsPerWeight GGUFBitsPerWeightScalar `json:"bitsPerWeight"`
+	}
+
+	// GGUFQuantizationReportType represents a tensor type of a tensor group.
+	GGUFQuantizationReportType struct {
+		// Type is the tensor type.
+		Type GGMLType `json:"type"`
+		// Count is the number of the tensors in this type.
+		Count uint64 `json:"count"`
+		// Bytes is the size of the tensors in this type.
+		Bytes GGUFBytesScalar `json:"bytes"`
+	}
+)
+
+// _GGUFQuantizationReportRoles holds the roles of the quantization report in order,
+// the first matched role is used.
+var _GGUFQuantizationReportRoles = []struct {
+	Role  string
+	Match func(name string) bool
+}{
+	{"embeddings", func(n string) bool {
+		return strings.HasPrefix(n, "token_embd.") || strings.HasPrefix(n, "per_layer_token_embd.") ||
+			strings.HasPrefix(n, "pos_embd.") || strings.HasPrefix(n, "token_types.")
+	}},
+	{"norms", func(n string) bool { return strings.Contains(n, "norm") }},
+	{"experts", func(n string) bool { return strings.Contains(n, "_exps") }},
+	{"attn_qkv", func(n string) bool { return strings.Contains(n, ".attn_qkv.") }},
+	{"attn_q", func(n string) bool {
+		return strings.Contains(n, ".attn_q.") || strings.Contains(n, ".attn_q_a.") || strings.Contains(n, ".attn_q_b.")
+	}},
+	{"attn_k", func(n string) bool {
+		return strings.Contains(n, ".attn_k.") || strings.Contains(n, ".attn_kv_a_mqa.") || strings.Contains(n, ".attn_k_b.")
+	}},
+	{"attn_v", func(n string) bool {
+		return strings.Contains(n, ".attn_v.") || strings.Contains(n, ".attn_kv_b.") || strings.Contains(n, ".attn_v_b.")
+	}},
+	{"attn_o", func(n string) bool { return strings.Contains(n, ".attn_output.") }},
+	{"ffn_gate", func(n string) bool { return strings.Contains(n, ".ffn_gate") && !strings.Contains(n, "_inp") }},
+	{"ffn_up", func(n string) bool { return strings.Contains(n, ".ffn_up") }},
+	{"ffn_down", func(n string) bool { return strings.Contains(n, ".ffn_down") }},
+	{"output", func(n string) bool { return strings.HasPrefix(n, "output.") }},
+}
+
+// QuantizationReport returns the quantization mix of the GGUF file grouped by tensor role,
+// and flags the unusual mixes, e.g. a low-bit output head.
+func (gf *GGUFFile) QuantizationReport() (gr GGUFQuantizationReport) {
+	m := gf.Metadata()
+	gr.FileType, gr.FileTypeDescriptor = m.FileType, m.FileTypeDescriptor
+
+	gs := make(map[string]*GGUFQuantizationReportGroup)
+	for _, ti := range gf.TensorInfos {
+		role := "others"
+		for _, r := range _GGUFQuantizationReportRoles {
+			if r.Match(ti.Name) {
+				role = r.Role
+				break
+			}
+		}
+		g, ok := gs[role]
+		if !ok {
+			g = &GGUFQuantizationReportGroup{Role: role}
+			gs[role] = g
+		}
+		g.Count++
+		g.Bytes += GGUFBytesScalar(ti.Bytes())
+		g.Parameters += GGUFParametersScalar(ti.Elements())
+		var found bool
+		for i := range g.Types {
+			if g.Types[i].Type == ti.Type {
+				g.Types[i].Count++
+				g.Types[i].Bytes += GGUFBytesScalar(ti.Bytes())
+				found = true
+				break
+			}
+		}
+		if !found {
+			g.Types = append(g.Types, GGUFQuantizationReportType{Type: ti.Type, Count: 1, Bytes: GGUFBytesScalar(ti.Bytes())})
+		}
+	}
+
+	roles := []string{"embeddings", "attn_qkv", "attn_q", "attn_k", "attn_v", "attn_o", "ffn_gate", "ffn_up", "ffn_down", "experts", "norms", "output", "others"}
+	for _, role := range roles {
+		g, ok := gs[role]
+		if !ok {
+			continue
+		}
+		if g.Parameters != 0 {
+			g.BitsPerWeight = GGUFBitsPerWeightScalar(float64(g.Bytes) * 8 / float64(g.Parameters))
+		}
+		sort.SliceStable(g.Types, func(i, j int) bool {
+			return g.Types[i].Bytes > g.Types[j].Bytes
+		})
+		gr.Groups = append(gr.Groups, *g)
+	}
+
+	// Flag unusual mixes.
+	typeBPW := func(t GGMLType) float64 {
+		tt, ok := t.Trait()
+		if !ok || tt.BlockSize == 0 {
+			return 0
+		}
+		return float64(tt.TypeSize*8) / float64(tt.BlockSize)
+	}
+	if g, ok := gs["output"]; ok {
+		for _, t := range g.Types {
+			if bpw := typeBPW(t.Type); bpw < 4.5 {
+				gr.Warnings = append(gr.Warnings,
+					fmt.Sprintf("output head is quantized to %s (%.2f bpw), which usually hurts quality noticeably", t.Type, bpw))
+			}
+		}
+	}
+	if g, ok := gs["embeddings"]; ok {
+		for _, t := range g.Types {
+			if bpw := typeBPW(t.Type); bpw < 2.5 {
+				gr.Warnings = append(gr.Warnings,
+					fmt.Sprintf("token embeddings are quantized to %s (%.2f bpw)", t.Type, bpw))
+			}
+		}
+	}
+	if g, ok := gs["norms"]; ok {
+		for _, t := range g.Types {
+			if t.Type.IsQuantized() {
+				gr.Warnings = append(gr.Warnings,
+					fmt.Sprintf("%d norm tensor(s) are quantized to %s, which are usually kept in F32", t.Count, t.Type))
+			}
+		}
+	}
+	// NB(thxCode): The quantize of llama.cpp bumps the attn_v and ffn_down with more bits,
+	// so it is unusual to see them in fewer bits than their siblings.
+	for _, p := range [][2]string{{"attn_v", "attn_q"}, {"ffn_down", "ffn_up"}} {
+		lo, lok := gs[p[0]]
+		hi, hok := gs[p[1]]
+		if lok && hok && lo.BitsPerWeight+0.5 < hi.BitsPerWeight {
+			gr.Warnings = append(gr.Warnings,
+				fmt.Sprintf("%s is quantized with fewer bits (%s) than %s (%s)", p[0], lo.BitsPerWeight, p[1], hi.BitsPerWeight))
+		}
+	}
+	if g, ok := gs["ffn_down"]; ok && len(g.Types) > 3 {
+		gr.Warnings = append(gr.Warnings,
+			fmt.Sprintf("ffn_down mixes %d tensor types", len(g.Types)))
+	}
+
+	return gr
+}
@@ -0,0 +1,167 @@
+package gguf_parser
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testQuantizeGGUFFile returns a F16 LLaMA GGUF file with the given number of layers.
+func testQuantizeGGUFFile(layers int) *GGUFFile {
+	gf := &GGUFFile{}
+	gf.Header.MetadataKV = GGUFMetadataKVs{
+		{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+		{Key: "general.file_type", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(GGUFFileTypeMostlyF16)},
+		{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(layers)},
+		{Key: "llama.embedding_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(512)},
+		{Key: "llama.feed_forward_length", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1536)},
+		{Key: "llama.attention.head_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(8)},
+		{Key: "llama.attention.head_count_kv", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(2)},
+		{Key: "llama.vocab_size", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(1024)},
+	}
+	add := func(n string, typ GGMLType, dims ...uint64) {
+		gf.TensorInfos = append(gf.TensorInfos, GGUFTensorInfo{
+			Name:        n,
+			NDimensions: uint32(len(dims)),
+			Dimensions:  dims,
+			Type:        typ,
+		})
+	}
+	add("token_embd.weight", GGMLTypeF16, 512, 1024)
+	for i := 0; i < layers; i++ {
+		p := fmt.Sprintf("blk.%d.", i)
+		add(p+"attn_norm.weight", GGMLTypeF32, 512)
+		add(p+"attn_q.weight", GGMLTypeF16, 512, 512)
+		add(p+"attn_k.weight", GGMLTypeF16, 512, 128)
+		add(p+"attn_v.weight", GGMLTypeF16, 512, 128)
+		add(p+"attn_output.weight", GGMLTypeF16, 512, 512)
+		add(p+"ffn_norm.weight", GGMLTypeF32, 512)
+		add(p+"ffn_gate.weight", GGMLTypeF16, 512, 1536)
+		add(p+"ffn_up.weight", GGMLTypeF16, 512, 1536)
+		add(p+"ffn_down.weight", GGMLTypeF16, 1536, 512)
+	}
+	add("output_norm.weight", GGMLTypeF32, 512)
+	add("output.weight", GGMLTypeF16, 512, 1024)
+	gf.Header.TensorCount = uint64(len(gf.TensorInfos))
+	gf.ModelSize = GGUFBytesScalar(gf.TensorInfos.Bytes())
+	gf.ModelParameters = GGUFParametersScalar(gf.TensorInfos.Elements())
+	return gf
+}
+
+func TestGGUFFile_PlanQuantization(t *testing.T) {
+	gf := testQuantizeGGUFFile(16)
+
+	t.Run("Q4_K_M", func(t *testing.T) {
+		pgf, err := gf.PlanQuantization(GGUFFileTypeMostlyQ4_K_M)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]GGMLType{
+			"token_embd.weight":      GGMLTypeQ4_K,
+			"output.weight":          GGMLTypeQ6_K,
+			"output_norm.weight":     GGMLTypeF32,
+			"blk.0.attn_q.weight":    GGMLTypeQ4_K,
+			"blk.0.attn_v.weight":    GGMLTypeQ6_K, // Use more bits at the first 1/8 layers.
+			"blk.3.attn_v.weight":    GGMLTypeQ4_K,
+			"blk.4.attn_v.weight":    GGMLTypeQ6_K, // Use more bits at every 3rd layer.
+			"blk.15.ffn_down.weight": GGMLTypeQ6_K, // Use more bits at the last 1/8 layers.
+			"blk.5.ffn_down.weight":  GGMLTypeQ4_K,
+			"blk.5.ffn_up.weight":    GGMLTypeQ4_K,
+		}
+		for n, typ := range expected {
+			ti, ok := pgf.TensorInfos.Get(n)
+			if !ok {
+				t.Fatalf("expected tensor %s", n)
+			}
+			if ti.Type != typ {
+				t.Errorf("%s: expected %s, got %s", n, typ, ti.Type)
+			}
+		}
+		if bpw := float64(pgf.ModelBitsPerWeight); bpw < 4.5 || bpw > 5.5 {
+			t.Errorf("expected BPW within [4.5, 5.5], got %v", bpw)
+		}
+		if ft := pgf.Metadata().FileType; ft != GGUFFileTypeMostlyQ4_K_M {
+			t.Errorf("expected file type %s, got %s", GGUFFileTypeMostlyQ4_K_M, ft)
+		}
+
+		src := gf.EstimateLLaMACppRun().SummarizeItem(false, 0, 0)
+		dst := pgf.EstimateLLaMACppRun().SummarizeItem(false, 0, 0)
+		if dst.VRAMs[0].NonUMA >= src.VRAMs[0].NonUMA {
+			t.Errorf("expected smaller estimate, got %s >= %s", dst.VRAMs[0].NonUMA, src.VRAMs[0].NonUMA)
+		}
+	})
+
+	t.Run("pure", func(t *testing.T) {
+		pgf, err := gf.PlanQuantization(GGUFFileTypeMostlyQ4_K_M, WithQuantizePure())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ti := range pgf.TensorInfos {
+			if ti.NDimensions > 1 && ti.Type != GGMLTypeQ4_K {
+				t.Errorf("%s: expected %s, got %s", ti.Name, GGMLTypeQ4_K, ti.Type)
+			}
+		}
+	})
+
+	t.Run("imatrix required", func(t *testing.T) {
+		_, err := gf.PlanQuantization(GGUFFileTypeMostlyIQ2_XXS)
+		if !errors.Is(err, ErrGGUFQuantizeImportanceMatrixRequired) {
+			t.Fatalf("expected ErrGGUFQuantizeImportanceMatrixRequired, got %v", err)
+		}
+		if _, err = gf.PlanQuantization(GGUFFileTypeMostlyIQ2_XXS, WithQuantizeImportanceMatrix()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("incompatible row size", func(t *testing.T) {
+		odd := testQuantizeGGUFFile(1)
+		odd.TensorInfos = append(odd.TensorInfos, GGUFTensorInfo{
+			Name: "blk.0.ffn_up.weight", NDimensions: 2, Dimensions: []uint64{96, 64}, Type: GGMLTypeF16,
+		})
+		pgf, err := odd.PlanQuantization(GGUFFileTypeMostlyQ4_K_S)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := pgf.TensorInfos[len(pgf.TensorInfos)-1].Type; typ != GGMLTypeQ5_0 {
+			t.Errorf("expected %s, got %s", GGMLTypeQ5_0, typ)
+		}
+	})
+}
+
+func TestGGUFFile_QuantizationReport(t *testing.T) {
+	gf, err := testQuantizeGGUFFile(16).PlanQuantization(GGUFFileTypeMostlyQ4_K_M)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gr := gf.QuantizationReport()
+	if gr.FileType != GGUFFileTypeMostlyQ4_K_M {
+		t.Errorf("expected file type %s, got %s", GGUFFileTypeMostlyQ4_K_M, gr.FileType)
+	}
+	gs := make(map[string]GGUFQuantizationReportGroup)
+	for _, g := range gr.Groups {
+		gs[g.Role] = g
+	}
+	if g := gs["attn_v"]; g.Count != 16 || len(g.Types) != 2 {
+		t.Errorf("expected 16 attn_v tensors in Q6_K and Q4_K, got %+v", g)
+	}
+	if g := gs["norms"]; g.Count != 33 || g.BitsPerWeight != 32 {
+		t.Errorf("expected 33 norm tensors in 32 bpw, got %+v", g)
+	}
+	if len(gr.Warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", gr.Warnings)
+	}
+
+	// Unusual mixes.
+	for i := range gf.TensorInfos {
+		switch gf.TensorInfos[i].Name {
+		case "output.weight":
+			gf.TensorInfos[i].Type = GGMLTypeQ2_K
+		case "blk.0.attn_norm.weight":
+			gf.TensorInfos[i].Type = GGMLTypeQ8_0
+		}
+	}
+	if gr = gf.QuantizationReport(); len(gr.Warnings) != 2 {
+		t.Errorf("expected 2 warnings, got %v", gr.Warnings)
+	}
+}
@@ -0,0 +1,465 @@
+package gguf_parser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/gpustack/gguf-parser-go/util/anyx"
+	"github.com/gpustack/gguf-parser-go/util/osx"
+)
+
+// Types for splitting and merging GGUF file.
+type (
+	_GGUFSplitOptions struct {
+		MaxSize    uint64
+		MaxTensors uint64
+	}
+
+	// GGUFSplitOption is the option for splitting the file.
+	GGUFSplitOption func(o *_GGUFSplitOptions)
+)
+
+// WithSplitMaxSize splits the file by the given maximum size in bytes of each shard,
+// it takes precedence over WithSplitMaxTensors.
+func WithSplitMaxSize(size uint64) GGUFSplitOption {
+	return func(o *_GGUFSplitOptions) {
+		if size == 0 {
+			return
+		}
+		o.MaxSize = size
+	}
+}
+
+// WithSplitMaxTensors splits the file by the given maximum number of tensors of each shard,
+// default is 128.
+func WithSplitMaxTensors(n uint64) GGUFSplitOption {
+	return func(o *_GGUFSplitOptions) {
+		if n == 0 {
+			return
+		}
+		o.MaxTensors = n
+	}
+}
+
+// SplitGGUFFile splits the GGUF file of the given path into shards,
+// which named as "<outputPrefix>-<shard>-of-<total>.gguf",
+// and returns the paths of the shards, or an error if any,
+// see https://github.com/ggml-org/llama.cpp/tree/master/tools/gguf-split.
+//
+// The given path can be a shard of a split GGUF file,
+// in which case the whole split GGUF file is resplit.
+//
+// The first shard holds all metadata,
+// and the rest shards only hold the split.* metadata.
+func SplitGGUFFile(path, outputPrefix string, opts ...GGUFSplitOption) (_ []string, err error) {
+	o := _GGUFSplitOptions{
+		MaxTensors: 128,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	src, err := openGGUFFileSplitSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// Plan.
+	var plans [][]_GGUFSplitTensor
+	{
+		var (
+			cur     []_GGUFSplitTensor
+			curSize uint64
+		)
+		for i := range src.Tensors {
+			n := GGMLPadding(src.Tensors[i].Size, src.Alignment)
+			if len(cur) > 0 {
+				if (o.MaxSize > 0 && curSize+n > o.MaxSize) ||
+					(o.MaxSize == 0 && uint64(len(cur)) >= o.MaxTensors) {
+					plans = append(plans, cur)
+					cur, curSize = nil, 0
+				}
+			}
+			cur = append(cur, src.Tensors[i])
+			curSize += n
+		}
+		if len(cur) > 0 || len(plans) == 0 {
+			plans = append(plans, cur)
+		}
+	}
+	if len(plans) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many shards: %d", len(plans))
+	}
+
+	// Write.
+	paths := make([]string, len(plans))
+	defer func() {
+		if err != nil {
+			for i := range paths {
+				if paths[i] != "" {
+					_ = os.Remove(paths[i])
+				}
+			}
+		}
+	}()
+	for i := range plans {
+		kvs := GGUFMetadataKVs{
+			{Key: "split.no", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(i)},
+			{Key: "split.count", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(len(plans))},
+			{Key: "split.tensors.count", ValueType: GGUFMetadataValueTypeInt32, Value: int32(len(src.Tensors))},
+		}
+		if i == 0 {
+			kvs = append(kvs, src.MetadataKV...)
+		}
+
+		paths[i] = fmt.Sprintf("%s-%05d-of-%05d.gguf", outputPrefix, i+1, len(plans))
+		if err = writeGGUFFile(paths[i], src.Magic, src.ByteOrder, src.Alignment, kvs, plans[i]); err != nil {
+			return nil, fmt.Errorf("write shard %q: %w", paths[i], err)
+		}
+	}
+
+	return paths, nil
+}
+
+// MergeGGUFFile merges the shards of the split GGUF file of the given path into a single GGUF file,
+// and returns an error if any,
+// see https://github.com/ggml-org/llama.cpp/tree/master/tools/gguf-split.
+//
+// The given path must be one of the shards,
+// the split.* metadata are dropped from the output.
+func MergeGGUFFile(path, output string) (err error) {
+	if !IsShardGGUFFilename(path) {
+		return fmt.Errorf("%q is not a shard GGUF file", path)
+	}
+
+	src, err := openGGUFFileSplitSource(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(output)
+		}
+	}()
+	if err = writeGGUFFile(output, src.Magic, src.ByteOrder, src.Alignment, src.MetadataKV, src.Tensors); err != nil {
+		return fmt.Errorf("write file %q: %w", output, err)
+	}
+
+	return nil
+}
+
+type (
+	// _GGUFSplitSource holds the opened (shards of) GGUF file to split or merge.
+	_GGUFSplitSource struct {
+		Files      []*os.File
+		Magic      GGUFMagic
+		ByteOrder  binary.ByteOrder
+		Alignment  uint64
+		MetadataKV GGUFMetadataKVs
+		Tensors    []_GGUFSplitTensor
+	}
+
+	// _GGUFSplitTensor locates the tensor data in the source file.
+	_GGUFSplitTensor struct {
+		Info   GGUFTensorInfo
+		File   io.ReaderAt
+		Offset int64
+		Size   uint64
+	}
+)
+
+// openGGUFFileSplitSource opens the GGUF file of the given path,
+// completes the shards if the path is a shard,
+// and reads the full metadata and tensor infos.
+func openGGUFFileSplitSource(path string) (_ *_GGUFSplitSource, err error) {
+	paths := CompleteShardGGUFFilename(path)
+	if paths == nil {
+		paths = []string{path}
+	}
+
+	var src _GGUFSplitSource
+	defer func() {
+		if err != nil {
+			src.Close()
+		}
+	}()
+
+	ss := make([]*_GGUFFileShard, len(paths))
+	for i := range paths {
+		f, err := osx.Open(paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+		src.Files = append(src.Files, f)
+
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("stat file: %w", err)
+		}
+		ss[i], err = parseGGUFFileShard(_GGUFFileReadSeeker{
+			Name:       paths[i],
+			Closer:     f,
+			ReadSeeker: f,
+			Size:       fi.Size(),
+		}, _GGUFReadOptions{})
+		if err != nil {
+			if len(paths) > 1 {
+				err = &GGUFFileShardError{Index: i, Total: len(paths), Name: paths[i], Err: err}
+			}
+			return nil, err
+		}
+	}
+	if err = validateGGUFFileShards(ss); err != nil {
+		return nil, err
+	}
+
+	src.Magic = ss[0].Magic
+	src.ByteOrder = binary.LittleEndian
+	if src.Magic == GGUFMagicGGUFBe {
+		src.ByteOrder = binary.BigEndian
+	}
+	src.Alignment = 32
+	for _, kv := range ss[0].MetadataKV {
+		if strings.HasPrefix(kv.Key, "split.") {
+			continue
+		}
+		if kv.Key == "general.alignment" {
+			if ag := anyx.Number[uint64](kv.Value); ag > 0 && ag%8 == 0 {
+				src.Alignment = ag
+			}
+		}
+		src.MetadataKV = append(src.MetadataKV, kv)
+	}
+
+	for i, s := range ss {
+		ds := int64(GGMLPadding(uint64(s.TensorInfosEndOffset), src.Alignment))
+		for _, ti := range s.TensorInfos {
+			t := _GGUFSplitTensor{
+				Info:   ti,
+				File:   src.Files[i],
+				Offset: ds + int64(ti.Offset),
+				Size:   ti.Bytes(),
+			}
+			if t.Offset < ds || t.Offset+int64(t.Size) > s.Size {
+				return nil, fmt.Errorf("tensor %q data out of range of file %q", ti.Name, paths[i])
+			}
+			src.Tensors = append(src.Tensors, t)
+		}
+	}
+
+	return &src, nil
+}
+
+func (s *_GGUFSplitSource) Close() {
+	for i := range s.Files {
+		osx.Close(s.Files[i])
+	}
+}
+
+// writeGGUFFile writes a GGUF file to the given path with the given metadata and tensors,
+// the tensor data is streamed from the source file.
+func writeGGUFFile(
+	path string,
+	magic GGUFMagic,
+	bo binary.ByteOrder,
+	alignment uint64,
+	kvs GGUFMetadataKVs,
+	tensors []_GGUFSplitTensor,
+) error {
+	f, err := osx.CreateFile(path, 0o644)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer osx.Close(f)
+
+	bw := bufio.NewWriterSize(f, 4*1024*1024)
+
+	// magic, always in little endian as the reader detects the byte order by it
+	if err = binary.Write(bw, binary.LittleEndian, magic); err != nil {
+		return fmt.Errorf("write magic: %w", err)
+	}
+
+	wr := _GGUFWriter{w: bw, bo: bo, n: 4}
+
+	// version
+	if err = wr.WriteValue(GGUFMetadataValueTypeUint32, uint32(GGUFVersionV3)); err != nil {
+		return fmt.Errorf("write version: %w", err)
+	}
+	if err = wr.WriteValue(GGUFMetadataValueTypeUint64, uint64(len(tensors))); err != nil {
+		return fmt.Errorf("write tensor count: %w", err)
+	}
+	if err = wr.WriteValue(GGUFMetadataValueTypeUint64, uint64(len(kvs))); err != nil {
+		return fmt.Errorf("write metadata kv count: %w", err)
+	}
+
+	// metadata kv
+	for i := range kvs {
+		if err = wr.WriteMetadataKV(kvs[i]); err != nil {
+			return fmt.Errorf("write metadata kv %q: %w", kvs[i].Key, err)
+		}
+	}
+
+	// tensor infos
+	var offset uint64
+	for i := range tensors {
+		ti := tensors[i].Info
+		ti.Offset = offset
+		if err = wr.WriteTensorInfo(ti); err != nil {
+			return fmt.Errorf("write tensor info %q: %w", ti.Name, err)
+		}
+		offset += GGMLPadding(tensors[i].Size, alignment)
+	}
+
+	// padding
+	if err = wr.WritePadding(GGMLPadding(wr.n, alignment) - wr.n); err != nil {
+		return fmt.Errorf("write padding: %w", err)
+	}
+
+	// tensor data
+	for i := range tensors {
+		t := tensors[i]
+		if _, err = io.Copy(bw, io.NewSectionReader(t.File, t.Offset, int64(t.Size))); err != nil {
+			return fmt.Errorf("write tensor data %q: %w", t.Info.Name, err)
+		}
+		if err = wr.WritePadding(GGMLPadding(t.Size, alignment) - t.Size); err != nil {
+			return fmt.Errorf("write tensor data padding %q: %w", t.Info.Name, err)
+		}
+	}
+
+	if err = bw.Flush(); err != nil {
+		return fmt.Errorf("flush file: %w", err)
+	}
+	return f.Sync()
+}
+
+// _GGUFWriter writes the GGUF items in version 3,
+// it counts the written bytes.
+type _GGUFWriter struct {
+	w  io.Writer
+	bo binary.ByteOrder
+	n  uint64
+}
+
+func (wr *_GGUFWriter) write(v any) error {
+	if err := binary.Write(wr.w, wr.bo, v); err != nil {
+		return err
+	}
+	wr.n += uint64(binary.Size(v))
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteString(s string) error {
+	if err := wr.write(uint64(len(s))); err != nil {
+		return err
+	}
+	n, err := io.WriteString(wr.w, s)
+	wr.n += uint64(n)
+	return err
+}
+
+func (wr *_GGUFWriter) WritePadding(n uint64) error {
+	if n == 0 {
+		return nil
+	}
+	m, err := wr.w.Write(make([]byte, n))
+	wr.n += uint64(m)
+	return err
+}
+
+func (wr *_GGUFWriter) WriteValue(vt GGUFMetadataValueType, v any) error {
+	switch vt {
+	case GGUFMetadataValueTypeUint8:
+		return wr.write(anyx.Number[uint8](v))
+	case GGUFMetadataValueTypeInt8:
+		return wr.write(anyx.Number[int8](v))
+	case GGUFMetadataValueTypeUint16:
+		return wr.write(anyx.Number[uint16](v))
+	case GGUFMetadataValueTypeInt16:
+		return wr.write(anyx.Number[int16](v))
+	case GGUFMetadataValueTypeUint32:
+		return wr.write(anyx.Number[uint32](v))
+	case GGUFMetadataValueTypeInt32:
+		return wr.write(anyx.Number[int32](v))
+	case GGUFMetadataValueTypeFloat32:
+		return wr.write(anyx.Number[float32](v))
+	case GGUFMetadataValueTypeBool:
+		return wr.write(anyx.Bool(v))
+	case GGUFMetadataValueTypeString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("invalid string value: %v", v)
+		}
+		return wr.WriteString(s)
+	case GGUFMetadataValueTypeArray:
+		av, ok := v.(GGUFMetadataKVArrayValue)
+		if !ok {
+			return fmt.Errorf("invalid array value: %v", v)
+		}
+		if uint64(len(av.Array)) != av.Len {
+			return errors.New("array items are not read, parse the file without skipping large metadata")
+		}
+		if err := wr.write(uint32(av.Type)); err != nil {
+			return err
+		}
+		if err := wr.write(av.Len); err != nil {
+			return err
+		}
+		for i := range av.Array {
+			if err := wr.WriteValue(av.Type, av.Array[i]); err != nil {
+				return fmt.Errorf("write array item %d: %w", i, err)
+			}
+		}
+		return nil
+	case GGUFMetadataValueTypeUint64:
+		return wr.write(anyx.Number[uint64](v))
+	case GGUFMetadataValueTypeInt64:
+		return wr.write(anyx.Number[int64](v))
+	case GGUFMetadataValueTypeFloat64:
+		return wr.write(anyx.Number[float64](v))
+	default:
+		return fmt.Errorf("invalid type: %v", vt)
+	}
+}
+
+func (wr *_GGUFWriter) WriteMetadataKV(kv GGUFMetadataKV) error {
+	if err := wr.WriteString(kv.Key); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	if err := wr.write(uint32(kv.ValueType)); err != nil {
+		return fmt.Errorf("write value type: %w", err)
+	}
+	if err := wr.WriteValue(kv.ValueType, kv.Value); err != nil {
+		return fmt.Errorf("write value: %w", err)
+	}
+	return nil
+}
+
+func (wr *_GGUFWriter) WriteTensorInfo(ti GGUFTensorInfo) error {
+	if err := wr.WriteString(ti.Name); err != nil {
+		return fmt.Errorf("write name: %w", err)
+	}
+	if err := wr.write(ti.NDimensions); err != nil {
+		return fmt.Errorf("write n dimensions: %w", err)
+	}
+	for i := range ti.Dimensions {
+		if err := wr.write(ti.Dimensions[i]); err != nil {
+			return fmt.Errorf("write dimension %d: %w", i, err)
+		}
+	}
+	if err := wr.write(uint32(ti.Type)); err != nil {
+		return fmt.Errorf("write type: %w", err)
+	}
+	if err := wr.write(ti.Offset); err != nil {
+		return fmt.Errorf("write offset: %w", err)
+	}
+	return nil
+}
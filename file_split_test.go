@@ -0,0 +1,129 @@
+package gguf_parser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitAndMergeGGUFFile(t *testing.T) {
+	kvs := GGUFMetadataKVs{
+		{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+		{Key: "general.alignment", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(32)},
+		{Key: "llama.block_count", ValueType: GGUFMetadataValueTypeUint32, Value: uint32(5)},
+	}
+	tis := make(GGUFTensorInfos, 5)
+	for i := range tis {
+		tis[i] = GGUFTensorInfo{
+			Name:        fmt.Sprintf("blk.%d.ffn_up.weight", i),
+			NDimensions: 2,
+			Dimensions:  []uint64{8, uint64(i + 1)},
+			Type:        GGMLTypeF32,
+		}
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "model.gguf")
+	if err := os.WriteFile(src, testGGUFFileBytes(kvs, tis), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	assertTensorData := func(t *testing.T, path string) {
+		s, err := openGGUFFileSplitSource(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if len(s.Tensors) != len(tis) {
+			t.Fatalf("expected %d tensors, got %d", len(tis), len(s.Tensors))
+		}
+		for i, st := range s.Tensors {
+			if st.Info.Name != tis[i].Name {
+				t.Fatalf("expected tensor %d named %q, got %q", i, tis[i].Name, st.Info.Name)
+			}
+			bs := make([]byte, st.Size)
+			if _, err = st.File.ReadAt(bs, st.Offset); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bs, bytes.Repeat([]byte{byte(i + 1)}, len(bs))) {
+				t.Fatalf("unexpected data of tensor %q", st.Info.Name)
+			}
+		}
+	}
+
+	cases := []struct {
+		name   string
+		opts   []GGUFSplitOption
+		shards int
+	}{
+		{
+			name:   "max tensors",
+			opts:   []GGUFSplitOption{WithSplitMaxTensors(2)},
+			shards: 3,
+		},
+		{
+			// Tensors are 32, 64, 96, 128 and 160 bytes.
+			name:   "max size",
+			opts:   []GGUFSplitOption{WithSplitMaxSize(200)},
+			shards: 3,
+		},
+		{
+			name:   "single shard",
+			shards: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := t.TempDir()
+			paths, err := SplitGGUFFile(src, filepath.Join(out, "model"), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != tc.shards {
+				t.Fatalf("expected %d shards, got %d", tc.shards, len(paths))
+			}
+			for i := range paths {
+				if !IsShardGGUFFilename(paths[i]) {
+					t.Fatalf("expected shard filename, got %q", paths[i])
+				}
+			}
+
+			f, err := ParseGGUFFile(paths[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.TensorInfos) != len(tis) || len(f.SplitSizes) != tc.shards {
+				t.Fatalf("expected %d tensors in %d shards, got %d in %d",
+					len(tis), tc.shards, len(f.TensorInfos), len(f.SplitSizes))
+			}
+			if v, ok := f.Header.MetadataKV.Get("llama.block_count"); !ok || v.ValueUint32() != 5 {
+				t.Fatal("expected metadata to be kept in the first shard")
+			}
+			assertTensorData(t, paths[len(paths)-1])
+
+			merged := filepath.Join(out, "merged.gguf")
+			if err = MergeGGUFFile(paths[0], merged); err != nil {
+				t.Fatal(err)
+			}
+			mf, err := ParseGGUFFile(merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := mf.Header.MetadataKV.Get("split.count"); ok {
+				t.Fatal("expected split metadata to be dropped")
+			}
+			if len(mf.Header.MetadataKV) != len(kvs) {
+				t.Fatalf("expected %d metadata, got %d", len(kvs), len(mf.Header.MetadataKV))
+			}
+			assertTensorData(t, merged)
+		})
+	}
+
+	t.Run("merge non-shard", func(t *testing.T) {
+		if err := MergeGGUFFile(src, filepath.Join(dir, "merged.gguf")); err == nil {
+			t.Fatal("expected error for non-shard file")
+		}
+	})
+}
@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -478,3 +484,300 @@ func TestTensorInfoReaderRejectsBadNDimensions(t *testing.T) {
 		})
 	}
 }
+
+// testGGUFFileBytes builds a little-endian GGUF v3 file with the given metadata and tensor infos,
+// the data of the i-th tensor is filled with byte(i+1).
+func testGGUFFileBytes(kvs GGUFMetadataKVs, tis GGUFTensorInfos) []byte {
+	var buf bytes.Buffer
+	bo := binary.LittleEndian
+	writeString := func(s string) {
+		_ = binary.Write(&buf, bo, uint64(len(s)))
+		buf.WriteString(s)
+	}
+
+	_ = binary.Write(&buf, bo, GGUFMagicGGUFLe)
+	_ = binary.Write(&buf, bo, GGUFVersionV3)
+	_ = binary.Write(&buf, bo, uint64(len(tis)))
+	_ = binary.Write(&buf, bo, uint64(len(kvs)))
+	for _, kv := range kvs {
+		writeString(kv.Key)
+		_ = binary.Write(&buf, bo, kv.ValueType)
+		if kv.ValueType == GGUFMetadataValueTypeString {
+			writeString(kv.Value.(string))
+			continue
+		}
+		_ = binary.Write(&buf, bo, kv.Value)
+	}
+	var ds uint64
+	for _, ti := range tis {
+		writeString(ti.Name)
+		_ = binary.Write(&buf, bo, ti.NDimensions)
+		_ = binary.Write(&buf, bo, ti.Dimensions)
+		_ = binary.Write(&buf, bo, ti.Type)
+		_ = binary.Write(&buf, bo, ds)
+		ds += (ti.Bytes() + 31) / 32 * 32
+	}
+	buf.Write(make([]byte, (32-buf.Len()%32)%32))
+	for i, ti := range tis {
+		buf.Write(bytes.Repeat([]byte{byte(i + 1)}, int(ti.Bytes())))
+		buf.Write(make([]byte, (32-int(ti.Bytes())%32)%32))
+	}
+	return buf.Bytes()
+}
+
+// testSplitGGUFFileShards returns the metadata and tensor infos of the shards of a split GGUF file,
+// each shard holds one tensor,
+// and like gguf-split, the shards after the first one hold the split.* metadata only.
+func testSplitGGUFFileShards(count int) ([]GGUFMetadataKVs, []GGUFTensorInfos) {
+	kvss := make([]GGUFMetadataKVs, count)
+	tiss := make([]GGUFTensorInfos, count)
+	for i := 0; i < count; i++ {
+		kvss[i] = GGUFMetadataKVs{
+			{Key: "split.no", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(i)},
+			{Key: "split.count", ValueType: GGUFMetadataValueTypeUint16, Value: uint16(count)},
+			{Key: "split.tensors.count", ValueType: GGUFMetadataValueTypeInt32, Value: int32(count)},
+		}
+		if i == 0 {
+			kvss[i] = append(GGUFMetadataKVs{
+				{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+			}, kvss[i]...)
+		}
+		tiss[i] = GGUFTensorInfos{
+			{Name: fmt.Sprintf("blk.%d.ffn_up.weight", i), NDimensions: 2, Dimensions: []uint64{8, 2}, Type: GGMLTypeF32},
+		}
+	}
+	return kvss, tiss
+}
+
+// testSplitGGUFFileBytes builds the shards of a split GGUF file.
+func testSplitGGUFFileBytes(count int) [][]byte {
+	kvss, tiss := testSplitGGUFFileShards(count)
+	bss := make([][]byte, count)
+	for i := range bss {
+		bss[i] = testGGUFFileBytes(kvss[i], tiss[i])
+	}
+	return bss
+}
+
+func TestParseGGUFFileRemoteWithShards(t *testing.T) {
+	const count = 12
+	bss := testSplitGGUFFileBytes(count)
+
+	var inflight, maxInflight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			m := maxInflight.Load()
+			if n <= m || maxInflight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		var i, c int
+		if _, err := fmt.Sscanf(r.URL.Path, "/model-%05d-of-%05d.gguf", &i, &c); err != nil || i < 1 || i > count {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(bss[i-1]))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	t.Run("merge in order", func(t *testing.T) {
+		maxInflight.Store(0)
+		f, err := ParseGGUFFileRemote(ctx, srv.URL+"/model-00001-of-00012.gguf", UseShardConcurrency(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Header.TensorCount != count || len(f.TensorInfos) != count || len(f.SplitSizes) != count {
+			t.Fatalf("expected %d shards merged, got %d tensors and %d sizes", count, len(f.TensorInfos), len(f.SplitSizes))
+		}
+		for i := range f.TensorInfos {
+			if n := fmt.Sprintf("blk.%d.ffn_up.weight", i); f.TensorInfos[i].Name != n {
+				t.Fatalf("expected tensor %d named %q, got %q", i, n, f.TensorInfos[i].Name)
+			}
+		}
+		if _, ok := f.Header.MetadataKV.Get("split.no"); ok {
+			t.Fatal("expected split.no to be dropped")
+		}
+		if m := maxInflight.Load(); m > 4 {
+			t.Fatalf("expected at most 4 concurrent requests, got %d", m)
+		}
+	})
+
+	t.Run("shared client", func(t *testing.T) {
+		// Run with -race, the shards are fetched by one client concurrently.
+		f, err := ParseGGUFFileRemote(ctx, srv.URL+"/model-00001-of-00012.gguf", UseShardConcurrency(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.TensorInfos) != count {
+			t.Fatalf("expected %d tensors, got %d", count, len(f.TensorInfos))
+		}
+	})
+
+	t.Run("missing shard", func(t *testing.T) {
+		_, err := ParseGGUFFileRemote(ctx, srv.URL+"/model-00001-of-00013.gguf")
+		if err == nil {
+			t.Fatal("expected error for missing shard")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := ParseGGUFFileRemote(ctx, srv.URL+"/model-00001-of-00012.gguf")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+	})
+}
+
+func TestParseGGUFFileWithInconsistentShards(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(kvss []GGUFMetadataKVs, tiss []GGUFTensorInfos)
+		tamper func(bss [][]byte) [][]byte
+		shard  int
+	}{
+		{
+			name: "wrong split.no",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[1][0].Value = uint16(2)
+			},
+			shard: 1,
+		},
+		{
+			name: "wrong split.count",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[2][1].Value = uint16(4)
+			},
+			shard: 2,
+		},
+		{
+			name: "wrong split.tensors.count",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[1][2].Value = int32(4)
+			},
+			shard: 1,
+		},
+		{
+			name: "duplicate tensor",
+			mutate: func(_ []GGUFMetadataKVs, tiss []GGUFTensorInfos) {
+				tiss[2][0].Name = tiss[0][0].Name
+			},
+			shard: 2,
+		},
+		{
+			name: "missing tensor",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				for i := range kvss {
+					for j := range kvss[i] {
+						if kvss[i][j].Key == "split.tensors.count" {
+							kvss[i][j].Value = int32(4)
+						}
+					}
+				}
+			},
+			shard: 2,
+		},
+		{
+			name: "mismatched architecture",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[1] = append(kvss[1],
+					GGUFMetadataKV{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "qwen2"})
+			},
+			shard: 1,
+		},
+		{
+			name: "mismatched hash",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[0] = append(kvss[0],
+					GGUFMetadataKV{Key: "general.uuid", ValueType: GGUFMetadataValueTypeString, Value: "3b1c2e0a-5f2d-5d7e-9a41-1f0c7d2e8b61"})
+				kvss[2] = append(kvss[2],
+					GGUFMetadataKV{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"},
+					GGUFMetadataKV{Key: "general.uuid", ValueType: GGUFMetadataValueTypeString, Value: "9e4f7a21-0c3b-5e8d-b2a6-7d5c1e9f0a34"})
+			},
+			shard: 2,
+		},
+		{
+			name: "missing hash",
+			mutate: func(kvss []GGUFMetadataKVs, _ []GGUFTensorInfos) {
+				kvss[0] = append(kvss[0],
+					GGUFMetadataKV{Key: "general.uuid", ValueType: GGUFMetadataValueTypeString, Value: "3b1c2e0a-5f2d-5d7e-9a41-1f0c7d2e8b61"})
+				kvss[1] = append(kvss[1],
+					GGUFMetadataKV{Key: "general.architecture", ValueType: GGUFMetadataValueTypeString, Value: "llama"})
+			},
+			shard: 1,
+		},
+		{
+			name: "truncated tensor data",
+			tamper: func(bss [][]byte) [][]byte {
+				bss[1] = bss[1][:len(bss[1])-32]
+				return bss
+			},
+			shard: 1,
+		},
+		{
+			name: "trailing tensor data",
+			tamper: func(bss [][]byte) [][]byte {
+				bss[2] = append(bss[2], make([]byte, 64)...)
+				return bss
+			},
+			shard: 2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvss, tiss := testSplitGGUFFileShards(3)
+			if tc.mutate != nil {
+				tc.mutate(kvss, tiss)
+			}
+			bss := make([][]byte, len(kvss))
+			for i := range kvss {
+				bss[i] = testGGUFFileBytes(kvss[i], tiss[i])
+			}
+			if tc.tamper != nil {
+				bss = tc.tamper(bss)
+			}
+
+			dir := t.TempDir()
+			for i := range bss {
+				p := filepath.Join(dir, fmt.Sprintf("model-%05d-of-%05d.gguf", i+1, len(bss)))
+				if err := os.WriteFile(p, bss[i], 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := ParseGGUFFile(filepath.Join(dir, "model-00001-of-00003.gguf"))
+			if !errors.Is(err, ErrGGUFFileShardMismatched) {
+				t.Fatalf("expected shard mismatched error, got %v", err)
+			}
+			var se *GGUFFileShardError
+			if !errors.As(err, &se) || se.Index != tc.shard {
+				t.Fatalf("expected error of shard %d, got %v", tc.shard, err)
+			}
+		})
+	}
+
+	t.Run("consistent", func(t *testing.T) {
+		dir := t.TempDir()
+		for i, bs := range testSplitGGUFFileBytes(3) {
+			p := filepath.Join(dir, fmt.Sprintf("model-%05d-of-%05d.gguf", i+1, 3))
+			if err := os.WriteFile(p, bs, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		f, err := ParseGGUFFile(filepath.Join(dir, "model-00001-of-00003.gguf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.TensorInfos) != 3 {
+			t.Fatalf("expected 3 tensors, got %d", len(f.TensorInfos))
+		}
+	})
+}
@@ -171,6 +171,30 @@ func CompleteShardGGUFFilename(name string) []string {
 	return names
 }
 
+var ShardSafetensorsFilenameRegex = regexp.MustCompile(`^(?P<Prefix>.*)-(?:(?P<Shard>\d{5})-of-(?P<ShardTotal>\d{5}))\.safetensors$`)
+
+// CompleteShardSafetensorsFilename returns the list of shard safetensors filenames that are related to the given shard safetensors filename.
+//
+// Only available if the given filename is a shard safetensors filename.
+func CompleteShardSafetensorsFilename(name string) []string {
+	r := ShardSafetensorsFilenameRegex.FindStringSubmatch(name)
+	if r == nil {
+		return nil
+	}
+
+	shardTotal := parseInt(r[ShardSafetensorsFilenameRegex.SubexpIndex("ShardTotal")])
+	if shardTotal <= 0 {
+		return nil
+	}
+
+	names := make([]string, 0, shardTotal)
+	for i := 1; i <= shardTotal; i++ {
+		names = append(names, fmt.Sprintf("%s-%05d-of-%05d.safetensors",
+			r[ShardSafetensorsFilenameRegex.SubexpIndex("Prefix")], i, shardTotal))
+	}
+	return names
+}
+
 func parseInt(v string) int {
 	return int(funcx.MustNoError(strconv.ParseInt(v, 10, 64)))
 }
@@ -5,6 +5,7 @@
 //go:generate go run golang.org/x/tools/cmd/stringer -linecomment -type GGUFMetadataValueType -output zz_generated.ggufmetadatavaluetype.stringer.go -trimprefix GGUFMetadataValueType
 //go:generate go run golang.org/x/tools/cmd/stringer -linecomment -type GGUFFileType -output zz_generated.gguffiletype.stringer.go -trimprefix GGUFFileType
 //go:generate go run golang.org/x/tools/cmd/stringer -linecomment -type GGMLType -output zz_generated.ggmltype.stringer.go -trimprefix GGMLType
+//go:generate go run golang.org/x/tools/cmd/stringer -linecomment -type GGUFLintSeverity -output zz_generated.gguflintseverity.stringer.go -trimprefix GGUFLintSeverity
 package gguf_parser
 
 import _ "golang.org/x/tools/cmd/stringer"
@@ -3,17 +3,23 @@ package httpx
 import (
 	"context"
 	"net"
+	"sync"
 )
 
 func DNSCacheDialContext(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
-	cs := map[string][]net.IP{}
+	var (
+		cs  = map[string][]net.IP{}
+		csm sync.RWMutex
+	)
 
 	return func(ctx context.Context, nw, addr string) (conn net.Conn, err error) {
 		h, p, err := net.SplitHostPort(addr)
 		if err != nil {
 			return nil, err
 		}
+		csm.RLock()
 		ips, ok := cs[h]
+		csm.RUnlock()
 		if !ok {
 			ips, err = net.DefaultResolver.LookupIP(ctx, "ip4", h)
 			if len(ips) == 0 {
@@ -22,7 +28,9 @@ func DNSCacheDialContext(dialer *net.Dialer) func(context.Context, string, strin
 			if err != nil {
 				return nil, err
 			}
+			csm.Lock()
 			cs[h] = ips
+			csm.Unlock()
 		}
 		// Try to connect to each IP address in order.
 		for _, ip := range ips {